@@ -2,40 +2,168 @@ package arcane
 
 import (
 	"crypto"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/x509"
 	"errors"
 	"io"
+	"strconv"
 	"time"
 )
 
 var (
 	// ErrUnableToGetEncryptionKey is returned when Opener is not able to decrypt the encryption key.
 	ErrUnableToGetEncryptionKey = errors.New("unable to get encryption key used to encrypt the message")
+	// ErrUnsupportedPrivateKey is returned when the PrivateKey of Opener is not one of the supported key types.
+	ErrUnsupportedPrivateKey = errors.New("unsupported opener private key")
 	// ErrUnableToParseSealerCert is returned if Opener is not able to parse the certificate sent by Sealer.
 	ErrUnableToParseSealerCert = errors.New("unable to parse certificate used to seal message")
 	// ErrUntrustedCert is returned if the certificate sent by the sealer is not trusted.
 	ErrUntrustedCert = errors.New("sealer certificate is not trusted")
 	// ErrInvalidSignature is returned if signature is not valid.
 	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrInvalidMessage is returned if a message is malformed, for instance when a stream has data after its signature.
+	ErrInvalidMessage = errors.New("invalid message")
 	// ErrUnableToDecryptPayload is returned if Opener is not able to decrypt payload.
 	ErrUnableToDecryptPayload = errors.New("unable to decrypt payload")
+	// ErrRevokedCert is returned if a certificate in the chain of the sealer certificate is revoked.
+	ErrRevokedCert = errors.New("sealer certificate is revoked")
+	// ErrInvalidOCSPResponse is returned if the OCSP response stapled to a message is not signed by the issuer of the
+	// sealer certificate or is not current.
+	ErrInvalidOCSPResponse = errors.New("invalid ocsp response")
+	// ErrRevocationUnknown is returned if the revocation status of a certificate in the chain of the sealer certificate
+	// can not be determined.
+	ErrRevocationUnknown = errors.New("unable to determine revocation status of sealer certificate")
 	// ErrMessageExpired is returned when a message is past its expiration.
 	ErrMessageExpired = errors.New("message is expired")
+	// ErrMessageNotYetValid is returned when a message is created further into the future than the Opener tolerates.
+	ErrMessageNotYetValid = errors.New("message is created in the future")
+	// ErrNotRecipient is returned when a message has no encryption key addressed to the Opener.
+	ErrNotRecipient = errors.New("message is not addressed to opener")
+	// ErrUnsupportedKeyWrap is returned when the encryption key is wrapped using an algorithm the Opener does not accept.
+	ErrUnsupportedKeyWrap = errors.New("unsupported key wrap algorithm")
+	// ErrUnsupportedSignatureAlgorithm is returned when a message is signed using an algorithm the Opener does not accept.
+	ErrUnsupportedSignatureAlgorithm = errors.New("unsupported signature algorithm")
+	// ErrUnsupportedVersion is returned when a message uses a format version the Opener does not know.
+	ErrUnsupportedVersion = errors.New("unsupported message format version")
+	// ErrUnsupportedSuite is returned when a message is sealed using a suite that is unknown or not accepted by the
+	// Opener.
+	ErrUnsupportedSuite = errors.New("unsupported suite")
+	// ErrReplayedMessage is returned when a message has already been opened.
+	ErrReplayedMessage = errors.New("message has already been opened")
+	// ErrInvalidMessageID is returned when replay protection is enabled and a message has no valid message ID.
+	ErrInvalidMessageID = errors.New("message has no valid message id")
+	// ErrInvalidClaim is returned when a claim name is reserved or not valid, or a message has too many claims.
+	ErrInvalidClaim = errors.New("invalid claim")
+	// ErrSenderNotAuthorized is returned when the sealer of a message is trusted but not allowed by the SenderPolicy of
+	// the Opener.
+	ErrSenderNotAuthorized = errors.New("sender is not authorized")
 )
 
+// UnsupportedVersionError is returned when a message uses a format version the Opener does not know. It matches
+// ErrUnsupportedVersion using errors.Is.
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return ErrUnsupportedVersion.Error() + " " + strconv.Itoa(e.Version)
+}
+
+// Is reports whether target is ErrUnsupportedVersion.
+func (e *UnsupportedVersionError) Is(target error) bool {
+	return target == ErrUnsupportedVersion
+}
+
+// UnsupportedSuiteError is returned when a message is sealed using a suite that is unknown or not accepted by the
+// Opener. It matches ErrUnsupportedSuite using errors.Is.
+type UnsupportedSuiteError struct {
+	Suite string
+	// Registered is true if the suite is known but not accepted by the Opener.
+	Registered bool
+}
+
+func (e *UnsupportedSuiteError) Error() string {
+	if e.Registered {
+		return "suite " + strconv.Quote(e.Suite) + " is not allowed"
+	}
+
+	return ErrUnsupportedSuite.Error() + " " + strconv.Quote(e.Suite)
+}
+
+// Is reports whether target is ErrUnsupportedSuite.
+func (e *UnsupportedSuiteError) Is(target error) bool {
+	return target == ErrUnsupportedSuite
+}
+
+// InvalidClaimError is returned when a claim name is reserved or not valid, or its value is too long. It matches
+// ErrInvalidClaim using errors.Is.
+type InvalidClaimError struct {
+	Name string
+	// Reserved is true if the name is reserved.
+	Reserved bool
+}
+
+func (e *InvalidClaimError) Error() string {
+	if e.Reserved {
+		return "claim name " + strconv.Quote(e.Name) + " is reserved"
+	}
+
+	return ErrInvalidClaim.Error() + " " + strconv.Quote(e.Name)
+}
+
+// Is reports whether target is ErrInvalidClaim.
+func (e *InvalidClaimError) Is(target error) bool {
+	return target == ErrInvalidClaim
+}
+
+// SenderNotAuthorizedError is returned when the sealer of a message is not allowed by the SenderPolicy of the Opener.
+// It matches ErrSenderNotAuthorized using errors.Is.
+type SenderNotAuthorizedError struct {
+	// Rule names the rule the sealer did not match. For Policy it is the name of the field holding the rule.
+	Rule string
+}
+
+func (e *SenderNotAuthorizedError) Error() string {
+	return ErrSenderNotAuthorized.Error() + " by rule " + e.Rule
+}
+
+// Is reports whether target is ErrSenderNotAuthorized.
+func (e *SenderNotAuthorizedError) Is(target error) bool {
+	return target == ErrSenderNotAuthorized
+}
+
 // Used to simplify testing.
 var now = time.Now
 
 // Header is ...
 type Header struct {
-	SealerCert   []byte `json:"sealerCert"`
-	Signature    []byte `json:"signature"`
-	EncryptedKey []byte `json:"encryptedKey"`
+	// Version is the message format version. It is empty for messages sealed before it was introduced.
+	Version int `json:"version,omitempty"`
+	// MessageID uniquely identifies the message. It is empty for messages sealed before it was introduced.
+	MessageID string `json:"messageId,omitempty"`
+	// Suite is the name of the suite the message is sealed with. It is empty for messages sealed before it was
+	// introduced, which means SuiteLegacy.
+	Suite      string `json:"suite,omitempty"`
+	SealerCert []byte `json:"sealerCert"`
+	// SealerChain holds the DER encoded intermediate certificates of SealerCert, ordered from the issuer of SealerCert
+	// towards the root. It is only used to build a path to the roots of the Opener.
+	SealerChain [][]byte `json:"sealerChain,omitempty"`
+	// OCSPResponse is a DER encoded OCSP response for SealerCert stapled by the sealer.
+	OCSPResponse []byte `json:"ocspResponse,omitempty"`
+	// SignatureAlgorithm is empty for messages sealed before it was introduced, which means RS256.
+	SignatureAlgorithm SignatureAlgorithm `json:"signatureAlgorithm,omitempty"`
+	Signature          []byte             `json:"signature"`
+	Recipients         []Recipient        `json:"recipients,omitempty"`
+	// ChunkSize is the size of the plaintext chunks of a message sealed using SealStream. It is empty for messages
+	// sealed using Seal.
+	ChunkSize int `json:"chunkSize,omitempty"`
+	// Claims are custom values set by the sealer. They are authenticated but not encrypted.
+	Claims map[string]string `json:"claims,omitempty"`
+	// EncryptedMetadata holds the metadata of the message encoded as JSON and encrypted using the content cipher,
+	// prefixed by the nonce.
+	EncryptedMetadata []byte `json:"encryptedMetadata,omitempty"`
+	// EncryptedKey is only set on messages sealed for a single receiver before Recipients was introduced.
+	EncryptedKey []byte `json:"encryptedKey,omitempty"`
 	Created      string `json:"created"`
 	Expires      string `json:"expires"`
 }
@@ -48,163 +176,569 @@ type Envelope struct {
 
 // Sealer is used to encrypt and sign a message.
 type Sealer struct {
-	TimeToLive   time.Duration
-	PrivateKey   *rsa.PrivateKey
-	Cert         *x509.Certificate
-	ReceiverCert *x509.Certificate
+	TimeToLive time.Duration
+	// PrivateKey is the key used to sign messages. The public key must be an *rsa.PublicKey, *ecdsa.PublicKey using
+	// P-256 or ed25519.PublicKey. Signers for ECDSA keys must return ASN.1 DER encoded signatures.
+	PrivateKey crypto.Signer
+	Cert       *x509.Certificate
+	// Chain holds the intermediate certificates of Cert, ordered from the issuer of Cert towards the root. They are
+	// sent with every message so receivers only need the root in their CertPool. The root itself should not be
+	// included.
+	Chain         []*x509.Certificate
+	ReceiverCerts []*x509.Certificate
+	// SignatureAlgorithm is the algorithm used to sign the message. Defaults to RS256 for RSA keys, ES256 for ECDSA
+	// keys and EdDSA for Ed25519 keys.
+	SignatureAlgorithm SignatureAlgorithm
+	// OCSPResponse is a DER encoded OCSP response for Cert, stapled to every message so the Opener can check the
+	// revocation status of Cert without network access. It should be refreshed before it goes stale, for instance
+	// using FetchOCSPResponse.
+	OCSPResponse []byte
+	// Suite is the name of the suite to seal messages with. If not set the first of SuiteRSA, SuiteEC and SuiteMixed
+	// allowing the sealer and receiver keys is used.
+	Suite string
 }
 
-// Seal encrypts and signs a payload.
+// Seal encrypts and signs a payload. The message can be opened by any of the receivers.
 func (s *Sealer) Seal(payload []byte) (*Envelope, error) {
-	created := now()
-	createdStr := created.Format(time.RFC3339)
-	var expiresStr string
-	if s.TimeToLive != 0 {
-		expiresStr = created.Add(s.TimeToLive).Format(time.RFC3339)
-	} else {
-		// Default to 5min if TTL is not set.
-		expiresStr = created.Add(5 * time.Minute).Format(time.RFC3339)
-	}
+	return s.SealWithOptions(payload, SealOptions{})
+}
 
-	// Make a signature.
-	h := sha256.New()
-	if _, err := h.Write([]byte(createdStr)); err != nil {
-		return nil, err
-	}
-	if _, err := h.Write([]byte(expiresStr)); err != nil {
+// SealOptions holds settings for a single message sealed using SealWithOptions.
+type SealOptions struct {
+	// Claims are added to the header of the message. They are signed and authenticated along with the payload, but
+	// are not encrypted. Claim names must be 1 to 64 ASCII letters, digits, '-', '_' or '.', and can not be any of the
+	// reserved names, which are the JSON names of the header fields and the registered JWT claim names.
+	Claims map[string]string
+	// Metadata is encrypted along with the payload and returned separately from it by OpenWithInfo. Unlike claims it
+	// is only readable by the receivers.
+	Metadata map[string]string
+}
+
+// SealWithOptions encrypts and signs a payload like Seal, using settings that only apply to this message.
+func (s *Sealer) SealWithOptions(payload []byte, options SealOptions) (*Envelope, error) {
+	if err := validateClaims(currentVersion, options.Claims); err != nil {
 		return nil, err
 	}
-	if _, err := h.Write(payload); err != nil {
+
+	header, suite, encryptionKey, err := s.header()
+	if err != nil {
 		return nil, err
 	}
 
-	sign, err := rsa.SignPKCS1v15(rand.Reader, s.PrivateKey, crypto.SHA256, h.Sum(nil))
+	header.Claims = copyClaims(options.Claims)
+
+	// Encrypt message. The header is authenticated along with the payload.
+	aead, err := suite.contentCipher(encryptionKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate random encryption key.
-	encryptionKey := make([]byte, 32)
-	if _, err := rand.Read(encryptionKey); err != nil {
+	if len(options.Metadata) > 0 {
+		if header.EncryptedMetadata, err = sealMetadata(aead, header, options.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, err
 	}
 
-	// Encrypt message.
-	c, err := aes.NewCipher(encryptionKey)
+	encryptedPayload := aead.Seal(nonce, nonce, payload, header.additionalData())
+
+	// Make a signature.
+	signature, err := sign(header.SignatureAlgorithm, s.PrivateKey, signatureDigest(header, encryptedPayload, payload))
 	if err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(c)
+	header.Signature = signature
+
+	return &Envelope{
+		Header:  *header,
+		Payload: encryptedPayload,
+	}, nil
+}
+
+// header returns the header of a new message without the signature, along with the suite it is sealed with and the
+// encryption key wrapped for the receivers.
+func (s *Sealer) header() (*Header, Suite, []byte, error) {
+	if len(s.ReceiverCerts) == 0 {
+		return nil, Suite{}, nil, errors.New("no receiver certificates")
+	}
+
+	messageID, err := newMessageID()
 	if err != nil {
-		return nil, err
+		return nil, Suite{}, nil, err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
+	// The monotonic clock reading is stripped so Expires is computed from wall clock time only.
+	created := now().Round(0)
+	header := &Header{
+		Version:            currentVersion,
+		MessageID:          messageID,
+		SealerCert:         s.Cert.Raw,
+		OCSPResponse:       s.OCSPResponse,
+		SignatureAlgorithm: s.SignatureAlgorithm,
+		Created:            created.Format(timestampLayout(currentVersion)),
+	}
+	if header.SignatureAlgorithm == "" {
+		header.SignatureAlgorithm = defaultSignatureAlgorithm(s.PrivateKey)
+	}
+	for _, cert := range s.Chain {
+		header.SealerChain = append(header.SealerChain, cert.Raw)
 	}
+	header.Expires = created.Add(s.timeToLive()).Format(timestampLayout(currentVersion))
 
-	encryptedPayload := gcm.Seal(nonce, nonce, payload, nil)
+	// Generate random encryption key.
+	encryptionKey := make([]byte, 32)
+	if _, err := rand.Read(encryptionKey); err != nil {
+		return nil, Suite{}, nil, err
+	}
 
-	// Encrypt the encryption key using the receivers public key.
-	receiverPubKey, ok := s.ReceiverCert.PublicKey.(*rsa.PublicKey)
-	if !ok {
-		return nil, errors.New("receiver public key was not an rsa key")
+	// Encrypt the encryption key using each of the receivers public keys.
+	label := keyWrapLabel(header)
+	for _, receiverCert := range s.ReceiverCerts {
+		recipient, err := wrapKey(receiverCert, encryptionKey, label)
+		if err != nil {
+			return nil, Suite{}, nil, err
+		}
+
+		header.Recipients = append(header.Recipients, recipient)
 	}
 
-	encryptedEncryptionKey, err := rsa.EncryptPKCS1v15(rand.Reader, receiverPubKey, encryptionKey)
+	suite, err := s.suite(header)
 	if err != nil {
-		return nil, err
+		return nil, Suite{}, nil, err
 	}
 
-	return &Envelope{
-		Header: Header{
-			SealerCert:   s.Cert.Raw,
-			Signature:    sign,
-			EncryptedKey: encryptedEncryptionKey,
-			Created:      createdStr,
-			Expires:      expiresStr,
-		},
-		Payload: encryptedPayload,
-	}, nil
+	header.Suite = suite.Name
+
+	return header, suite, encryptionKey, nil
+}
+
+// timeToLive returns the TimeToLive of the Sealer, defaulting to 5min if not set.
+func (s *Sealer) timeToLive() time.Duration {
+	if s.TimeToLive != 0 {
+		return s.TimeToLive
+	}
+
+	return 5 * time.Minute
 }
 
 // Opener is used to open a encrypted and signed message,
 type Opener struct {
-	PrivateKey *rsa.PrivateKey
-	CertPool   *x509.CertPool
+	// PrivateKey is the key used to get the encryption key. Must be a crypto.Decrypter for an RSA key, a KeyAgreer, an
+	// *ecdsa.PrivateKey using P-256 or an ed25519.PrivateKey. Messages are not opened using other keys, and ErrUnsupportedPrivateKey
+	// is returned instead.
+	PrivateKey crypto.PrivateKey
+	// Cert is the certificate belonging to PrivateKey. It is used to find the encryption key addressed to the Opener.
+	Cert     *x509.Certificate
+	CertPool *x509.CertPool
+	// SignatureAlgorithms are the signature algorithms accepted when opening a message. Defaults to
+	// DefaultSignatureAlgorithms.
+	SignatureAlgorithms []SignatureAlgorithm
+	// AllowPKCS1v15 allows opening legacy messages, where the encryption key is wrapped using RSA PKCS#1 v1.5 and the
+	// signature does not cover the recipients. It should only be set to open messages sealed by older versions of Sealer.
+	AllowPKCS1v15 bool
+	// Suites are the names of the suites accepted when opening a message. Defaults to DefaultSuites.
+	Suites []string
+	// RevocationChecker is used to check the chain of the sealer certificate for revoked certificates if set.
+	RevocationChecker RevocationChecker
+	// SenderPolicy decides which trusted sealers are allowed to send messages if set. Every sealer with a certificate
+	// chaining to CertPool is allowed if not set.
+	SenderPolicy SenderPolicy
+	// RequireOCSP rejects messages without a stapled OCSP response.
+	RequireOCSP bool
+	// OCSPMaxAge is the maximum age of a stapled OCSP response. Defaults to 7 days. Responses past their next update
+	// time are always rejected.
+	OCSPMaxAge time.Duration
+	// ClockSkew is the difference allowed between the clocks of the sealer and the Opener. Messages are accepted until
+	// ClockSkew after they expire, and are rejected if created more than ClockSkew into the future.
+	ClockSkew time.Duration
+	// MaxTimeToLive limits how long after being created a message is accepted, regardless of when the sealer set it to
+	// expire. No limit is enforced if not set.
+	MaxTimeToLive time.Duration
+	// ReplayCache enables replay protection if set. Every message ID is only accepted once from each sealer
+	// certificate, and messages without a message ID are rejected.
+	ReplayCache ReplayCache
+}
+
+// OpenInfo describes the sealer of an opened message.
+type OpenInfo struct {
+	// SealerCert is the verified certificate of the sealer.
+	SealerCert *x509.Certificate
+	// Chain is the verified chain of SealerCert, starting with SealerCert and ending with a root in Opener.CertPool.
+	Chain []*x509.Certificate
+	// MessageID is empty for messages sealed before message IDs were introduced.
+	MessageID string
+	// Claims are the custom claims set by the sealer.
+	Claims map[string]string
+	// Metadata is the decrypted metadata set by the sealer.
+	Metadata map[string]string
+	// Suite is the name of the suite the message is sealed with.
+	Suite string
+	// Created is the time the message was sealed.
+	Created time.Time
+	// Expires is the expiry time set by the sealer. The Opener may accept the message for a shorter or longer time
+	// depending on MaxTimeToLive and ClockSkew.
+	Expires time.Time
 }
 
 // Open opens a *Message and returns the payload if no errors are encountered.
 func (o *Opener) Open(message *Envelope) ([]byte, error) {
-	expires, err := time.Parse(time.RFC3339, message.Header.Expires)
+	payload, _, err := o.OpenWithInfo(message)
+	return payload, err
+}
+
+// OpenWithInfo opens a message like Open, and also returns who sealed it and when.
+func (o *Opener) OpenWithInfo(message *Envelope) ([]byte, *OpenInfo, error) {
+	if err := o.checkPrivateKey(); err != nil {
+		return nil, nil, err
+	}
+
+	if message.Header.ChunkSize != 0 {
+		return nil, nil, errors.New("message is sealed as a stream")
+	}
+
+	opened, err := o.openHeader(&message.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Decrypt message.
+	aead, err := opened.suite.contentCipher(opened.encryptionKey)
+	if err != nil {
+		return nil, nil, ErrUnableToDecryptPayload
+	}
+
+	var additionalData []byte
+	if message.Header.Version != versionLegacy {
+		additionalData = message.Header.additionalData()
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(message.Payload) < nonceSize {
+		return nil, nil, ErrUnableToDecryptPayload
+	}
+
+	nonce, ciphertext := message.Payload[:nonceSize], message.Payload[nonceSize:]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, nil, ErrUnableToDecryptPayload
+	}
+
+	// Validate signature.
+	digest := signatureDigest(&message.Header, message.Payload, plaintext)
+	if err := verify(opened.signatureAlgorithm, opened.sealerCert.PublicKey, digest, message.Header.Signature); err != nil {
+		return nil, nil, err
+	}
+
+	metadata, err := openMetadata(aead, &message.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := o.checkReplay(opened.sealerCert, message.Header.MessageID, opened.acceptUntil); err != nil {
+		return nil, nil, err
+	}
+
+	info := opened.info(&message.Header)
+	info.Metadata = metadata
+
+	return plaintext, info, nil
+}
+
+// openedHeader holds what is needed to decrypt a message and verify its signature once the header is validated.
+type openedHeader struct {
+	sealerCert         *x509.Certificate
+	chain              []*x509.Certificate
+	suite              Suite
+	signatureAlgorithm SignatureAlgorithm
+	encryptionKey      []byte
+	created            time.Time
+	expires            time.Time
+	// acceptUntil is the time until which the Opener accepts the message.
+	acceptUntil time.Time
+}
+
+// info returns the OpenInfo of a message once its signature is verified.
+func (opened *openedHeader) info(header *Header) *OpenInfo {
+	return &OpenInfo{
+		SealerCert: opened.sealerCert,
+		Chain:      opened.chain,
+		MessageID:  header.MessageID,
+		Claims:     copyClaims(header.Claims),
+		Suite:      opened.suite.Name,
+		Created:    opened.created,
+		Expires:    opened.expires,
+	}
+}
+
+// openHeader validates the header of a message and unwraps the encryption key addressed to the Opener.
+func (o *Opener) openHeader(header *Header) (*openedHeader, error) {
+	if !releasedVersion(header.Version) {
+		return nil, &UnsupportedVersionError{Version: header.Version}
+	}
+
+	// Before versionSignedRecipients the signature does not cover the recipients, so a receiver can wrap the
+	// encryption key for others using any key wrap algorithm and forward the message.
+	if header.Version < versionSignedRecipients && !o.AllowPKCS1v15 {
+		return nil, &UnsupportedVersionError{Version: header.Version}
+	}
+
+	suite, err := o.suite(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateClaims(header.Version, header.Claims); err != nil {
+		return nil, err
+	}
+
+	created, expires, err := parseTimestamps(header)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptUntil, err := o.acceptUntil(created, expires)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureAlgorithm, err := o.signatureAlgorithm(header)
 	if err != nil {
 		return nil, err
 	}
 
-	if now().After(expires) {
-		return nil, ErrMessageExpired
+	if !suite.allowsSignature(signatureAlgorithm) {
+		return nil, ErrUnsupportedSignatureAlgorithm
 	}
 
 	// Validate sealer certificate.
-	sealerCert, err := x509.ParseCertificate(message.Header.SealerCert)
+	sealerCert, err := x509.ParseCertificate(header.SealerCert)
 	if err != nil {
 		return nil, ErrUnableToParseSealerCert
 	}
 
-	if _, err := sealerCert.Verify(x509.VerifyOptions{
-		Roots:     o.CertPool,
-		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-	}); err != nil {
-		return nil, ErrUntrustedCert
+	intermediates, err := sealerChain(header.SealerChain)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedChain, err := o.verifySealer(sealerCert, intermediates, header.OCSPResponse)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get key used to encrypt message.
-	var decryptedKey []byte
-	decryptedKey, err = rsa.DecryptPKCS1v15(rand.Reader, o.PrivateKey, message.Header.EncryptedKey)
+	recipient, err := o.recipient(header)
 	if err != nil {
-		return nil, ErrUnableToGetEncryptionKey
+		return nil, err
 	}
 
-	// Decrypt message.
-	c, err := aes.NewCipher(decryptedKey)
+	if !suite.allowsKeyWrap(recipient.Algorithm) {
+		return nil, ErrUnsupportedKeyWrap
+	}
+
+	encryptionKey, err := o.unwrapKey(recipient, keyWrapLabel(header))
 	if err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(c)
+	return &openedHeader{
+		sealerCert:         sealerCert,
+		chain:              verifiedChain,
+		suite:              suite,
+		signatureAlgorithm: signatureAlgorithm,
+		encryptionKey:      encryptionKey,
+		created:            created,
+		expires:            expires,
+		acceptUntil:        acceptUntil,
+	}, nil
+}
+
+// verifySealer verifies the sealer certificate against the CertPool of the Opener and checks its revocation status and
+// the SenderPolicy. It returns the first verified chain that is not revoked and is allowed by the policy.
+func (o *Opener) verifySealer(sealerCert *x509.Certificate, intermediates *x509.CertPool, ocspResponse []byte) ([]*x509.Certificate, error) {
+	chains, err := sealerCert.Verify(x509.VerifyOptions{
+		Roots:         o.CertPool,
+		Intermediates: intermediates,
+		CurrentTime:   now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return nil, ErrUntrustedCert
+	}
+
+	// The sealer certificate is accepted if any of the chains has no revoked certificates and is allowed by the sender
+	// policy.
+	var verifiedChain []*x509.Certificate
+	for _, chain := range chains {
+		if err = o.checkRevocation(chain); err != nil {
+			continue
+		}
+
+		if err = o.authorize(chain); err == nil {
+			verifiedChain = chain
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	nonceSize := gcm.NonceSize()
-	nonce, ciphertext := message.Payload[:nonceSize], message.Payload[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err := o.checkOCSP(ocspResponse, verifiedChain); err != nil {
+		return nil, err
+	}
+
+	return verifiedChain, nil
+}
+
+// signedMessage holds what the signature of a message sealed using SealCOSE, SealJWE or SealCMS asserts, once
+// decrypted.
+type signedMessage struct {
+	alg SignatureAlgorithm
+	// certs holds the sealer certificate followed by its intermediates.
+	certs     [][]byte
+	created   time.Time
+	expires   time.Time
+	messageID string
+	claims    map[string]string
+	// receivers holds the SHA-256 fingerprints of the receiver certificates, so a receiver can not forward the message
+	// to others as if the sealer had addressed it to them.
+	receivers [][]byte
+	// signingInput is the data signed using signStandard.
+	signingInput []byte
+	signature    []byte
+}
+
+// openSigned applies the rules of Open to a message sealed using SealCOSE, SealJWE or SealCMS: the timestamps, the
+// signature algorithm, trust in the sealer certificate, the signature, the signed receivers and replay protection.
+func (o *Opener) openSigned(m *signedMessage) (*OpenInfo, error) {
+	if m.expires.Before(m.created) {
+		return nil, errors.New("message expires before it is created")
+	}
+
+	acceptUntil, err := o.acceptUntil(m.created, m.expires)
 	if err != nil {
-		return nil, ErrUnableToDecryptPayload
+		return nil, err
 	}
 
-	// Validate signature.
-	pubKey, ok := sealerCert.PublicKey.(*rsa.PublicKey)
-	if !ok {
-		return nil, errors.New("public key was not an rsa key")
+	if !o.allowsSignatureAlgorithm(m.alg) {
+		return nil, ErrUnsupportedSignatureAlgorithm
+	}
+
+	if len(m.certs) == 0 {
+		return nil, ErrUnableToParseSealerCert
+	}
+
+	sealerCert, err := x509.ParseCertificate(m.certs[0])
+	if err != nil {
+		return nil, ErrUnableToParseSealerCert
 	}
 
-	h := sha256.New()
-	if _, err := h.Write([]byte(message.Header.Created)); err != nil {
+	intermediates, err := sealerChain(m.certs[1:])
+	if err != nil {
 		return nil, err
 	}
-	if _, err := h.Write([]byte(message.Header.Expires)); err != nil {
+
+	chain, err := o.verifySealer(sealerCert, intermediates, nil)
+	if err != nil {
 		return nil, err
 	}
-	if _, err := h.Write(plaintext); err != nil {
+
+	if err := verifyStandard(m.alg, sealerCert.PublicKey, m.signingInput, m.signature); err != nil {
 		return nil, err
 	}
 
-	if err := rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, h.Sum(nil), message.Header.Signature); err != nil {
-		return nil, ErrInvalidSignature
+	if !o.signedFor(m.receivers) {
+		return nil, ErrNotRecipient
+	}
+
+	if err := o.checkReplay(sealerCert, m.messageID, acceptUntil); err != nil {
+		return nil, err
+	}
+
+	return &OpenInfo{
+		SealerCert: sealerCert,
+		Chain:      chain,
+		MessageID:  m.messageID,
+		Claims:     m.claims,
+		Created:    m.created,
+		Expires:    m.expires,
+	}, nil
+}
+
+// maxSealerChainLength limits the number of intermediate certificates accepted with a message.
+const maxSealerChainLength = 8
+
+// sealerChain parses the intermediate certificates sent with a message into a pool used to build paths from the
+// sealer certificate to the roots of the Opener. Intermediates are never trusted on their own.
+func sealerChain(certs [][]byte) (*x509.CertPool, error) {
+	if len(certs) > maxSealerChainLength {
+		return nil, ErrUntrustedCert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, b := range certs {
+		cert, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, ErrUnableToParseSealerCert
+		}
+
+		intermediates.AddCert(cert)
+	}
+
+	return intermediates, nil
+}
+
+// parseTimestamps returns the Created and Expires times of a message.
+func parseTimestamps(header *Header) (time.Time, time.Time, error) {
+	layout := timestampLayout(header.Version)
+	created, err := time.Parse(layout, header.Created)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	expires, err := time.Parse(layout, header.Expires)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if expires.Before(created) {
+		return time.Time{}, time.Time{}, errors.New("message expires before it is created")
+	}
+
+	return created, expires, nil
+}
+
+// acceptUntil returns the time until which the Opener accepts a message with the given timestamps, taking
+// MaxTimeToLive and ClockSkew into account.
+func (o *Opener) acceptUntil(created, expires time.Time) (time.Time, error) {
+	if o.MaxTimeToLive > 0 && expires.Sub(created) > o.MaxTimeToLive {
+		expires = created.Add(o.MaxTimeToLive)
+	}
+
+	t := now()
+	if created.After(t.Add(o.ClockSkew)) {
+		return time.Time{}, ErrMessageNotYetValid
+	}
+
+	expires = expires.Add(o.ClockSkew)
+	if t.After(expires) {
+		return time.Time{}, ErrMessageExpired
+	}
+
+	return expires, nil
+}
+
+// timestampLayout returns the layout of Created and Expires for a format version. Messages sealed before
+// versionNanoTimestamps are truncated to whole seconds.
+func timestampLayout(version int) string {
+	if version < versionNanoTimestamps {
+		return time.RFC3339
 	}
 
-	return plaintext, nil
+	return time.RFC3339Nano
 }
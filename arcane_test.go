@@ -1,6 +1,7 @@
 package arcane
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -20,31 +21,57 @@ var (
 	signedPk2    = parsePrivateKey("test/data/signed2.key")
 	signedPk3    = parsePrivateKey("test/data/signed3.key")
 	selfSignedPk = parsePrivateKey("test/data/selfSigned.key")
+	ecdsaPk1     = parsePKCS8PrivateKey("test/data/ecdsa1.key")
+	ed25519Pk    = parsePKCS8PrivateKey("test/data/ed25519.key")
+	ca2Pk        = parsePrivateKey("test/data/ca2.key")
+	signedPk4    = parsePrivateKey("test/data/signed4.key")
+	revokedPk1   = parsePrivateKey("test/data/revoked1.key")
+	signedPk5    = parsePrivateKey("test/data/signed5.key")
 
 	caCert         = parseCert("test/data/ca.crt")
 	signedCert1    = parseCert("test/data/signed1.crt")
 	signedCert2    = parseCert("test/data/signed2.crt")
 	signedCert3    = parseCert("test/data/signed3.crt")
 	selfSignedCert = parseCert("test/data/selfSigned.crt")
+	ecdsaCert1     = parseCert("test/data/ecdsa1.crt")
+	ed25519Cert    = parseCert("test/data/ed25519.crt")
+	ca2Cert        = parseCert("test/data/ca2.crt")
+	signedCert4    = parseCert("test/data/signed4.crt")
+	revokedCert1   = parseCert("test/data/revoked1.crt")
+	intermediate1  = parseCert("test/data/intermediate1.crt") // Issued by ca2.
+	signedCert5    = parseCert("test/data/signed5.crt")       // Issued by intermediate1.
 
 	emptyCertPool *x509.CertPool // No certificates in pool.
 	caCertPool    *x509.CertPool // Only ca certificate in pool.
 	leafCertPool  *x509.CertPool // Pool with leaf certs. Including self signed certificate.
+	ca2CertPool   *x509.CertPool // Only ca2 certificate in pool. The ca2 CRL revokes revoked1.
+
+	// Test certificates are only valid for a limited period, so tests seal messages at a fixed time.
+	sealTime = time.Date(2020, 11, 26, 18, 37, 56, 0, time.FixedZone("", 60*60))
 )
 
 func init() {
 	emptyCertPool = x509.NewCertPool()
 	caCertPool = x509.NewCertPool()
 	leafCertPool = x509.NewCertPool()
+	ca2CertPool = x509.NewCertPool()
 
 	caCertPool.AddCert(caCert)
 	leafCertPool.AddCert(signedCert1)
 	leafCertPool.AddCert(signedCert2)
 	leafCertPool.AddCert(signedCert3)
 	leafCertPool.AddCert(selfSignedCert)
+	ca2CertPool.AddCert(ca2Cert)
 }
 
 func TestSealerAndOpener(t *testing.T) {
+	// Test certificates are only valid for a limited period.
+	now = func() time.Time {
+		n, err := time.Parse(time.RFC3339, "2020-11-26T18:37:56+01:00")
+		assert.NoError(t, err)
+		return n
+	}
+
 	systemCertPool, err := x509.SystemCertPool()
 	assert.NoError(t, err)
 
@@ -59,101 +86,143 @@ func TestSealerAndOpener(t *testing.T) {
 	}{
 		{
 			name:        "Simple test",
-			sealer:      &Sealer{0, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Simple test 1sec TTL",
-			sealer:      &Sealer{1 * time.Second, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{TimeToLive: 1 * time.Second, PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Simple test 30sec TTL",
-			sealer:      &Sealer{30 * time.Second, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{TimeToLive: 30 * time.Second, PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Simple test 1min TTL",
-			sealer:      &Sealer{1 * time.Minute, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{TimeToLive: 1 * time.Minute, PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Simple test 2min TTL",
-			sealer:      &Sealer{2 * time.Minute, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{TimeToLive: 2 * time.Minute, PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Simple test 7min TTL",
-			sealer:      &Sealer{7 * time.Minute, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{TimeToLive: 7 * time.Minute, PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Simple test 10min TTL",
-			sealer:      &Sealer{10 * time.Minute, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{TimeToLive: 10 * time.Minute, PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			payload:     []byte("This is a test payload."),
+			expectedErr: nil,
+		},
+		{
+			name:        "PSS signature",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}, SignatureAlgorithm: PS256},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Empty cert pool",
-			sealer:      &Sealer{0, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, emptyCertPool},
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: emptyCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: ErrUntrustedCert,
 		},
 		{
 			name:        "With self signed fail",
-			sealer:      &Sealer{0, selfSignedPk, selfSignedCert, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{PrivateKey: selfSignedPk, Cert: selfSignedCert, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: ErrUntrustedCert,
 		},
 		{
 			name:        "With self signed success",
-			sealer:      &Sealer{0, selfSignedPk, selfSignedCert, signedCert2},
-			opener:      &Opener{signedPk2, leafCertPool},
+			sealer:      &Sealer{PrivateKey: selfSignedPk, Cert: selfSignedCert, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: leafCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Same sender and receiver",
-			sealer:      &Sealer{0, signedPk1, signedCert1, signedCert1},
-			opener:      &Opener{signedPk1, caCertPool},
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert1}},
+			opener:      &Opener{PrivateKey: signedPk1, Cert: signedCert1, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Empty payload",
-			sealer:      &Sealer{0, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     nil,
 			expectedErr: nil,
 		},
 		{
 			name:        "Long payload",
-			sealer:      &Sealer{0, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk2, caCertPool},
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("Lorem ipsum dolor sit amet, consectetur adipiscing elit. Praesent libero arcu, tempus et nunc nec, rhoncus scelerisque ligula. Suspendisse convallis commodo porttitor. Donec auctor ornare nibh vel luctus. Nullam id augue vel sapien placerat porta vitae ut ante. In dictum, dui a placerat viverra, nunc nunc elementum nulla, sed feugiat eros quam sagittis sapien. Quisque dictum commodo est, a lobortis lorem aliquam ut. Integer quis mi pharetra, hendrerit risus non, ullamcorper magna. Vivamus suscipit, massa sit amet mattis vulputate, nulla augue lobortis lorem, nec gravida justo ante in nisl. Etiam a efficitur ipsum, at imperdiet nulla. Curabitur condimentum bibendum dui, vel commodo massa lobortis pharetra. Nulla quis dui ut lectus congue finibus. Suspendisse rhoncus cursus velit eu vulputate. Aenean gravida lorem id lobortis faucibus. Curabitur commodo magna ipsum, non aliquet diam commodo eget. Phasellus vitae arcu nisi. In sed nulla eu massa dictum porta id sit amet turpis. Nam bibendum scelerisque vulputate. Morbi a tincidunt tellus, ut ultrices sapien. Nullam convallis vehicula fermentum. Nulla facilisi. Vestibulum auctor nunc nec vestibulum elementum. Nulla nisl leo, laoreet a mattis nec, tempor ac enim. Suspendisse porttitor augue nisl, ut aliquam velit lacinia quis. Etiam eu ultrices leo. Pellentesque nec elit ut massa iaculis sagittis eget nec orci. Aenean egestas finibus nunc, a dapibus diam egestas vel. Morbi a porttitor turpis. Donec efficitur lorem ut ipsum imperdiet luctus. Nullam bibendum feugiat nisl, ac ullamcorper lorem. Nulla sollicitudin dictum tellus, a ultricies tellus consequat a. Etiam fermentum, arcu non semper placerat, mauris ex vulputate nibh, id pellentesque augue ipsum ut felis. Mauris et ex eu est cursus fringilla. Duis neque magna, consequat a volutpat et, tincidunt quis nisi. Suspendisse maximus rhoncus feugiat. Sed eget libero vel eros ultrices aliquet ac sed arcu. Sed ac tortor vehicula, eleifend leo eu, tristique est. Fusce magna libero, gravida et ligula at, placerat congue mauris. Nulla ut leo posuere, gravida sapien sed, posuere ante. Aliquam quis interdum nunc. Integer quis imperdiet dolor. Aliquam lorem nisl, cursus sit amet porta ut, tempus vel eros. Suspendisse hendrerit, purus ut interdum pharetra, nibh mauris ullamcorper sapien, at ornare odio sapien nec nunc. Nullam sed eleifend ex. Aliquam dolor justo, hendrerit sed libero in, fringilla scelerisque nunc. Maecenas non ante auctor orci varius tincidunt. Donec eu sagittis diam, a imperdiet ligula. Etiam tempor feugiat ex, eget porttitor nulla dapibus sit amet. Donec imperdiet lectus vel tellus molestie, ac mattis nunc sodales. Cras vel consectetur sapien. Suspendisse non velit id risus cursus congue. Morbi tristique, libero at tempus lobortis, velit orci pharetra lacus, ut auctor neque enim id tortor. Curabitur scelerisque id elit eu gravida. Suspendisse sodales, nunc eu dapibus sodales, urna tortor eleifend metus, eget posuere dui turpis non lacus. Vestibulum elementum dolor diam, non tempor lacus aliquam nec. Nullam rhoncus neque sem. Sed eget rhoncus ante, id lacinia nunc. Vivamus aliquam ultricies libero consectetur ultricies. Aenean pellentesque ut nisi at sagittis. Quisque feugiat tortor fermentum sapien suscipit, at tincidunt sem dignissim. Curabitur vitae dolor odio. Fusce cursus ipsum ut congue vehicula. Etiam tempus, eros id blandit posuere, mi erat tincidunt lectus, at pellentesque est turpis non odio. Fusce et dapibus urna. Fusce rutrum bibendum ligula, a mattis nulla pretium eu. Sed id neque posuere, vulputate nulla id, vehicula erat. Suspendisse varius a turpis et pharetra. Nunc non lectus at ligula rutrum varius sit amet a dui. Vestibulum porttitor enim congue posuere imperdiet. Fusce sit amet tortor at purus hendrerit auctor non ut est. Sed convallis elit id malesuada luctus. Maecenas tellus nulla, hendrerit et nunc eget, consectetur tincidunt quam. Aliquam sagittis mi pretium metus fermentum tempor quis sed justo. Duis sit amet nibh eleifend, aliquet mi a, varius urna. Morbi porttitor libero a ullamcorper elementum. Maecenas auctor magna in nulla luctus malesuada. Mauris risus felis, laoreet sit amet placerat vitae, porttitor at est. Nulla dolor nisi, vestibulum sit amet scelerisque sit amet, laoreet vel enim. Vivamus posuere quis tortor id eleifend. Cras eu eros ex. Nullam fringilla efficitur faucibus. Donec urna massa, fermentum et odio ut, congue facilisis tortor. Proin sem felis, porttitor eu nunc at, condimentum vulputate magna. Aliquam egestas sem ex, id tempor ligula sollicitudin eget. Sed in nisi ut lorem pulvinar commodo vel non sapien. Fusce eu hendrerit ligula. Phasellus est nibh, fermentum quis vulputate sit amet, molestie id nunc. Integer mattis ultrices orci vitae mattis. Integer in sodales ex. Vestibulum varius tincidunt lorem, sit amet dictum est ultrices non. Vestibulum dignissim accumsan lobortis. Nulla facilisi. Aliquam dignissim mollis varius. Vestibulum eget turpis eget nulla hendrerit faucibus at sit amet libero. Etiam a porttitor diam, faucibus tincidunt ex. Pellentesque eget sodales enim. Sed vitae nunc lacinia, viverra urna et, finibus leo. Vestibulum eget dui sed magna posuere fringilla quis sit amet velit. Aliquam vitae arcu ac lacus posuere volutpat non aliquet ipsum. Maecenas sed consectetur lacus. Nullam sodales maximus metus. Donec sed porta ipsum. Praesent suscipit eros quis ante facilisis aliquam. Integer turpis neque, fermentum vel tellus quis, commodo fringilla ipsum. Nullam viverra semper facilisis. Donec volutpat, ipsum in varius scelerisque, metus nisi fringilla ex, non iaculis dolor velit in felis. Mauris quis vehicula nunc. Vestibulum venenatis scelerisque risus ac pulvinar. Nunc quis purus nisl. Maecenas volutpat id turpis a ornare. Morbi sed suscipit diam. Duis blandit euismod tortor, sed sollicitudin mauris condimentum sed. Suspendisse blandit nunc a lacus aliquam, eget blandit leo viverra. Phasellus dictum sed tellus id sagittis. Quisque ante sem, volutpat sodales suscipit ut, faucibus eu diam. Nullam eu dapibus justo. Curabitur ultrices finibus lectus, sit amet lacinia quam facilisis eu. Duis faucibus est non ligula maximus blandit. Phasellus vestibulum urna ligula, quis faucibus lacus efficitur et. Sed vel accumsan ante. Quisque placerat ante eget lacinia consequat. Nullam efficitur scelerisque mauris, nec aliquet leo ornare tempus. Mauris sagittis quam neque, in rhoncus lectus varius id. Donec eget varius eros. Duis quis est mattis, imperdiet lectus vitae, accumsan eros. Donec a sem ipsum. Donec venenatis tortor elit, sed efficitur mi scelerisque at. Donec imperdiet congue vulputate. In mollis nisi eget magna vehicula, id tempor justo luctus. Praesent dictum nisi velit, et vestibulum quam mollis at. Integer scelerisque enim eleifend turpis sodales, quis semper mauris cursus. Suspendisse pharetra odio sit amet augue sodales, eu convallis quam faucibus. Fusce hendrerit molestie lacus sit amet tempus. In eu ipsum non nisl sollicitudin maximus quis ac nulla. Mauris vel neque eget mi ultricies cursus."),
 			expectedErr: nil,
 		},
 		{
 			name:        "Wrong opener", // Trying to open a message addressed to someone else.
-			sealer:      &Sealer{0, signedPk1, signedCert1, signedCert2},
-			opener:      &Opener{signedPk3, caCertPool},
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+			payload:     []byte("This is a test payload."),
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Opener without certificate",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, CertPool: caCertPool},
+			payload:     []byte("This is a test payload."),
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Multiple receivers first",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, signedCert3}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
 			payload:     []byte("This is a test payload."),
-			expectedErr: ErrUnableToGetEncryptionKey,
+			expectedErr: nil,
+		},
+		{
+			name:        "Multiple receivers second",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, signedCert3}},
+			opener:      &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+			payload:     []byte("This is a test payload."),
+			expectedErr: nil,
+		},
+		{
+			name:        "Multiple receivers not addressed",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, signedCert3}},
+			opener:      &Opener{PrivateKey: signedPk1, Cert: signedCert1, CertPool: caCertPool},
+			payload:     []byte("This is a test payload."),
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Receiver identified by subject key id",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, caCert}},
+			opener:      &Opener{PrivateKey: caPk, Cert: caCert, CertPool: caCertPool},
+			payload:     []byte("This is a test payload."),
+			expectedErr: nil,
 		},
 	}
 
@@ -173,6 +242,241 @@ func TestSealerAndOpener(t *testing.T) {
 	}
 }
 
+func TestOpener_OpenTimestamps(t *testing.T) {
+	sealed := sealTime
+
+	tests := []struct {
+		name          string
+		openedAfter   time.Duration
+		timeToLive    time.Duration
+		clockSkew     time.Duration
+		maxTimeToLive time.Duration
+		expectedErr   error
+	}{
+		{
+			name:        "Within time to live",
+			openedAfter: 4 * time.Minute,
+			expectedErr: nil,
+		},
+		{
+			name:        "Expired",
+			openedAfter: 6 * time.Minute,
+			expectedErr: ErrMessageExpired,
+		},
+		{
+			name:        "Expired within clock skew",
+			openedAfter: 6 * time.Minute,
+			clockSkew:   2 * time.Minute,
+			expectedErr: nil,
+		},
+		{
+			name:        "Expired beyond clock skew",
+			openedAfter: 8 * time.Minute,
+			clockSkew:   2 * time.Minute,
+			expectedErr: ErrMessageExpired,
+		},
+		{
+			name:        "Created in the future",
+			openedAfter: -time.Second,
+			expectedErr: ErrMessageNotYetValid,
+		},
+		{
+			name:        "Created in the future within clock skew",
+			openedAfter: -time.Minute,
+			clockSkew:   2 * time.Minute,
+			expectedErr: nil,
+		},
+		{
+			name:        "Created in the future beyond clock skew",
+			openedAfter: -3 * time.Minute,
+			clockSkew:   2 * time.Minute,
+			expectedErr: ErrMessageNotYetValid,
+		},
+		{
+			name:          "Within max time to live",
+			openedAfter:   50 * time.Minute,
+			timeToLive:    24 * time.Hour,
+			maxTimeToLive: time.Hour,
+			expectedErr:   nil,
+		},
+		{
+			name:          "Beyond max time to live",
+			openedAfter:   70 * time.Minute,
+			timeToLive:    24 * time.Hour,
+			maxTimeToLive: time.Hour,
+			expectedErr:   ErrMessageExpired,
+		},
+		{
+			name:          "Beyond max time to live within clock skew",
+			openedAfter:   61 * time.Minute,
+			timeToLive:    24 * time.Hour,
+			clockSkew:     2 * time.Minute,
+			maxTimeToLive: time.Hour,
+			expectedErr:   nil,
+		},
+		{
+			name:          "Time to live shorter than max",
+			openedAfter:   6 * time.Minute,
+			maxTimeToLive: time.Hour,
+			expectedErr:   ErrMessageExpired,
+		},
+	}
+
+	for _, test := range tests {
+		setNow(t, sealed)
+		sealer := &Sealer{TimeToLive: test.timeToLive, PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+
+		setNow(t, sealed.Add(test.openedAfter))
+		opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ClockSkew: test.clockSkew, MaxTimeToLive: test.maxTimeToLive}
+		payload, err := opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr == nil {
+			assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+		}
+	}
+
+	// Messages expiring before they are created are rejected.
+	_, _, err := parseTimestamps(&Header{Created: "2020-11-26T18:37:56+01:00", Expires: "2020-11-26T18:37:55+01:00"})
+	assert.Error(t, err)
+}
+
+func TestSealer_SealNanoTimestamps(t *testing.T) {
+	sealed, err := time.Parse(time.RFC3339Nano, "2020-11-26T18:37:56.123456789+01:00")
+	assert.NoError(t, err)
+	setNow(t, sealed)
+
+	sealer := &Sealer{TimeToLive: 1500 * time.Millisecond, PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	assert.Equal(t, "2020-11-26T18:37:56.123456789+01:00", message.Header.Created)
+	assert.Equal(t, "2020-11-26T18:37:57.623456789+01:00", message.Header.Expires)
+
+	setNow(t, sealed.Add(1499*time.Millisecond))
+	_, err = opener.Open(message)
+	assert.NoError(t, err)
+
+	setNow(t, sealed.Add(1501*time.Millisecond))
+	_, err = opener.Open(message)
+	assert.Equal(t, ErrMessageExpired, err)
+
+	// Timestamps of messages sealed before versionNanoTimestamps are whole seconds.
+	assert.Equal(t, time.RFC3339, timestampLayout(versionMessageID))
+	created, expires, err := parseTimestamps(&Header{Version: versionMessageID, Created: "2020-11-26T18:37:56+01:00", Expires: "2020-11-26T18:42:56+01:00"})
+	assert.NoError(t, err)
+	setNow(t, sealed)
+	_, err = opener.acceptUntil(created, expires)
+	assert.NoError(t, err)
+}
+
+func TestOpener_OpenSealerChain(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name        string
+		sealer      *Sealer
+		opener      *Opener
+		tamper      func(header *Header)
+		expectedErr error
+	}{
+		{
+			name:        "Intermediate sent",
+			sealer:      &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			expectedErr: nil,
+		},
+		{
+			name:        "Intermediate not sent",
+			sealer:      &Sealer{PrivateKey: signedPk5, Cert: signedCert5, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			expectedErr: ErrUntrustedCert,
+		},
+		{
+			name:        "Root sent but not trusted",
+			sealer:      &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1, ca2Cert}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			expectedErr: ErrUntrustedCert,
+		},
+		{
+			name:        "Root sent and trusted",
+			sealer:      &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1, ca2Cert}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			expectedErr: nil,
+		},
+		{
+			name:        "Intermediate not parsable",
+			sealer:      &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			tamper:      func(header *Header) { header.SealerChain[0] = header.SealerChain[0][1:] },
+			expectedErr: ErrUnableToParseSealerCert,
+		},
+		{
+			name:   "Chain too long",
+			sealer: &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			tamper: func(header *Header) {
+				for len(header.SealerChain) <= maxSealerChainLength {
+					header.SealerChain = append(header.SealerChain, intermediate1.Raw)
+				}
+			},
+			expectedErr: ErrUntrustedCert,
+		},
+	}
+
+	for _, test := range tests {
+		message, err := test.sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+		assert.Len(t, message.Header.SealerChain, len(test.sealer.Chain))
+
+		if test.tamper != nil {
+			test.tamper(&message.Header)
+		}
+
+		payload, err := test.opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr == nil {
+			assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+		}
+	}
+}
+
+func TestOpener_OpenWithInfo(t *testing.T) {
+	sealed, err := time.Parse(time.RFC3339, "2020-11-26T18:37:56.5+01:00")
+	assert.NoError(t, err)
+	setNow(t, sealed)
+
+	sealer := &Sealer{TimeToLive: time.Minute, PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool, ClockSkew: time.Minute}
+
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+
+	setNow(t, sealed.Add(90*time.Second))
+	payload, info, err := opener.OpenWithInfo(message)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("This is a test payload."), payload)
+
+	assert.Equal(t, signedCert5.Raw, info.SealerCert.Raw)
+	assert.Len(t, info.Chain, 3)
+	assert.Equal(t, signedCert5.Raw, info.Chain[0].Raw)
+	assert.Equal(t, intermediate1.Raw, info.Chain[1].Raw)
+	assert.Equal(t, ca2Cert.Raw, info.Chain[2].Raw)
+	assert.Equal(t, message.Header.MessageID, info.MessageID)
+	assert.Equal(t, SuiteRSA, info.Suite)
+	assert.True(t, sealed.Equal(info.Created))
+	assert.True(t, sealed.Add(time.Minute).Equal(info.Expires))
+
+	// No info is returned for messages that fail to open.
+	message.Header.Signature[0] ^= 1
+	payload, info, err = opener.OpenWithInfo(message)
+	assert.Equal(t, ErrInvalidSignature, err)
+	assert.Nil(t, payload)
+	assert.Nil(t, info)
+}
+
 func TestOpener_Open(t *testing.T) {
 	now = func() time.Time {
 		n, err := time.Parse(time.RFC3339, "2020-11-26T18:37:56+01:00")
@@ -188,7 +492,7 @@ func TestOpener_Open(t *testing.T) {
 	}{
 		{
 			name:   "Test Ok",
-			opener: &Opener{signedPk2, caCertPool},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true},
 			message: &Envelope{
 				Header: Header{
 					SealerCert:   base64Decode("MIIEWDCCAkCgAwIBAgIBZTANBgkqhkiG9w0BAQsFADBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wHhcNMjAxMDMxMjAxNDM4WhcNMjMxMDMxMjAxNDM4WjBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDL75yIXDMATDviotxLwXz80MSrUcqH0OrfK3G3hl5wHrJ8x1PCP/TRTo6PYcUWDyrC5wDPUrFoZ2whyB+4SDkB7CKd/g8CTZeUyNE0wYOjzvgoUeeLa57wBj69cXcYEAndCuxNVJI1fbN+t7YmhHnd6jFIo+/X2gKIq6PwxkPIGrgQzb8H68OkDacw6R6eayYRG1p6R5+sV0qa83RyJBxRg2eflg2KwIcmd4dHO05uSs2t4XZq9AapBa4p7QZ0LSYTxTlGX1Me9t6nnS8zLymGxNFv5iXGxlDSBnnn75nFewm15AVyUz1WCe58V91yc5pqRvRc90wTA3ODmV2ntI9bAgMBAAGjMTAvMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUEFjAUBggrBgEFBQcDAgYIKwYBBQUHAwEwDQYJKoZIhvcNAQELBQADggIBAHXvqPebyIgkn5XJ121rt0HdXK/I/wJhaIy6tMl2ZTtCcmd5nbEdXrUfKgmv4bWHwqIUzcis4iNoWOWNioxiT1M6aUKdMR7DyugoBofBulWMyhW3qYStiHXIEyaYQvkBHgkzA9CgoKNNXkw3cEvFi8komcGS0QIDfcIERr+zwKpqiNxKVPthdNY6qFgDHj5e5whdPEGpDI1DVmoLB0aMMpYeBspq3zkotgqHCpy0xAxZBA5gwUvAtNPPDJJAZz5o0AedBuxNWHIyXreDPqr008iG/ZKM3QI9IH3b4BrgkIm3sNGiG+dIcyrBzEqdn9e6xtjz7QRLHRoyb0SKZsb/2ulgdzWNpP1rUMwwzYE4XdRCNbhAGxw3o8SwmCmD5VbdrWGY7afRxEmFDCZTAwyFcxdop2rMpsaZD89/gmqihOVlDwAwOw/5J8ljpePUDocMSZuxcNqqVhSM/lbnUdpla/lBpa2fa/RkZ9ri0Z8/nlLci2CHxCz0ALpf/blNOGF33GsNXmTEuFmg2/ikRhIcF4sX2YQCH5AOnBuaTe/6NqBwECbhP9/fdsF9a/AAmPe3YHvsP6lvWrZPCOwg5BX6sTxjPW/apgvuDcHL1noWaiNB126b6i3b5ohoTIveAApoe6t3QDePry3HllRLe2ux5CqdorX0A7gYpn3+Ht7GwZVD"),
@@ -201,9 +505,24 @@ func TestOpener_Open(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			name:   "PKCS1v15 not allowed",
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message: &Envelope{
+				Header: Header{
+					SealerCert:   base64Decode("MIIEWDCCAkCgAwIBAgIBZTANBgkqhkiG9w0BAQsFADBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wHhcNMjAxMDMxMjAxNDM4WhcNMjMxMDMxMjAxNDM4WjBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDL75yIXDMATDviotxLwXz80MSrUcqH0OrfK3G3hl5wHrJ8x1PCP/TRTo6PYcUWDyrC5wDPUrFoZ2whyB+4SDkB7CKd/g8CTZeUyNE0wYOjzvgoUeeLa57wBj69cXcYEAndCuxNVJI1fbN+t7YmhHnd6jFIo+/X2gKIq6PwxkPIGrgQzb8H68OkDacw6R6eayYRG1p6R5+sV0qa83RyJBxRg2eflg2KwIcmd4dHO05uSs2t4XZq9AapBa4p7QZ0LSYTxTlGX1Me9t6nnS8zLymGxNFv5iXGxlDSBnnn75nFewm15AVyUz1WCe58V91yc5pqRvRc90wTA3ODmV2ntI9bAgMBAAGjMTAvMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUEFjAUBggrBgEFBQcDAgYIKwYBBQUHAwEwDQYJKoZIhvcNAQELBQADggIBAHXvqPebyIgkn5XJ121rt0HdXK/I/wJhaIy6tMl2ZTtCcmd5nbEdXrUfKgmv4bWHwqIUzcis4iNoWOWNioxiT1M6aUKdMR7DyugoBofBulWMyhW3qYStiHXIEyaYQvkBHgkzA9CgoKNNXkw3cEvFi8komcGS0QIDfcIERr+zwKpqiNxKVPthdNY6qFgDHj5e5whdPEGpDI1DVmoLB0aMMpYeBspq3zkotgqHCpy0xAxZBA5gwUvAtNPPDJJAZz5o0AedBuxNWHIyXreDPqr008iG/ZKM3QI9IH3b4BrgkIm3sNGiG+dIcyrBzEqdn9e6xtjz7QRLHRoyb0SKZsb/2ulgdzWNpP1rUMwwzYE4XdRCNbhAGxw3o8SwmCmD5VbdrWGY7afRxEmFDCZTAwyFcxdop2rMpsaZD89/gmqihOVlDwAwOw/5J8ljpePUDocMSZuxcNqqVhSM/lbnUdpla/lBpa2fa/RkZ9ri0Z8/nlLci2CHxCz0ALpf/blNOGF33GsNXmTEuFmg2/ikRhIcF4sX2YQCH5AOnBuaTe/6NqBwECbhP9/fdsF9a/AAmPe3YHvsP6lvWrZPCOwg5BX6sTxjPW/apgvuDcHL1noWaiNB126b6i3b5ohoTIveAApoe6t3QDePry3HllRLe2ux5CqdorX0A7gYpn3+Ht7GwZVD"),
+					Signature:    base64Decode("T6ZACEUlFLs0Ph7aHMrS8dgfcv8NP7X/+tP0bhr5AYoANmSOjeeLGAgLsRX+39ulem7HdnmQe8/JDjUng5xnOjojz9Sm4xn54VnpIOYUWlCMzbK7XAqVHREjEOw5LvgDpePJ3NZRHpTSfGeHj3wXqH9JH3vGzxd8DZjCqgB2+A3AKt/8x/qs54o0fW1AS96/w3a9EpcOwxRhPjNThL9KVsezreMD3/xtykVu6tsOGGuOeYwW7pnUBewW+85jaDkIAHsONmklgXGk1i6BUhsXJdM2q/qTJgpLJdaFJ6H3++YvM2I9946jnCv656wjWVp6svqYxDqN3jaq4jHg7XumrQ=="),
+					EncryptedKey: base64Decode("QWoRQFGjzgiCLZyd01n9+zWgele49cdSYCzyABGnhaqo6XHV+z4pV2fluqVPYwNG79ShnvJSAJi6kq7cN0a+CXs7PSankWWtoHzNZVKfSGV6kPZsN/f95YXlXN7CtC34WvbyvRCeYhgiRB9LjVKIAN568tFwgdnhKLCn+uYxg2pRlXdKpYQIBjepVC+x6ub2mBk3BAjWaPfs7g7ZX8CvoAMsUPhz6cYhYJU4CiprO9mq4/JwLHDwYsRKubsMBTh7dTsFvrcmtxUtmScp3IVCwkXOCG+JAiHKzSJpjcMh10MoNs/DZSBtYDjYMydsfrIaCj7QpdsHq8SrYgRsV6NMbw=="),
+					Created:      "2020-11-26T18:37:56+01:00",
+					Expires:      "2020-11-26T18:42:56+01:00",
+				},
+				Payload: base64Decode("4EeszCLhFjgpVVyXahSEXrUD/4hVMOq4u8XqsMkjuIQIm7zArID5b0386w=="),
+			},
+			expectedErr: &UnsupportedVersionError{Version: versionLegacy},
+		},
 		{
 			name:   "Payload tampered",
-			opener: &Opener{signedPk2, caCertPool},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true},
 			message: &Envelope{
 				Header: Header{
 					SealerCert:   base64Decode("MIIEWDCCAkCgAwIBAgIBZTANBgkqhkiG9w0BAQsFADBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wHhcNMjAxMDMxMjAxNDM4WhcNMjMxMDMxMjAxNDM4WjBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDL75yIXDMATDviotxLwXz80MSrUcqH0OrfK3G3hl5wHrJ8x1PCP/TRTo6PYcUWDyrC5wDPUrFoZ2whyB+4SDkB7CKd/g8CTZeUyNE0wYOjzvgoUeeLa57wBj69cXcYEAndCuxNVJI1fbN+t7YmhHnd6jFIo+/X2gKIq6PwxkPIGrgQzb8H68OkDacw6R6eayYRG1p6R5+sV0qa83RyJBxRg2eflg2KwIcmd4dHO05uSs2t4XZq9AapBa4p7QZ0LSYTxTlGX1Me9t6nnS8zLymGxNFv5iXGxlDSBnnn75nFewm15AVyUz1WCe58V91yc5pqRvRc90wTA3ODmV2ntI9bAgMBAAGjMTAvMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUEFjAUBggrBgEFBQcDAgYIKwYBBQUHAwEwDQYJKoZIhvcNAQELBQADggIBAHXvqPebyIgkn5XJ121rt0HdXK/I/wJhaIy6tMl2ZTtCcmd5nbEdXrUfKgmv4bWHwqIUzcis4iNoWOWNioxiT1M6aUKdMR7DyugoBofBulWMyhW3qYStiHXIEyaYQvkBHgkzA9CgoKNNXkw3cEvFi8komcGS0QIDfcIERr+zwKpqiNxKVPthdNY6qFgDHj5e5whdPEGpDI1DVmoLB0aMMpYeBspq3zkotgqHCpy0xAxZBA5gwUvAtNPPDJJAZz5o0AedBuxNWHIyXreDPqr008iG/ZKM3QI9IH3b4BrgkIm3sNGiG+dIcyrBzEqdn9e6xtjz7QRLHRoyb0SKZsb/2ulgdzWNpP1rUMwwzYE4XdRCNbhAGxw3o8SwmCmD5VbdrWGY7afRxEmFDCZTAwyFcxdop2rMpsaZD89/gmqihOVlDwAwOw/5J8ljpePUDocMSZuxcNqqVhSM/lbnUdpla/lBpa2fa/RkZ9ri0Z8/nlLci2CHxCz0ALpf/blNOGF33GsNXmTEuFmg2/ikRhIcF4sX2YQCH5AOnBuaTe/6NqBwECbhP9/fdsF9a/AAmPe3YHvsP6lvWrZPCOwg5BX6sTxjPW/apgvuDcHL1noWaiNB126b6i3b5ohoTIveAApoe6t3QDePry3HllRLe2ux5CqdorX0A7gYpn3+Ht7GwZVD"),
@@ -218,7 +537,7 @@ func TestOpener_Open(t *testing.T) {
 		},
 		{
 			name:   "Wrong encryptedKey",
-			opener: &Opener{signedPk2, caCertPool},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true},
 			message: &Envelope{
 				Header: Header{
 					SealerCert:   base64Decode("MIIEWDCCAkCgAwIBAgIBZTANBgkqhkiG9w0BAQsFADBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wHhcNMjAxMDMxMjAxNDM4WhcNMjMxMDMxMjAxNDM4WjBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDL75yIXDMATDviotxLwXz80MSrUcqH0OrfK3G3hl5wHrJ8x1PCP/TRTo6PYcUWDyrC5wDPUrFoZ2whyB+4SDkB7CKd/g8CTZeUyNE0wYOjzvgoUeeLa57wBj69cXcYEAndCuxNVJI1fbN+t7YmhHnd6jFIo+/X2gKIq6PwxkPIGrgQzb8H68OkDacw6R6eayYRG1p6R5+sV0qa83RyJBxRg2eflg2KwIcmd4dHO05uSs2t4XZq9AapBa4p7QZ0LSYTxTlGX1Me9t6nnS8zLymGxNFv5iXGxlDSBnnn75nFewm15AVyUz1WCe58V91yc5pqRvRc90wTA3ODmV2ntI9bAgMBAAGjMTAvMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUEFjAUBggrBgEFBQcDAgYIKwYBBQUHAwEwDQYJKoZIhvcNAQELBQADggIBAHXvqPebyIgkn5XJ121rt0HdXK/I/wJhaIy6tMl2ZTtCcmd5nbEdXrUfKgmv4bWHwqIUzcis4iNoWOWNioxiT1M6aUKdMR7DyugoBofBulWMyhW3qYStiHXIEyaYQvkBHgkzA9CgoKNNXkw3cEvFi8komcGS0QIDfcIERr+zwKpqiNxKVPthdNY6qFgDHj5e5whdPEGpDI1DVmoLB0aMMpYeBspq3zkotgqHCpy0xAxZBA5gwUvAtNPPDJJAZz5o0AedBuxNWHIyXreDPqr008iG/ZKM3QI9IH3b4BrgkIm3sNGiG+dIcyrBzEqdn9e6xtjz7QRLHRoyb0SKZsb/2ulgdzWNpP1rUMwwzYE4XdRCNbhAGxw3o8SwmCmD5VbdrWGY7afRxEmFDCZTAwyFcxdop2rMpsaZD89/gmqihOVlDwAwOw/5J8ljpePUDocMSZuxcNqqVhSM/lbnUdpla/lBpa2fa/RkZ9ri0Z8/nlLci2CHxCz0ALpf/blNOGF33GsNXmTEuFmg2/ikRhIcF4sX2YQCH5AOnBuaTe/6NqBwECbhP9/fdsF9a/AAmPe3YHvsP6lvWrZPCOwg5BX6sTxjPW/apgvuDcHL1noWaiNB126b6i3b5ohoTIveAApoe6t3QDePry3HllRLe2ux5CqdorX0A7gYpn3+Ht7GwZVD"),
@@ -233,7 +552,7 @@ func TestOpener_Open(t *testing.T) {
 		},
 		{
 			name:   "Wrong certificate",
-			opener: &Opener{signedPk2, caCertPool},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true},
 			message: &Envelope{
 				Header: Header{
 					SealerCert:   base64Decode("MIIEWDCCAkCgAwIBAgIBZzANBgkqhkiG9w0BAQsFADBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wHhcNMjAxMDMxMjAxNDQwWhcNMjMxMDMxMjAxNDQwWjBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDSexiD1ePwgQLuly172em8BqOP667NsGJ3++2MhxfazKLtx+cmmb4Zhq0jbify3KG+T2KRx2CaeSe+C3n1Ji99ilcM3kJfXozXXZ/6yzORrdP2GhhjFRIlBAtoKNwvAfwxIJk2inKkzojuNlnZd5HqvLmqUvJhV5AJHqefKPLXjh/R8Hqbw23v1KuVB0FV/qU1Lu4smtyn0TogCvGbs3hc0BkLKkA0KvLYnUXlUX5i6YFQd8KJnQicTuqEUV6W0cYM+8dt27TwqYLkn/a4Mgzs7TXOovYNtWTL1XItf/S+PWXu5KVbSYoPT/4kU6UAo9ebhm0kAHxbfTmHSOTsO5WXAgMBAAGjMTAvMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUEFjAUBggrBgEFBQcDAgYIKwYBBQUHAwEwDQYJKoZIhvcNAQELBQADggIBAJSBBJ9pgSK4imcs1ka7tFFImnJsdrh2D5zayyx4QHhqcvU3euyt7PgB7xfIS7eOmcp5rn/uy68gQBd2+lvGSL2r5crLcdgM9c1PSGkZJa0z4WrO+YKC44CBy+Ro5cl4uGRuOTi+zcVTSx8GpEuRXPIQqbrV8t4mAfn1sbYQHefOg87Zy7UYKixEdZqabRoUMVeWo2KWOvcyo6hlIlyRNr9tO1ZEQUP7w0PQJEC4uZD7++/BJoNGSCkOV25IJkpD1zgnjet4ACppCTowNpiHiRficyUVQ8jcdXD+Eklll8lfY25jkadhYzFwHheZoiJ3ntxvQ0bPJbzT09HtOAZ+2AupWhjRlD3FACygesTDkCHIvZpJA2vmJTRf1zfiODtM3wjAUnPK9NbbtOTsTVN/RovYPgdXmxMswbtx41LyVeD2coPzE8rd/Tk5DxRHfIN/tGcBoH+xbKm+/YlQU0bZEQ2X/GzvWMYgi3bo5BmPzWD1Rb6tzDA53Lf63gjVOdJx8YmXomYv6dNt6jPesuo8grQv0xkFI1BA18cyd5FDQJ+3vl7NGTdasfUN9UvVv+pw0XtYJX40PefWLVFkEbrP/8iEWuekB+Oo1R/tZK4dw4j5cTsjVwH7P6fYxQeqXjaz0/b9QM7aSgJGBfLwK1K8AdW+UYty/uch8MluheVhikIw"),
@@ -248,7 +567,7 @@ func TestOpener_Open(t *testing.T) {
 		},
 		{
 			name:   "Tampered timestamps",
-			opener: &Opener{signedPk2, caCertPool},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true},
 			message: &Envelope{
 				Header: Header{
 					SealerCert:   base64Decode("MIIEWDCCAkCgAwIBAgIBZTANBgkqhkiG9w0BAQsFADBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wHhcNMjAxMDMxMjAxNDM4WhcNMjMxMDMxMjAxNDM4WjBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDL75yIXDMATDviotxLwXz80MSrUcqH0OrfK3G3hl5wHrJ8x1PCP/TRTo6PYcUWDyrC5wDPUrFoZ2whyB+4SDkB7CKd/g8CTZeUyNE0wYOjzvgoUeeLa57wBj69cXcYEAndCuxNVJI1fbN+t7YmhHnd6jFIo+/X2gKIq6PwxkPIGrgQzb8H68OkDacw6R6eayYRG1p6R5+sV0qa83RyJBxRg2eflg2KwIcmd4dHO05uSs2t4XZq9AapBa4p7QZ0LSYTxTlGX1Me9t6nnS8zLymGxNFv5iXGxlDSBnnn75nFewm15AVyUz1WCe58V91yc5pqRvRc90wTA3ODmV2ntI9bAgMBAAGjMTAvMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUEFjAUBggrBgEFBQcDAgYIKwYBBQUHAwEwDQYJKoZIhvcNAQELBQADggIBAHXvqPebyIgkn5XJ121rt0HdXK/I/wJhaIy6tMl2ZTtCcmd5nbEdXrUfKgmv4bWHwqIUzcis4iNoWOWNioxiT1M6aUKdMR7DyugoBofBulWMyhW3qYStiHXIEyaYQvkBHgkzA9CgoKNNXkw3cEvFi8komcGS0QIDfcIERr+zwKpqiNxKVPthdNY6qFgDHj5e5whdPEGpDI1DVmoLB0aMMpYeBspq3zkotgqHCpy0xAxZBA5gwUvAtNPPDJJAZz5o0AedBuxNWHIyXreDPqr008iG/ZKM3QI9IH3b4BrgkIm3sNGiG+dIcyrBzEqdn9e6xtjz7QRLHRoyb0SKZsb/2ulgdzWNpP1rUMwwzYE4XdRCNbhAGxw3o8SwmCmD5VbdrWGY7afRxEmFDCZTAwyFcxdop2rMpsaZD89/gmqihOVlDwAwOw/5J8ljpePUDocMSZuxcNqqVhSM/lbnUdpla/lBpa2fa/RkZ9ri0Z8/nlLci2CHxCz0ALpf/blNOGF33GsNXmTEuFmg2/ikRhIcF4sX2YQCH5AOnBuaTe/6NqBwECbhP9/fdsF9a/AAmPe3YHvsP6lvWrZPCOwg5BX6sTxjPW/apgvuDcHL1noWaiNB126b6i3b5ohoTIveAApoe6t3QDePry3HllRLe2ux5CqdorX0A7gYpn3+Ht7GwZVD"),
@@ -263,7 +582,7 @@ func TestOpener_Open(t *testing.T) {
 		},
 		{
 			name:   "Message Expired",
-			opener: &Opener{signedPk2, caCertPool},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true},
 			message: &Envelope{
 				Header: Header{
 					SealerCert:   base64Decode("MIIEWDCCAkCgAwIBAgIBZTANBgkqhkiG9w0BAQsFADBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wHhcNMjAxMDMxMjAxNDM4WhcNMjMxMDMxMjAxNDM4WjBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDL75yIXDMATDviotxLwXz80MSrUcqH0OrfK3G3hl5wHrJ8x1PCP/TRTo6PYcUWDyrC5wDPUrFoZ2whyB+4SDkB7CKd/g8CTZeUyNE0wYOjzvgoUeeLa57wBj69cXcYEAndCuxNVJI1fbN+t7YmhHnd6jFIo+/X2gKIq6PwxkPIGrgQzb8H68OkDacw6R6eayYRG1p6R5+sV0qa83RyJBxRg2eflg2KwIcmd4dHO05uSs2t4XZq9AapBa4p7QZ0LSYTxTlGX1Me9t6nnS8zLymGxNFv5iXGxlDSBnnn75nFewm15AVyUz1WCe58V91yc5pqRvRc90wTA3ODmV2ntI9bAgMBAAGjMTAvMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUEFjAUBggrBgEFBQcDAgYIKwYBBQUHAwEwDQYJKoZIhvcNAQELBQADggIBAHXvqPebyIgkn5XJ121rt0HdXK/I/wJhaIy6tMl2ZTtCcmd5nbEdXrUfKgmv4bWHwqIUzcis4iNoWOWNioxiT1M6aUKdMR7DyugoBofBulWMyhW3qYStiHXIEyaYQvkBHgkzA9CgoKNNXkw3cEvFi8komcGS0QIDfcIERr+zwKpqiNxKVPthdNY6qFgDHj5e5whdPEGpDI1DVmoLB0aMMpYeBspq3zkotgqHCpy0xAxZBA5gwUvAtNPPDJJAZz5o0AedBuxNWHIyXreDPqr008iG/ZKM3QI9IH3b4BrgkIm3sNGiG+dIcyrBzEqdn9e6xtjz7QRLHRoyb0SKZsb/2ulgdzWNpP1rUMwwzYE4XdRCNbhAGxw3o8SwmCmD5VbdrWGY7afRxEmFDCZTAwyFcxdop2rMpsaZD89/gmqihOVlDwAwOw/5J8ljpePUDocMSZuxcNqqVhSM/lbnUdpla/lBpa2fa/RkZ9ri0Z8/nlLci2CHxCz0ALpf/blNOGF33GsNXmTEuFmg2/ikRhIcF4sX2YQCH5AOnBuaTe/6NqBwECbhP9/fdsF9a/AAmPe3YHvsP6lvWrZPCOwg5BX6sTxjPW/apgvuDcHL1noWaiNB126b6i3b5ohoTIveAApoe6t3QDePry3HllRLe2ux5CqdorX0A7gYpn3+Ht7GwZVD"),
@@ -305,6 +624,22 @@ func parsePrivateKey(path string) *rsa.PrivateKey {
 	return privKey
 }
 
+func parsePKCS8PrivateKey(path string) crypto.Signer {
+	privKeyBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Unable to get private %q key for test: %v", path, err)
+	}
+
+	privBlock, _ := pem.Decode(privKeyBytes)
+
+	privKey, err := x509.ParsePKCS8PrivateKey(privBlock.Bytes)
+	if err != nil {
+		log.Fatalf("Unable to get private %q key for test: %v", path, err)
+	}
+
+	return privKey.(crypto.Signer)
+}
+
 func parseCert(path string) *x509.Certificate {
 	certFile, err := os.Open(path)
 	if err != nil {
@@ -334,3 +669,10 @@ func base64Decode(s string) []byte {
 
 	return b
 }
+
+// setNow makes now return n until the test ends.
+func setNow(t *testing.T, n time.Time) {
+	previous := now
+	now = func() time.Time { return n }
+	t.Cleanup(func() { now = previous })
+}
@@ -0,0 +1,271 @@
+package arcane
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+const (
+	// armorBegin and armorEnd delimit armored data.
+	armorBegin = "-----BEGIN ARCANE MESSAGE-----"
+	armorEnd   = "-----END ARCANE MESSAGE-----"
+	// armorLineLength is the number of bytes encoded on each line of armored data, 64 base64 characters.
+	armorLineLength = 48
+	// crc24Init and crc24Poly are the initial value and generator of the CRC-24 checksum of OpenPGP (RFC 4880).
+	crc24Init = 0xb704ce
+	crc24Poly = 0x1864cfb
+)
+
+var (
+	// errInvalidArmor is returned by ArmorDecoder if the data is not armored as by ArmorEncoder.
+	errInvalidArmor = errors.New("invalid armor")
+	// errArmorChecksum is returned by ArmorDecoder if the checksum of armored data does not match its content.
+	errArmorChecksum = errors.New("armor checksum mismatch")
+)
+
+// ArmorEncoder armors data written to it, so binary encodings of messages can be pasted as text. Armored data starts
+// with the line "-----BEGIN ARCANE MESSAGE-----", followed by the data base64 encoded on lines of 64 characters, a
+// line holding "=" and the base64 encoded CRC-24 checksum of the data as in OpenPGP (RFC 4880), and the line
+// "-----END ARCANE MESSAGE-----". Close must be called to write the checksum and the last lines.
+type ArmorEncoder struct {
+	w       io.Writer
+	crc     uint32
+	buf     []byte
+	started bool
+	closed  bool
+	err     error
+}
+
+// NewArmorEncoder returns an ArmorEncoder writing armored data to w.
+func NewArmorEncoder(w io.Writer) *ArmorEncoder {
+	return &ArmorEncoder{w: w, crc: crc24Init}
+}
+
+// Write armors p. Data is written to the underlying writer a line at a time.
+func (e *ArmorEncoder) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed armor encoder")
+	}
+
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	e.crc = crc24(e.crc, p)
+	data := append(e.buf, p...)
+	out := e.begin(nil)
+	for len(data) >= armorLineLength {
+		out = appendArmorLine(out, data[:armorLineLength])
+		data = data[armorLineLength:]
+	}
+	e.buf = append(e.buf[:0], data...)
+
+	if len(out) > 0 {
+		if _, e.err = e.w.Write(out); e.err != nil {
+			return 0, e.err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close writes the remaining data, the checksum and the end line. It does not close the underlying writer.
+func (e *ArmorEncoder) Close() error {
+	if e.closed || e.err != nil {
+		return e.err
+	}
+	e.closed = true
+
+	out := e.begin(nil)
+	if len(e.buf) > 0 {
+		out = appendArmorLine(out, e.buf)
+	}
+
+	checksum := []byte{byte(e.crc >> 16), byte(e.crc >> 8), byte(e.crc)}
+	out = append(out, '=')
+	out = base64.StdEncoding.AppendEncode(out, checksum)
+	out = append(out, '\n')
+	out = append(out, armorEnd...)
+	out = append(out, '\n')
+
+	_, e.err = e.w.Write(out)
+
+	return e.err
+}
+
+// begin appends the begin line to out if it has not been written yet.
+func (e *ArmorEncoder) begin(out []byte) []byte {
+	if e.started {
+		return out
+	}
+	e.started = true
+
+	return append(append(out, armorBegin...), '\n')
+}
+
+// appendArmorLine appends a line holding the base64 encoding of data to out.
+func appendArmorLine(out, data []byte) []byte {
+	return append(base64.StdEncoding.AppendEncode(out, data), '\n')
+}
+
+// ArmorDecoder reads the data armored by an ArmorEncoder. Lines before the begin line are skipped, and whitespace
+// around lines, including carriage returns, and empty lines are ignored, so armored data pasted into text can be read
+// as is. Data is returned as it is decoded, and Read returns io.EOF once the end line is read and the checksum has
+// matched. The checksum only detects data mangled in transit, messages are authenticated when they are opened. The
+// underlying reader may have been read past the end line.
+type ArmorDecoder struct {
+	r       *bufio.Reader
+	crc     uint32
+	started bool
+	// pending holds base64 characters not yet decoded, as they do not make up a group of four.
+	pending []byte
+	// padded is set once a group of base64 characters with padding is decoded, which must be the last group.
+	padded bool
+	out    []byte
+	err    error
+}
+
+// NewArmorDecoder returns an ArmorDecoder reading armored data from r.
+func NewArmorDecoder(r io.Reader) *ArmorDecoder {
+	return &ArmorDecoder{r: bufio.NewReader(r), crc: crc24Init}
+}
+
+// Read reads data decoded from the armor.
+func (d *ArmorDecoder) Read(p []byte) (int, error) {
+	for len(d.out) == 0 && d.err == nil {
+		d.err = d.next()
+	}
+
+	if len(d.out) == 0 {
+		return 0, d.err
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+
+	return n, nil
+}
+
+// next decodes the next line of the armor.
+func (d *ArmorDecoder) next() error {
+	if !d.started {
+		if err := d.skipToBegin(); err != nil {
+			return err
+		}
+		d.started = true
+	}
+
+	line, err := d.readLine()
+	if err != nil {
+		return err
+	}
+
+	if len(line) == 0 {
+		return nil
+	}
+
+	if line[0] == '=' {
+		return d.checksum(line)
+	}
+
+	if d.padded || string(line) == armorEnd {
+		return errInvalidArmor
+	}
+
+	chars := append(d.pending, line...)
+	n := len(chars) / 4 * 4
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(n))
+	m, err := base64.StdEncoding.Decode(decoded, chars[:n])
+	if err != nil {
+		return errInvalidArmor
+	}
+
+	d.padded = m < n/4*3
+	d.pending = append(d.pending[:0], chars[n:]...)
+	d.out = decoded[:m]
+	d.crc = crc24(d.crc, d.out)
+
+	return nil
+}
+
+// skipToBegin reads up to and including the begin line.
+func (d *ArmorDecoder) skipToBegin() error {
+	for {
+		line, err := d.r.ReadSlice('\n')
+		if string(bytes.TrimSpace(line)) == armorBegin {
+			return nil
+		}
+
+		if err == io.EOF {
+			return errInvalidArmor
+		}
+
+		// The rest of a line that does not fit the buffer is read and skipped as the next line.
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// checksum verifies the checksum line and reads the end line.
+func (d *ArmorDecoder) checksum(line []byte) error {
+	if len(d.pending) != 0 || len(line) != 5 {
+		return errInvalidArmor
+	}
+
+	checksum, err := base64.StdEncoding.DecodeString(string(line[1:]))
+	if err != nil || len(checksum) != 3 {
+		return errInvalidArmor
+	}
+
+	if uint32(checksum[0])<<16|uint32(checksum[1])<<8|uint32(checksum[2]) != d.crc {
+		return errArmorChecksum
+	}
+
+	end, err := d.readLine()
+	if err != nil {
+		return err
+	}
+
+	if string(end) != armorEnd {
+		return errInvalidArmor
+	}
+
+	return io.EOF
+}
+
+// readLine returns the next line of the armor without surrounding whitespace. Lines that do not fit the buffer of the
+// reader are rejected, and the armor must not end before the end line.
+func (d *ArmorDecoder) readLine() ([]byte, error) {
+	line, err := d.r.ReadSlice('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+
+	switch err {
+	case nil:
+		return bytes.TrimSpace(line), nil
+	case io.EOF, bufio.ErrBufferFull:
+		return nil, errInvalidArmor
+	default:
+		return nil, err
+	}
+}
+
+// crc24 updates the CRC-24 checksum crc with the bytes of b.
+func crc24(crc uint32, b []byte) uint32 {
+	for _, c := range b {
+		crc ^= uint32(c) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+
+	return crc & 0xffffff
+}
@@ -0,0 +1,143 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArmorEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			name:     "Empty",
+			expected: "-----BEGIN ARCANE MESSAGE-----\n=twTO\n-----END ARCANE MESSAGE-----\n",
+		},
+		{
+			// The CRC-24 check value of "123456789" is 0x21cf02.
+			name:     "Check value",
+			data:     "123456789",
+			expected: "-----BEGIN ARCANE MESSAGE-----\nMTIzNDU2Nzg5\n=Ic8C\n-----END ARCANE MESSAGE-----\n",
+		},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		e := NewArmorEncoder(&b)
+		_, err := e.Write([]byte(test.data))
+		assert.NoError(t, err, test.name)
+		assert.NoError(t, e.Close(), test.name)
+		assert.Equal(t, test.expected, b.String(), test.name)
+
+		_, err = e.Write([]byte(test.data))
+		assert.Error(t, err, test.name)
+	}
+}
+
+func TestArmorDecoder(t *testing.T) {
+	for _, size := range []int{0, 1, armorLineLength - 1, armorLineLength, armorLineLength + 1, 1000} {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		assert.NoError(t, err)
+
+		// Written a byte at a time and at once.
+		var oneByte, atOnce bytes.Buffer
+		e := NewArmorEncoder(&oneByte)
+		for i := range data {
+			_, err := e.Write(data[i : i+1])
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, e.Close())
+
+		e = NewArmorEncoder(&atOnce)
+		_, err = e.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, e.Close())
+		assert.Equal(t, atOnce.String(), oneByte.String(), size)
+
+		for _, line := range strings.Split(strings.TrimSuffix(atOnce.String(), "\n"), "\n") {
+			assert.True(t, len(line) <= 64, size)
+		}
+
+		decoded, err := ioutil.ReadAll(iotest.OneByteReader(NewArmorDecoder(&atOnce)))
+		assert.NoError(t, err, size)
+		assert.Equal(t, data, decoded, size)
+	}
+
+	// Armor pasted into text.
+	pasted := "Hi,\r\n\r\nthe message:\r\n\r\n  -----BEGIN ARCANE MESSAGE-----\r\n  MTIzNDU2\r\n\r\n  Nzg5\r\n  =Ic8C\r\n" +
+		"  -----END ARCANE MESSAGE-----\r\n\r\nRegards"
+	decoded, err := ioutil.ReadAll(NewArmorDecoder(strings.NewReader(pasted)))
+	assert.NoError(t, err)
+	assert.Equal(t, "123456789", string(decoded))
+
+	// Lines do not have to hold groups of four characters.
+	decoded, err = ioutil.ReadAll(NewArmorDecoder(strings.NewReader(armorBegin + "\nMTI\nzND\nU2Nzg5\n=Ic8C\n" + armorEnd)))
+	assert.NoError(t, err)
+	assert.Equal(t, "123456789", string(decoded))
+
+	invalid := []struct {
+		name        string
+		armor       string
+		expectedErr error
+	}{
+		{name: "Empty", armor: "", expectedErr: errInvalidArmor},
+		{name: "No begin line", armor: "MTIzNDU2Nzg5\n=Ic8C\n" + armorEnd + "\n", expectedErr: errInvalidArmor},
+		{name: "No checksum", armor: armorBegin + "\nMTIzNDU2Nzg5\n" + armorEnd + "\n", expectedErr: errInvalidArmor},
+		{name: "No end line", armor: armorBegin + "\nMTIzNDU2Nzg5\n=Ic8C\n", expectedErr: errInvalidArmor},
+		{name: "Truncated", armor: armorBegin + "\nMTIzNDU2Nzg5\n", expectedErr: errInvalidArmor},
+		{name: "Checksum mismatch", armor: armorBegin + "\nMTIzNDU2Nzg4\n=Ic8C\n" + armorEnd + "\n", expectedErr: errArmorChecksum},
+		{name: "Invalid checksum", armor: armorBegin + "\nMTIzNDU2Nzg5\n=Ic8\n" + armorEnd + "\n", expectedErr: errInvalidArmor},
+		{name: "Invalid base64", armor: armorBegin + "\nMTIz*DU2Nzg5\n=Ic8C\n" + armorEnd + "\n", expectedErr: errInvalidArmor},
+		{name: "Incomplete group", armor: armorBegin + "\nMTIzNDU2Nzg\n=Ic8C\n" + armorEnd + "\n", expectedErr: errInvalidArmor},
+		{name: "Data after padding", armor: armorBegin + "\nMQ==\nMTIz\n=Ic8C\n" + armorEnd + "\n", expectedErr: errInvalidArmor},
+		{name: "Line too long", armor: armorBegin + "\n" + strings.Repeat("A", 8192) + "\n=Ic8C\n" + armorEnd + "\n", expectedErr: errInvalidArmor},
+	}
+
+	for _, test := range invalid {
+		_, err := ioutil.ReadAll(NewArmorDecoder(strings.NewReader(test.armor)))
+		assert.Equal(t, test.expectedErr, err, test.name)
+	}
+}
+
+func TestArmorStream(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+
+	payload := make([]byte, 2*streamChunkSize+1)
+	_, err := rand.Read(payload)
+	assert.NoError(t, err)
+
+	// The armor is written and read while sealing and opening the stream.
+	r, w := io.Pipe()
+	go func() {
+		e := NewArmorEncoder(w)
+		err := sealer.SealStream(e, bytes.NewReader(payload))
+		if err == nil {
+			err = e.Close()
+		}
+		w.CloseWithError(err)
+	}()
+
+	var opened bytes.Buffer
+	d := NewArmorDecoder(r)
+	assert.NoError(t, opener.OpenStream(&opened, d))
+	assert.Equal(t, payload, opened.Bytes())
+
+	// OpenStream reads the armor up to the end line, checking the checksum.
+	rest, err := ioutil.ReadAll(d)
+	assert.NoError(t, err)
+	assert.Empty(t, rest)
+}
@@ -0,0 +1,259 @@
+package arcane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strconv"
+)
+
+// binaryMagic prefixes envelopes encoded using MarshalBinary. The last byte is the version of the binary encoding.
+var binaryMagic = []byte{'A', 'R', 'C', 'N', 1}
+
+const (
+	// maxBinaryHeaderSize limits the size of the header accepted by UnmarshalBinary.
+	maxBinaryHeaderSize = 1024 * 1024
+	// maxBinarySignatureSize limits the size of the signature accepted by UnmarshalBinary.
+	maxBinarySignatureSize = 16 * 1024
+	// maxBinaryPayloadSize limits the size of the payload accepted by UnmarshalBinary.
+	maxBinaryPayloadSize = 1024 * 1024 * 1024
+)
+
+// Field tags used in the binary encoding of Envelope.
+const (
+	tagBinaryHeader byte = iota + 1
+	tagBinarySignature
+	tagBinaryPayload
+)
+
+// errInvalidBinaryEnvelope is returned by UnmarshalBinary if the data is not a valid binary encoded envelope.
+var errInvalidBinaryEnvelope = errors.New("invalid binary envelope")
+
+// MarshalBinary encodes the envelope in a compact binary format. The encoding starts with the magic bytes "ARCN"
+// followed by a one byte encoding version, and then holds the canonical encoding of the header, the signature and the
+// payload, each as a one byte tag followed by the length as a four byte big endian integer and the value itself.
+func (e *Envelope) MarshalBinary() ([]byte, error) {
+	header := e.Header.additionalData()
+	if len(header) > maxBinaryHeaderSize || len(e.Header.Signature) > maxBinarySignatureSize || len(e.Payload) > maxBinaryPayloadSize {
+		return nil, errors.New("envelope exceeds limit")
+	}
+
+	var w canonicalWriter
+	w.buf.Write(binaryMagic)
+	w.field(tagBinaryHeader, header)
+	w.field(tagBinarySignature, e.Header.Signature)
+	w.field(tagBinaryPayload, e.Payload)
+
+	return w.bytes(), nil
+}
+
+// UnmarshalBinary decodes an envelope encoded using MarshalBinary. Only the encoding produced by MarshalBinary is
+// accepted: fields must be in order, appear at most once unless repeatable and hold values in canonical form.
+func (e *Envelope) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, binaryMagic) {
+		return errInvalidBinaryEnvelope
+	}
+
+	// The data is copied so the envelope does not share memory with the caller.
+	r := &canonicalReader{b: append([]byte(nil), data[len(binaryMagic):]...)}
+	limits := map[byte]int{
+		tagBinaryHeader:    maxBinaryHeaderSize,
+		tagBinarySignature: maxBinarySignatureSize,
+		tagBinaryPayload:   maxBinaryPayloadSize,
+	}
+
+	var envelope Envelope
+	for !r.done() {
+		tag, value, err := r.next()
+		if err != nil || len(value) > limits[tag] {
+			return errInvalidBinaryEnvelope
+		}
+
+		switch tag {
+		case tagBinaryHeader:
+			if err := envelope.Header.unmarshalCanonical(value); err != nil {
+				return err
+			}
+		case tagBinarySignature:
+			envelope.Header.Signature = value
+		case tagBinaryPayload:
+			envelope.Payload = value
+		default:
+			return errInvalidBinaryEnvelope
+		}
+	}
+
+	*e = envelope
+
+	return nil
+}
+
+// unmarshalCanonical decodes the canonical encoding of a header produced by additionalData.
+func (h *Header) unmarshalCanonical(b []byte) error {
+	r := &canonicalReader{b: b, repeatable: map[byte]bool{tagRecipient: true, tagSealerChain: true, tagClaim: true}}
+	lastClaim := ""
+	for !r.done() {
+		tag, value, err := r.next()
+		if err != nil {
+			return errInvalidBinaryEnvelope
+		}
+
+		switch tag {
+		case tagVersion:
+			h.Version, err = parseCanonicalInt(value)
+		case tagSealerCert:
+			h.SealerCert = value
+		case tagSignatureAlgorithm:
+			h.SignatureAlgorithm = SignatureAlgorithm(value)
+		case tagCreated:
+			h.Created = string(value)
+		case tagExpires:
+			h.Expires = string(value)
+		case tagRecipient:
+			var recipient Recipient
+			err = recipient.unmarshalCanonical(value)
+			h.Recipients = append(h.Recipients, recipient)
+		case tagEncryptedKey:
+			h.EncryptedKey = value
+		case tagSuite:
+			h.Suite = string(value)
+		case tagChunkSize:
+			h.ChunkSize, err = parseCanonicalInt(value)
+		case tagMessageID:
+			h.MessageID = string(value)
+		case tagOCSPResponse:
+			h.OCSPResponse = value
+		case tagSealerChain:
+			h.SealerChain = append(h.SealerChain, value)
+		case tagClaim:
+			name, claimValue, claimErr := unmarshalCanonicalClaim(value)
+			// Claims must be sorted by name, which also rules out duplicates.
+			if claimErr != nil || name <= lastClaim {
+				return errInvalidBinaryEnvelope
+			}
+			if h.Claims == nil {
+				h.Claims = make(map[string]string)
+			}
+			h.Claims[name] = claimValue
+			lastClaim = name
+		case tagEncryptedMetadata:
+			h.EncryptedMetadata = value
+		default:
+			err = errInvalidBinaryEnvelope
+		}
+
+		if err != nil {
+			return errInvalidBinaryEnvelope
+		}
+	}
+
+	return nil
+}
+
+// unmarshalCanonicalClaim decodes the canonical encoding of a claim and returns its name and value.
+func unmarshalCanonicalClaim(b []byte) (string, string, error) {
+	r := &canonicalReader{b: b}
+	var name, value string
+	for !r.done() {
+		tag, v, err := r.next()
+		if err != nil {
+			return "", "", err
+		}
+
+		switch tag {
+		case tagClaimName:
+			name = string(v)
+		case tagClaimValue:
+			value = string(v)
+		default:
+			return "", "", errInvalidBinaryEnvelope
+		}
+	}
+
+	if name == "" {
+		return "", "", errInvalidBinaryEnvelope
+	}
+
+	return name, value, nil
+}
+
+// unmarshalCanonical decodes the canonical encoding of a recipient.
+func (r *Recipient) unmarshalCanonical(b []byte) error {
+	cr := &canonicalReader{b: b}
+	for !cr.done() {
+		tag, value, err := cr.next()
+		if err != nil {
+			return err
+		}
+
+		switch tag {
+		case tagRecipientSubjectKeyID:
+			r.SubjectKeyID = value
+		case tagRecipientIssuer:
+			r.Issuer = value
+		case tagRecipientSerialNumber:
+			serialNumber, ok := new(big.Int).SetString(string(value), 10)
+			if !ok || serialNumber.String() != string(value) {
+				return errInvalidBinaryEnvelope
+			}
+			r.SerialNumber = serialNumber
+		case tagRecipientAlgorithm:
+			r.Algorithm = KeyWrapAlgorithm(value)
+		case tagRecipientEphemeralKey:
+			r.EphemeralKey = value
+		case tagRecipientEncryptedKey:
+			r.EncryptedKey = value
+		case tagRecipientCertFingerprint:
+			r.CertFingerprint = value
+		default:
+			return errInvalidBinaryEnvelope
+		}
+	}
+
+	return nil
+}
+
+// canonicalReader reads fields written by canonicalWriter. Tags must be in increasing order, or repeated if listed
+// as repeatable, and values must not be empty.
+type canonicalReader struct {
+	b          []byte
+	last       byte
+	repeatable map[byte]bool
+}
+
+func (r *canonicalReader) done() bool {
+	return len(r.b) == 0
+}
+
+func (r *canonicalReader) next() (byte, []byte, error) {
+	if len(r.b) < 5 {
+		return 0, nil, errInvalidBinaryEnvelope
+	}
+
+	tag := r.b[0]
+	if tag < r.last || (tag == r.last && !r.repeatable[tag]) {
+		return 0, nil, errInvalidBinaryEnvelope
+	}
+
+	length := binary.BigEndian.Uint32(r.b[1:5])
+	if length == 0 || uint64(length) > uint64(len(r.b)-5) {
+		return 0, nil, errInvalidBinaryEnvelope
+	}
+
+	value := r.b[5 : 5+length : 5+length]
+	r.b = r.b[5+length:]
+	r.last = tag
+
+	return tag, value, nil
+}
+
+// parseCanonicalInt parses an integer written by canonicalWriter.intField.
+func parseCanonicalInt(b []byte) (int, error) {
+	n, err := strconv.Atoi(string(b))
+	if err != nil || n == 0 || strconv.Itoa(n) != string(b) {
+		return 0, errInvalidBinaryEnvelope
+	}
+
+	return n, nil
+}
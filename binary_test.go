@@ -0,0 +1,176 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope_MarshalBinary(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name    string
+		sealer  *Sealer
+		opener  *Opener
+		options SealOptions
+	}{
+		{
+			name:   "RSA",
+			sealer: &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, signedCert3}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+		},
+		{
+			name:   "EC",
+			sealer: &Sealer{PrivateKey: ed25519Pk, Cert: ed25519Cert, ReceiverCerts: []*x509.Certificate{ecdsaCert1}},
+			opener: &Opener{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, CertPool: caCertPool},
+		},
+		{
+			name:   "Chain, claims and metadata",
+			sealer: &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			options: SealOptions{
+				Claims:   map[string]string{"tenantId": "tenant-1", "contentType": "text/plain", "subject": ""},
+				Metadata: map[string]string{"filename": "test.txt"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		message, err := test.sealer.SealWithOptions([]byte("This is a test payload."), test.options)
+		assert.NoError(t, err, test.name)
+
+		b, err := message.MarshalBinary()
+		assert.NoError(t, err, test.name)
+		assert.True(t, bytes.HasPrefix(b, []byte("ARCN\x01")), test.name)
+
+		jsonBytes, err := json.Marshal(message)
+		assert.NoError(t, err, test.name)
+		assert.Less(t, len(b), len(jsonBytes)*4/5, test.name)
+
+		var decoded Envelope
+		assert.NoError(t, decoded.UnmarshalBinary(b), test.name)
+		assert.Equal(t, message, &decoded, test.name)
+
+		// The encoding is canonical.
+		encoded, err := decoded.MarshalBinary()
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, b, encoded, test.name)
+
+		payload, err := test.opener.Open(&decoded)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+
+		// The envelope does not share memory with the encoded data.
+		for i := range b {
+			b[i] = 0
+		}
+		assert.Equal(t, message, &decoded, test.name)
+	}
+}
+
+func TestEnvelope_MarshalBinaryLegacy(t *testing.T) {
+	header := Header{
+		SealerCert: []byte{1},
+		Signature:  []byte{2},
+		Recipients: []Recipient{{Issuer: []byte{3}, EncryptedKey: []byte{4}}},
+		Created:    "2020-11-26T18:37:56+01:00",
+		Expires:    "2020-11-26T18:42:56+01:00",
+	}
+	message := &Envelope{Header: header, Payload: []byte{5}}
+
+	b, err := message.MarshalBinary()
+	assert.NoError(t, err)
+
+	var decoded Envelope
+	assert.NoError(t, decoded.UnmarshalBinary(b))
+	assert.Equal(t, message, &decoded)
+
+	// An empty envelope is only the magic bytes.
+	b, err = (&Envelope{}).MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, binaryMagic, b)
+	assert.NoError(t, decoded.UnmarshalBinary(b))
+	assert.Equal(t, Envelope{}, decoded)
+
+	_, err = (&Envelope{Header: Header{Signature: make([]byte, maxBinarySignatureSize+1)}}).MarshalBinary()
+	assert.Error(t, err)
+}
+
+func TestEnvelope_UnmarshalBinaryInvalid(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	message, err := sealer.SealWithOptions([]byte("This is a test payload."), SealOptions{Claims: map[string]string{"a": "1"}})
+	assert.NoError(t, err)
+
+	valid, err := message.MarshalBinary()
+	assert.NoError(t, err)
+
+	field := func(tag byte, value []byte) []byte {
+		var w canonicalWriter
+		w.field(tag, value)
+		return w.bytes()
+	}
+	envelope := func(fields ...[]byte) []byte {
+		return append(append([]byte(nil), binaryMagic...), bytes.Join(fields, nil)...)
+	}
+	header := func(fields ...[]byte) []byte {
+		return envelope(field(tagBinaryHeader, bytes.Join(fields, nil)))
+	}
+	claim := func(name, value string) []byte {
+		return field(tagClaim, append(field(tagClaimName, []byte(name)), field(tagClaimValue, []byte(value))...))
+	}
+
+	tooLong := envelope([]byte{tagBinarySignature, 0, 0, 0, 0})
+	binary.BigEndian.PutUint32(tooLong[len(tooLong)-4:], maxBinarySignatureSize+1)
+	tooLong = append(tooLong, make([]byte, maxBinarySignatureSize+1)...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: nil},
+		{name: "Wrong magic", data: append([]byte("ARCX\x01"), valid[len(binaryMagic):]...)},
+		{name: "Unknown encoding version", data: append([]byte("ARCN\x02"), valid[len(binaryMagic):]...)},
+		{name: "Trailing data", data: append(append([]byte(nil), valid...), 0)},
+		{name: "Unknown field", data: envelope(field(tagBinaryPayload+1, []byte{1}))},
+		{name: "Fields out of order", data: envelope(field(tagBinaryPayload, []byte{1}), field(tagBinaryHeader, field(tagVersion, []byte("1"))))},
+		{name: "Field repeated", data: envelope(field(tagBinaryPayload, []byte{1}), field(tagBinaryPayload, []byte{1}))},
+		{name: "Empty field", data: envelope([]byte{tagBinaryPayload, 0, 0, 0, 0})},
+		{name: "Length exceeds data", data: envelope([]byte{tagBinaryPayload, 0, 0, 0, 2, 1})},
+		{name: "Length exceeds limit", data: tooLong},
+		{name: "Unknown header field", data: header(field(tagEncryptedMetadata+1, []byte{1}))},
+		{name: "Header field repeated", data: header(field(tagSealerCert, []byte{1}), field(tagSealerCert, []byte{1}))},
+		{name: "Version not canonical", data: header(field(tagVersion, []byte("09")))},
+		{name: "Version zero", data: header(field(tagVersion, []byte("0")))},
+		{name: "Version not a number", data: header(field(tagVersion, []byte("a")))},
+		{name: "Serial number not canonical", data: header(field(tagRecipient, field(tagRecipientSerialNumber, []byte("+1"))))},
+		{name: "Unknown recipient field", data: header(field(tagRecipient, field(tagRecipientCertFingerprint+1, []byte{1})))},
+		{name: "Claims not sorted", data: header(claim("b", "1"), claim("a", "1"))},
+		{name: "Claim repeated", data: header(claim("a", "1"), claim("a", "1"))},
+		{name: "Claim without name", data: header(field(tagClaim, field(tagClaimValue, []byte("1"))))},
+	}
+
+	for _, test := range tests {
+		var decoded Envelope
+		assert.Equal(t, errInvalidBinaryEnvelope, decoded.UnmarshalBinary(test.data), test.name)
+	}
+
+	// Every truncation of a valid envelope is rejected, except where a field ends.
+	for i := len(binaryMagic); i < len(valid); i++ {
+		var decoded Envelope
+		if err := decoded.UnmarshalBinary(valid[:i]); err == nil {
+			assert.NotEqual(t, message, &decoded, i)
+		}
+	}
+
+	// Claims with an empty value are accepted.
+	var decoded Envelope
+	assert.NoError(t, decoded.UnmarshalBinary(header(claim("a", ""), claim("b", "1"))))
+	assert.Equal(t, map[string]string{"a": "", "b": "1"}, decoded.Header.Claims)
+}
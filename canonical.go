@@ -0,0 +1,173 @@
+package arcane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+)
+
+const (
+	// versionLegacy is used by messages sealed before the version field was introduced. The header is not
+	// authenticated when the payload is encrypted.
+	versionLegacy = 0
+	// versionHeaderAAD messages use the canonical encoding of the header as additional authenticated data when the
+	// payload is encrypted.
+	versionHeaderAAD = 1
+	// versionSignedRecipients messages also sign the recipient certificate fingerprints, the encrypted keys and the
+	// encrypted payload.
+	versionSignedRecipients = 2
+	// versionCanonicalSignature messages sign the canonical encoding of the header, encrypted payload and plaintext
+	// prefixed by a signature context.
+	versionCanonicalSignature = 3
+	// versionSuite messages record the name of the suite they are sealed with.
+	versionSuite = 4
+	// versionMessageID messages carry a unique message ID.
+	versionMessageID = 5
+	// versionNanoTimestamps messages format Created and Expires with nanosecond precision.
+	versionNanoTimestamps = 6
+	// versionOCSP messages can carry a stapled OCSP response for the sealer certificate.
+	versionOCSP = 7
+	// versionSealerChain messages can carry the intermediate certificates of the sealer certificate.
+	versionSealerChain = 8
+	// versionClaims messages can carry custom claims.
+	versionClaims = 9
+	// versionMetadata messages can carry encrypted metadata.
+	versionMetadata = 10
+
+	// currentVersion is the version used by Sealer.
+	currentVersion = versionMetadata
+)
+
+// releasedVersion reports whether messages of version were sealed by a released Sealer. The versions between
+// versionLegacy and versionMetadata were only used while the format was developed, and are rejected by Opener.
+func releasedVersion(version int) bool {
+	return version == versionLegacy || version == versionMetadata
+}
+
+// Field tags used in the canonical encoding of Header.
+const (
+	tagVersion byte = iota + 1
+	tagSealerCert
+	tagSignatureAlgorithm
+	tagCreated
+	tagExpires
+	tagRecipient
+	tagEncryptedKey
+	tagSuite
+	tagChunkSize
+	tagMessageID
+	tagOCSPResponse
+	tagSealerChain
+	tagClaim
+	tagEncryptedMetadata
+)
+
+// Field tags used in the canonical encoding of Recipient.
+const (
+	tagRecipientSubjectKeyID byte = iota + 1
+	tagRecipientIssuer
+	tagRecipientSerialNumber
+	tagRecipientAlgorithm
+	tagRecipientEphemeralKey
+	tagRecipientEncryptedKey
+	tagRecipientCertFingerprint
+)
+
+// Field tags used in the canonical encoding of a claim.
+const (
+	tagClaimName byte = iota + 1
+	tagClaimValue
+)
+
+// Field tags used in the signing input.
+const (
+	tagSigningContext byte = iota + 1
+	tagSigningVersion
+	tagSigningHeader
+	tagSigningEncryptedPayload
+	tagSigningPlaintext
+)
+
+// canonicalWriter builds an unambiguous encoding of a sequence of fields. Each field is written as a one byte tag
+// followed by the length of the value as a four byte big endian integer and the value itself. Empty fields are left
+// out, so new fields can be added without changing the encoding of messages that don't use them.
+type canonicalWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *canonicalWriter) field(tag byte, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(value)))
+
+	w.buf.WriteByte(tag)
+	w.buf.Write(length[:])
+	w.buf.Write(value)
+}
+
+func (w *canonicalWriter) stringField(tag byte, value string) {
+	w.field(tag, []byte(value))
+}
+
+func (w *canonicalWriter) intField(tag byte, value int) {
+	if value == 0 {
+		return
+	}
+
+	w.stringField(tag, strconv.Itoa(value))
+}
+
+func (w *canonicalWriter) bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// canonical returns the canonical encoding of the recipient.
+func (r *Recipient) canonical() []byte {
+	var w canonicalWriter
+	w.field(tagRecipientSubjectKeyID, r.SubjectKeyID)
+	w.field(tagRecipientIssuer, r.Issuer)
+	if r.SerialNumber != nil {
+		w.stringField(tagRecipientSerialNumber, r.SerialNumber.String())
+	}
+	w.stringField(tagRecipientAlgorithm, string(r.Algorithm))
+	w.field(tagRecipientEphemeralKey, r.EphemeralKey)
+	w.field(tagRecipientEncryptedKey, r.EncryptedKey)
+	w.field(tagRecipientCertFingerprint, r.CertFingerprint)
+
+	return w.bytes()
+}
+
+// additionalData returns the canonical encoding of every header field except the signature. It is used as additional
+// authenticated data when encrypting the payload, so changing any header field makes decryption fail.
+func (h *Header) additionalData() []byte {
+	var w canonicalWriter
+	w.intField(tagVersion, h.Version)
+	w.field(tagSealerCert, h.SealerCert)
+	w.stringField(tagSignatureAlgorithm, string(h.SignatureAlgorithm))
+	w.stringField(tagCreated, h.Created)
+	w.stringField(tagExpires, h.Expires)
+	for i := range h.Recipients {
+		w.field(tagRecipient, h.Recipients[i].canonical())
+	}
+	w.field(tagEncryptedKey, h.EncryptedKey)
+	w.stringField(tagSuite, h.Suite)
+	w.intField(tagChunkSize, h.ChunkSize)
+	w.stringField(tagMessageID, h.MessageID)
+	w.field(tagOCSPResponse, h.OCSPResponse)
+	for _, cert := range h.SealerChain {
+		w.field(tagSealerChain, cert)
+	}
+	// Claims are encoded in order of their names, so the encoding does not depend on the order of the JSON object.
+	for _, name := range sortedClaimNames(h.Claims) {
+		var claim canonicalWriter
+		claim.stringField(tagClaimName, name)
+		claim.stringField(tagClaimValue, h.Claims[name])
+		w.field(tagClaim, claim.bytes())
+	}
+	w.field(tagEncryptedMetadata, h.EncryptedMetadata)
+
+	return w.bytes()
+}
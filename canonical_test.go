@@ -0,0 +1,168 @@
+package arcane
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalWriter(t *testing.T) {
+	var w canonicalWriter
+	w.field(1, []byte("ab"))
+	w.field(2, nil)
+	w.stringField(3, "c")
+	w.intField(4, 0)
+	w.intField(5, 12)
+
+	assert.Equal(t, []byte{
+		1, 0, 0, 0, 2, 'a', 'b',
+		3, 0, 0, 0, 1, 'c',
+		5, 0, 0, 0, 2, '1', '2',
+	}, w.bytes())
+}
+
+func TestHeader_AdditionalData(t *testing.T) {
+	header := &Header{
+		Version:    1,
+		SealerCert: []byte{1, 2, 3},
+		Created:    "ab",
+		Expires:    "c",
+		Recipients: []Recipient{
+			{Issuer: []byte{4}, SerialNumber: big.NewInt(102), Algorithm: RSAOAEP256, EncryptedKey: []byte{5}},
+		},
+	}
+
+	expected := []byte{
+		tagVersion, 0, 0, 0, 1, '1',
+		tagSealerCert, 0, 0, 0, 3, 1, 2, 3,
+		tagCreated, 0, 0, 0, 2, 'a', 'b',
+		tagExpires, 0, 0, 0, 1, 'c',
+		tagRecipient, 0, 0, 0, 37,
+		tagRecipientIssuer, 0, 0, 0, 1, 4,
+		tagRecipientSerialNumber, 0, 0, 0, 3, '1', '0', '2',
+		tagRecipientAlgorithm, 0, 0, 0, 12, 'R', 'S', 'A', '-', 'O', 'A', 'E', 'P', '-', '2', '5', '6',
+		tagRecipientEncryptedKey, 0, 0, 0, 1, 5,
+	}
+	assert.Equal(t, expected, header.additionalData())
+
+	// The signature is not part of the additional data.
+	header.Signature = []byte{6}
+	assert.Equal(t, expected, header.additionalData())
+
+	// Moving bytes between fields changes the encoding.
+	header.Created, header.Expires = "a", "bc"
+	assert.NotEqual(t, expected, header.additionalData())
+}
+
+func TestOpener_OpenHeaderAuthenticated(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, signedCert3}}
+	// Legacy messages are only opened with AllowPKCS1v15, which lets downgrades reach the header checks.
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true}
+
+	tests := []struct {
+		name        string
+		tamper      func(header *Header)
+		expectedErr error
+	}{
+		{
+			name:        "Untampered",
+			tamper:      func(header *Header) {},
+			expectedErr: nil,
+		},
+		{
+			name:        "Version downgraded",
+			tamper:      func(header *Header) { header.Version = versionLegacy },
+			expectedErr: &UnsupportedSuiteError{Suite: SuiteRSA, Registered: true},
+		},
+		{
+			name: "Version and suite downgraded",
+			tamper: func(header *Header) {
+				header.Version = versionLegacy
+				header.Suite = ""
+			},
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Suite swapped",
+			tamper:      func(header *Header) { header.Suite = SuiteMixed },
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Unknown version",
+			tamper:      func(header *Header) { header.Version = currentVersion + 1 },
+			expectedErr: &UnsupportedVersionError{Version: currentVersion + 1},
+		},
+		{
+			name:        "Other recipient removed",
+			tamper:      func(header *Header) { header.Recipients = header.Recipients[:1] },
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name: "Other recipient key replaced",
+			tamper: func(header *Header) {
+				header.Recipients[1].EncryptedKey = header.Recipients[0].EncryptedKey
+			},
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name: "Recipient added",
+			tamper: func(header *Header) {
+				header.Recipients = append(header.Recipients, header.Recipients[1])
+			},
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Intermediate added",
+			tamper:      func(header *Header) { header.SealerChain = append(header.SealerChain, caCert.Raw) },
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Legacy encrypted key added",
+			tamper:      func(header *Header) { header.EncryptedKey = []byte{1} },
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+	}
+
+	for _, test := range tests {
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+		assert.Equal(t, currentVersion, message.Header.Version)
+
+		test.tamper(&message.Header)
+
+		payload, err := opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr != nil {
+			assert.Nil(t, payload)
+		}
+	}
+}
+
+func TestOpener_OpenJSONRoundTrip(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, ReceiverCerts: []*x509.Certificate{signedCert2, ecdsaCert1, caCert}}
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+
+	b, err := json.Marshal(message)
+	assert.NoError(t, err)
+
+	var decoded Envelope
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+
+	for _, opener := range []*Opener{
+		{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+		{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, CertPool: caCertPool},
+		{PrivateKey: caPk, Cert: caCert, CertPool: caCertPool},
+	} {
+		payload, err := opener.Open(&decoded)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("This is a test payload."), payload)
+	}
+}
@@ -0,0 +1,289 @@
+package arcane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// CBOR major types.
+const (
+	cborUnsigned byte = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cborMaxDepth limits the nesting of arrays, maps and tags accepted by cborUnmarshal.
+const cborMaxDepth = 16
+
+var errInvalidCBOR = errors.New("invalid cbor")
+
+// cborMapping is a CBOR map. Keys are int64 or string.
+type cborMapping map[interface{}]interface{}
+
+// cborTagged is a CBOR tag and the item it encloses.
+type cborTagged struct {
+	Number  uint64
+	Content interface{}
+}
+
+// cborMarshal encodes a value using the CBOR core deterministic encoding. Only the types needed for COSE are
+// supported: int, int64, []byte, string, bool, nil, []interface{}, cborMapping and cborTagged. Map keys are sorted by
+// their encoding.
+func cborMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cborEncode(&buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func cborEncode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case int:
+		return cborEncode(buf, int64(v))
+	case int64:
+		if v < 0 {
+			cborHead(buf, cborNegative, uint64(-(v + 1)))
+		} else {
+			cborHead(buf, cborUnsigned, uint64(v))
+		}
+	case []byte:
+		cborHead(buf, cborBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		cborHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case bool:
+		if v {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+	case nil:
+		buf.WriteByte(cborSimple<<5 | 22)
+	case []interface{}:
+		cborHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := cborEncode(buf, item); err != nil {
+				return err
+			}
+		}
+	case cborMapping:
+		type entry struct{ key, value []byte }
+		entries := make([]entry, 0, len(v))
+		for key, value := range v {
+			switch key.(type) {
+			case int64, string:
+			default:
+				return errors.New("cbor map key must be int64 or string")
+			}
+
+			k, err := cborMarshal(key)
+			if err != nil {
+				return err
+			}
+
+			val, err := cborMarshal(value)
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, entry{k, val})
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+
+		cborHead(buf, cborMap, uint64(len(entries)))
+		for _, e := range entries {
+			buf.Write(e.key)
+			buf.Write(e.value)
+		}
+	case cborTagged:
+		cborHead(buf, cborTag, v.Number)
+		return cborEncode(buf, v.Content)
+	default:
+		return errors.New("unsupported cbor type")
+	}
+
+	return nil
+}
+
+// cborHead writes the initial byte of an item and its argument using the shortest encoding.
+func cborHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// cborUnmarshal decodes a single CBOR item that must span all of b. Integers are decoded as int64, maps as
+// cborMapping and tags as cborTagged. Indefinite lengths, floating point numbers and simple values other than true,
+// false and null are not supported. Byte strings are not copied.
+func cborUnmarshal(b []byte) (interface{}, error) {
+	d := &cborDecoder{b: b}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.b) != 0 {
+		return nil, errInvalidCBOR
+	}
+
+	return v, nil
+}
+
+type cborDecoder struct {
+	b []byte
+}
+
+func (d *cborDecoder) head() (byte, byte, uint64, error) {
+	if len(d.b) == 0 {
+		return 0, 0, 0, errInvalidCBOR
+	}
+
+	major, info := d.b[0]>>5, d.b[0]&0x1f
+	d.b = d.b[1:]
+
+	if info < 24 {
+		return major, info, uint64(info), nil
+	}
+
+	size := 0
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		return 0, 0, 0, errInvalidCBOR
+	}
+
+	if len(d.b) < size {
+		return 0, 0, 0, errInvalidCBOR
+	}
+
+	var n uint64
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+
+	return major, info, n, nil
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errInvalidCBOR
+	}
+
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if n > math.MaxInt64 {
+			return nil, errInvalidCBOR
+		}
+		return int64(n), nil
+	case cborNegative:
+		if n > math.MaxInt64 {
+			return nil, errInvalidCBOR
+		}
+		return -1 - int64(n), nil
+	case cborBytes, cborText:
+		if n > uint64(len(d.b)) {
+			return nil, errInvalidCBOR
+		}
+		s := d.b[:n:n]
+		d.b = d.b[n:]
+		if major == cborBytes {
+			return s, nil
+		}
+		if !utf8.Valid(s) {
+			return nil, errInvalidCBOR
+		}
+		return string(s), nil
+	case cborArray:
+		// Every item takes at least one byte, which bounds the allocation.
+		if n > uint64(len(d.b)) {
+			return nil, errInvalidCBOR
+		}
+		array := make([]interface{}, n)
+		for i := range array {
+			if array[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case cborMap:
+		if n > uint64(len(d.b))/2 {
+			return nil, errInvalidCBOR
+		}
+		m := make(cborMapping, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errInvalidCBOR
+			}
+
+			if _, exists := m[key]; exists {
+				return nil, errInvalidCBOR
+			}
+
+			if m[key], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case cborTag:
+		content, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return cborTagged{Number: n, Content: content}, nil
+	default:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+		return nil, errInvalidCBOR
+	}
+}
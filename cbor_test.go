@@ -0,0 +1,43 @@
+package arcane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCBOR(t *testing.T) {
+	value := cborTagged{Number: 96, Content: []interface{}{
+		int64(0), int64(23), int64(24), int64(-1), int64(-25), int64(65536), int64(-4294967297),
+		[]byte{1, 2}, "text", true, false, nil,
+		cborMapping{int64(-1): "b", int64(10): "c", int64(1): "a", "z": int64(1)},
+	}}
+
+	b, err := cborMarshal(value)
+	assert.NoError(t, err)
+	assert.Equal(t, hexDecode(t, "d8608d00171818203818"+"1a00010000"+"3b0000000100000000"+"420102"+"6474657874"+
+		"f5f4f6"+"a4"+"0161610a616320616261"+"7a01"), b)
+
+	decoded, err := cborUnmarshal(b)
+	assert.NoError(t, err)
+	assert.Equal(t, value, decoded)
+
+	invalid := []string{
+		"",                   // Empty.
+		"0000",               // Trailing data.
+		"5f",                 // Indefinite length.
+		"fa47c35000",         // Float.
+		"1c",                 // Reserved additional information.
+		"42ff",               // Truncated byte string.
+		"62c328",             // Invalid UTF-8.
+		"a201000100",         // Duplicate map key.
+		"a1f600",             // Map key of unsupported type.
+		"9bffffffffffffffff", // Array longer than the data.
+		"1bffffffffffffffff", // Integer overflowing int64.
+		"8181818181818181818181818181818181818100", // Nested too deeply.
+	}
+	for _, s := range invalid {
+		_, err := cborUnmarshal(hexDecode(t, s))
+		assert.Equal(t, errInvalidCBOR, err, s)
+	}
+}
@@ -0,0 +1,112 @@
+package arcane
+
+import (
+	"sort"
+)
+
+const (
+	// maxClaims limits the number of claims in a message.
+	maxClaims = 64
+	// maxClaimNameLength limits the length of claim names.
+	maxClaimNameLength = 64
+	// maxClaimValueLength limits the length of claim values.
+	maxClaimValueLength = 4096
+)
+
+// reservedClaims are names that can not be used for claims. They are the names of the header fields and the
+// registered JWT claim names, so claims can never be confused with either.
+var reservedClaims = map[string]bool{
+	"version":            true,
+	"messageId":          true,
+	"suite":              true,
+	"sealerCert":         true,
+	"sealerChain":        true,
+	"ocspResponse":       true,
+	"signatureAlgorithm": true,
+	"signature":          true,
+	"recipients":         true,
+	"chunkSize":          true,
+	"encryptedKey":       true,
+	"created":            true,
+	"expires":            true,
+	"claims":             true,
+	"encryptedMetadata":  true,
+	"iss":                true,
+	"sub":                true,
+	"aud":                true,
+	"exp":                true,
+	"nbf":                true,
+	"iat":                true,
+	"jti":                true,
+}
+
+// Claim returns the value of the claim with the given name, and whether the message has the claim.
+func (i *OpenInfo) Claim(name string) (string, bool) {
+	value, ok := i.Claims[name]
+	return value, ok
+}
+
+// validateClaims returns an InvalidClaimError if any of the claims is not allowed. Messages sealed before claims were
+// introduced can not have claims, as they would not be authenticated.
+func validateClaims(version int, claims map[string]string) error {
+	if len(claims) == 0 {
+		return nil
+	}
+
+	if version < versionClaims || len(claims) > maxClaims {
+		return ErrInvalidClaim
+	}
+
+	for name, value := range claims {
+		if reservedClaims[name] {
+			return &InvalidClaimError{Name: name, Reserved: true}
+		}
+
+		if !validClaimName(name) || len(value) > maxClaimValueLength {
+			return &InvalidClaimError{Name: name}
+		}
+	}
+
+	return nil
+}
+
+// validClaimName reports whether name is non-empty, at most maxClaimNameLength long and only contains ASCII letters,
+// digits, '-', '_' and '.'.
+func validClaimName(name string) bool {
+	if len(name) == 0 || len(name) > maxClaimNameLength {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// copyClaims returns a copy of claims, or nil if there are none.
+func copyClaims(claims map[string]string) map[string]string {
+	if len(claims) == 0 {
+		return nil
+	}
+
+	c := make(map[string]string, len(claims))
+	for name, value := range claims {
+		c[name] = value
+	}
+
+	return c
+}
+
+// sortedClaimNames returns the names of the claims in sorted order.
+func sortedClaimNames(claims map[string]string) []string {
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
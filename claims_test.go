@@ -0,0 +1,161 @@
+package arcane
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealer_SealWithOptionsClaims(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+
+	claims := map[string]string{
+		"contentType":   "application/json",
+		"tenantId":      "tenant-1",
+		"correlationId": "4f2c",
+		"subject":       "",
+	}
+
+	message, err := sealer.SealWithOptions([]byte("This is a test payload."), SealOptions{Claims: claims})
+	assert.NoError(t, err)
+	assert.Equal(t, claims, message.Header.Claims)
+
+	// Claims are copied, so changing the map does not change the message.
+	claims["tenantId"] = "tenant-2"
+	assert.Equal(t, "tenant-1", message.Header.Claims["tenantId"])
+
+	// Claims are readable without opening the message.
+	b, err := json.Marshal(message)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"tenantId":"tenant-1"`)
+
+	payload, info, err := opener.OpenWithInfo(message)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("This is a test payload."), payload)
+	assert.Equal(t, message.Header.Claims, info.Claims)
+
+	value, ok := info.Claim("contentType")
+	assert.True(t, ok)
+	assert.Equal(t, "application/json", value)
+	value, ok = info.Claim("subject")
+	assert.True(t, ok)
+	assert.Equal(t, "", value)
+	_, ok = info.Claim("missing")
+	assert.False(t, ok)
+
+	// Messages without claims have none.
+	message, err = sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	assert.Nil(t, message.Header.Claims)
+	_, info, err = opener.OpenWithInfo(message)
+	assert.NoError(t, err)
+	_, ok = info.Claim("contentType")
+	assert.False(t, ok)
+}
+
+func TestSealer_SealWithOptionsInvalidClaims(t *testing.T) {
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxClaims; i++ {
+		tooMany["claim"+strconv.Itoa(i)] = "value"
+	}
+
+	tests := []struct {
+		name        string
+		claims      map[string]string
+		expectedErr error
+	}{
+		{name: "Reserved header field", claims: map[string]string{"messageId": "1"}, expectedErr: &InvalidClaimError{Name: "messageId", Reserved: true}},
+		{name: "Reserved JWT claim", claims: map[string]string{"sub": "1"}, expectedErr: &InvalidClaimError{Name: "sub", Reserved: true}},
+		{name: "Empty name", claims: map[string]string{"": "1"}, expectedErr: &InvalidClaimError{Name: ""}},
+		{name: "Invalid name", claims: map[string]string{"not valid": "1"}, expectedErr: &InvalidClaimError{Name: "not valid"}},
+		{name: "Value too long", claims: map[string]string{"a": string(make([]byte, maxClaimValueLength+1))}, expectedErr: &InvalidClaimError{Name: "a"}},
+		{name: "Too many claims", claims: tooMany, expectedErr: ErrInvalidClaim},
+	}
+
+	for _, test := range tests {
+		_, err := sealer.SealWithOptions([]byte("This is a test payload."), SealOptions{Claims: test.claims})
+		assert.Equal(t, test.expectedErr, err, test.name)
+	}
+}
+
+func TestOpener_OpenClaimsAuthenticated(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+
+	tests := []struct {
+		name        string
+		tamper      func(header *Header)
+		expectedErr error
+	}{
+		{
+			name:        "Value changed",
+			tamper:      func(header *Header) { header.Claims["tenantId"] = "tenant-2" },
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Claim added",
+			tamper:      func(header *Header) { header.Claims["subject"] = "" },
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Claim removed",
+			tamper:      func(header *Header) { header.Claims = nil },
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name: "Value moved between claims",
+			tamper: func(header *Header) {
+				header.Claims["correlationId"], header.Claims["tenantId"] = header.Claims["tenantId"], header.Claims["correlationId"]
+			},
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Reserved claim added",
+			tamper:      func(header *Header) { header.Claims["iss"] = "someone" },
+			expectedErr: &InvalidClaimError{Name: "iss", Reserved: true},
+		},
+		{
+			name: "Claims on version without claims",
+			tamper: func(header *Header) {
+				header.Version = versionSealerChain
+			},
+			expectedErr: &UnsupportedVersionError{Version: versionSealerChain},
+		},
+	}
+
+	for _, test := range tests {
+		message, err := sealer.SealWithOptions([]byte("This is a test payload."), SealOptions{
+			Claims: map[string]string{"tenantId": "tenant-1", "correlationId": "4f2c"},
+		})
+		assert.NoError(t, err)
+
+		test.tamper(&message.Header)
+
+		payload, err := opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		assert.Nil(t, payload, test.name)
+	}
+}
+
+func TestHeader_AdditionalDataClaims(t *testing.T) {
+	header := &Header{Claims: map[string]string{"b": "2", "a": ""}}
+
+	expected := []byte{
+		tagClaim, 0, 0, 0, 6,
+		tagClaimName, 0, 0, 0, 1, 'a',
+		tagClaim, 0, 0, 0, 12,
+		tagClaimName, 0, 0, 0, 1, 'b',
+		tagClaimValue, 0, 0, 0, 1, '2',
+	}
+	assert.Equal(t, expected, header.additionalData())
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -12,6 +16,8 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,47 +27,59 @@ func main() {
 	isCa := flag.Bool("isca", false, "Set true if the certificate should be a ca")
 	parentPath := flag.String("parentpath", "", "Set this if using a parent to generate cert.")
 	bits := flag.Int("bits", 2048, "RSA key size.")
+	keyType := flag.String("keytype", "rsa", "Key type. One of rsa, ecdsa or ed25519.")
+	commonName := flag.String("cn", "", "Subject common name.")
+	notBefore := flag.String("notbefore", "", "Start of validity period in RFC3339 format. Defaults to now.")
+	revoke := flag.String("revoke", "", "Comma separated serial numbers to revoke. If set a CRL signed by the parent is "+
+		"written to certpath with the .crl suffix instead of a certificate, using serial as the CRL number.")
 
 	flag.Parse()
 
-	var keyUsage x509.KeyUsage
+	validFrom := time.Now()
+	if *notBefore != "" {
+		var err error
+		if validFrom, err = time.Parse(time.RFC3339, *notBefore); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *revoke != "" {
+		generateCRL(*certpath, *parentPath, *serial, *revoke, validFrom)
+		return
+	}
+
+	certPrivKey, certPubKey, keyUsage := generateKey(*keyType, *bits)
 	if *isCa {
-		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
-	} else {
-		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	}
 
 	cert := &x509.Certificate{
 		SerialNumber: big.NewInt(*serial),
 		Subject: pkix.Name{
+			CommonName:   *commonName,
 			Organization: []string{"Legit Company INC."},
 			Country:      []string{"NO"},
 			Province:     []string{""},
 			Locality:     []string{"Drammen"},
 			PostalCode:   []string{"3041"},
 		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(3, 0, 0),
+		NotBefore:             validFrom,
+		NotAfter:              validFrom.AddDate(3, 0, 0),
 		IsCA:                  *isCa,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		KeyUsage:              keyUsage,
 		BasicConstraintsValid: *isCa,
 	}
 
-	certPrivKey, err := rsa.GenerateKey(rand.Reader, *bits)
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	var parentCert *x509.Certificate
-	var parentKey *rsa.PrivateKey
+	var parentKey crypto.PrivateKey
 	if *parentPath != "" {
 		parentCert, parentKey = getCaCertAndKey(*parentPath+".crt", *parentPath+".key")
 	} else {
 		parentCert, parentKey = cert, certPrivKey
 	}
 
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, parentCert, &certPrivKey.PublicKey, parentKey)
+	certBytes, err := x509.CreateCertificate(rand.Reader, cert, parentCert, certPubKey, parentKey)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -83,16 +101,110 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if err := pem.Encode(keyFile, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(certPrivKey),
+	if err := pem.Encode(keyFile, marshalPrivateKey(certPrivKey)); err != nil {
+		log.Fatal(err)
+	}
+
+}
+
+// generateCRL writes a CRL revoking the given serial numbers, signed by the certificate at parentPath. The CRL is
+// valid for as long as certificates generated with the same validFrom.
+func generateCRL(crlPath, parentPath string, number int64, revoke string, validFrom time.Time) {
+	if parentPath == "" {
+		log.Fatal("parentpath must be set to generate a CRL")
+	}
+
+	parentCert, parentKey := getCaCertAndKey(parentPath+".crt", parentPath+".key")
+	signer, ok := parentKey.(crypto.Signer)
+	if !ok {
+		log.Fatal("parent key can not be used to sign")
+	}
+
+	var revoked []x509.RevocationListEntry
+	for _, s := range strings.Split(revoke, ",") {
+		serial, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		revoked = append(revoked, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: validFrom,
+		})
+	}
+
+	crlBytes, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(number),
+		ThisUpdate:                validFrom,
+		NextUpdate:                validFrom.AddDate(3, 0, 0),
+		RevokedCertificateEntries: revoked,
+	}, parentCert, signer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	crlFile, err := os.Create(crlPath + ".crl")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := pem.Encode(crlFile, &pem.Block{
+		Type:  "X509 CRL",
+		Bytes: crlBytes,
 	}); err != nil {
 		log.Fatal(err)
 	}
+}
+
+// generateKey returns a new key pair of the given type together with the key usage for a leaf certificate.
+func generateKey(keyType string, bits int) (crypto.PrivateKey, crypto.PublicKey, x509.KeyUsage) {
+	switch keyType {
+	case "rsa":
+		privKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return privKey, &privKey.PublicKey, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	case "ecdsa":
+		privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return privKey, &privKey.PublicKey, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement
+	case "ed25519":
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Ed25519 keys are also used for key agreement, converted to X25519.
+		return privKey, pubKey, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement
+	default:
+		log.Fatalf("unknown key type %q", keyType)
+		return nil, nil, 0
+	}
+}
+
+// marshalPrivateKey encodes RSA keys as PKCS#1 and all other keys as PKCS#8.
+func marshalPrivateKey(privKey crypto.PrivateKey) *pem.Block {
+	if rsaKey, ok := privKey.(*rsa.PrivateKey); ok {
+		return &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+		}
+	}
+
+	b, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		log.Fatal(err)
+	}
 
+	return &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: b,
+	}
 }
 
-func getCaCertAndKey(certPath, keyPath string) (*x509.Certificate, *rsa.PrivateKey) {
+func getCaCertAndKey(certPath, keyPath string) (*x509.Certificate, crypto.PrivateKey) {
 	caCertFile, err := os.Open(certPath)
 	if err != nil {
 		log.Fatal(err)
@@ -108,7 +220,13 @@ func getCaCertAndKey(certPath, keyPath string) (*x509.Certificate, *rsa.PrivateK
 		log.Fatal(err)
 	}
 
-	caKey, err := x509.ParsePKCS1PrivateKey(loadPem(caKeyFile).Bytes)
+	keyBlock := loadPem(caKeyFile)
+	var caKey crypto.PrivateKey
+	if keyBlock.Type == "RSA PRIVATE KEY" {
+		caKey, err = x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	} else {
+		caKey, err = x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -5,7 +5,9 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -17,13 +19,83 @@ const (
 	senderPk     = "test/data/signed1.key"
 	senderCert   = "test/data/signed1.crt"
 	receiverCert = "test/data/signed2.crt"
+
+	// CMS messages are sealed using a certificate issued by ca2, as openssl treats signed1 as self-signed because its
+	// subject is the same as that of its issuer.
+	cmsSenderPk   = "test/data/signed4.key"
+	cmsSenderCert = "test/data/signed4.crt"
 )
 
 func main() {
+	binary := flag.Bool("binary", false, "Write the message using the compact binary encoding instead of JSON.")
+	cose := flag.Bool("cose", false, "Write the message as COSE_Sign1 inside COSE_Encrypt instead of JSON.")
+	jwe := flag.Bool("jwe", false, "Write the message as a JWS inside a JWE in compact serialization instead of JSON.")
+	cms := flag.Bool("cms", false, "Write the message as DER encoded CMS SignedData inside AuthEnvelopedData instead of JSON. "+
+		"openssl only opens it using openssl cms -decrypt piped into openssl cms -verify, as OpenSSL 3 rejects the "+
+		"combined openssl cms -decrypt -verify with \"content type not signed data\".")
+	armor := flag.Bool("armor", false, "Armor the output so it can be pasted as text.")
+	flag.Parse()
+
+	var out io.Writer = os.Stdout
+	if *armor {
+		encoder := arcane.NewArmorEncoder(os.Stdout)
+		defer func() {
+			if err := encoder.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}()
+		out = encoder
+	}
+
 	sealer := &arcane.Sealer{
-		PrivateKey:   parsePrivateKey(senderPk),
-		Cert:         parseCert(senderCert),
-		ReceiverCert: parseCert(receiverCert),
+		PrivateKey:    parsePrivateKey(senderPk),
+		Cert:          parseCert(senderCert),
+		ReceiverCerts: []*x509.Certificate{parseCert(receiverCert)},
+	}
+
+	if *cose {
+		b, err := sealer.SealCOSE([]byte("This is a test."), arcane.SealOptions{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := out.Write(b); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if *cms {
+		sealer.PrivateKey = parsePrivateKey(cmsSenderPk)
+		sealer.Cert = parseCert(cmsSenderCert)
+
+		b, err := sealer.SealCMS([]byte("This is a test."), arcane.SealOptions{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := out.Write(b); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if *jwe {
+		message, err := sealer.SealJWE([]byte("This is a test."), arcane.SealOptions{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		compact, err := message.Compact()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Fprintln(out, compact)
+
+		return
 	}
 
 	message, err := sealer.Seal([]byte("This is a test."))
@@ -31,12 +103,25 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if *binary {
+		b, err := message.MarshalBinary()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := out.Write(b); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	b, err := json.MarshalIndent(&message, "", "    ")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Println(string(b))
+	fmt.Fprintln(out, string(b))
 }
 
 func parsePrivateKey(path string) *rsa.PrivateKey {
@@ -0,0 +1,1034 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+const (
+	// cmsArcaneUUID is the UUID of the OID 2.25.<uuid> (X.667) under which the signed attributes specific to arcane
+	// are defined.
+	cmsArcaneUUID = "2a7bf078c8344c588f4f2ad983dba3f6"
+	// cmsNonceSize is the size of the AES-GCM nonce of messages sealed using SealCMS.
+	cmsNonceSize = 12
+	// cmsTagSize is the size of the AES-GCM authentication tag of messages sealed using SealCMS.
+	cmsTagSize = 16
+	// cmsPSSSaltLength is the salt length of RSASSA-PSS signatures, the size of the SHA-256 digest.
+	cmsPSSSaltLength = 32
+)
+
+// Object identifiers from RFC 5652, RFC 5083, RFC 4055, RFC 5754, RFC 5758, RFC 5084 and RFC 8419.
+var (
+	oidData              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAuthEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 23}
+	oidContentType       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA512            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAEncryption     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAESOAEP         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMGF1              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidPSpecified        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 9}
+	oidRSASSAPSS         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidSHA256WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidEd25519           = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidAES256GCM         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+)
+
+// DER encoded types of the signed attributes of messages sealed using SealCMS.
+var (
+	cmsAttributeContentType   = cmsOID(oidContentType)
+	cmsAttributeMessageDigest = cmsOID(oidMessageDigest)
+	cmsAttributeSigningTime   = cmsOID(oidSigningTime)
+	// cmsAttributeExpires holds the expiry of a message as a GeneralizedTime.
+	cmsAttributeExpires = cmsArcaneOID(1)
+	// cmsAttributeMessageID holds the message ID as a UTF8String.
+	cmsAttributeMessageID = cmsArcaneOID(2)
+	// cmsAttributeClaims holds the claims as a SEQUENCE OF SEQUENCE { name UTF8String, value UTF8String }, sorted by
+	// name.
+	cmsAttributeClaims = cmsArcaneOID(3)
+	// cmsAttributeReceivers holds the SHA-256 fingerprints of the receiver certificates as a SEQUENCE OF OCTET STRING.
+	cmsAttributeReceivers = cmsArcaneOID(4)
+)
+
+// Context specific tags of CMS structures.
+var (
+	cmsTag0            = cbasn1.Tag(0).ContextSpecific()
+	cmsTag0Constructed = cbasn1.Tag(0).Constructed().ContextSpecific()
+	cmsTag1Constructed = cbasn1.Tag(1).Constructed().ContextSpecific()
+	cmsTag2Constructed = cbasn1.Tag(2).Constructed().ContextSpecific()
+	cmsTag3Constructed = cbasn1.Tag(3).Constructed().ContextSpecific()
+)
+
+// errInvalidCMSMessage is returned by OpenCMS if the message is not a CMS message as sealed by SealCMS.
+var errInvalidCMSMessage = errors.New("invalid cms message")
+
+// SealCMS encrypts and signs a payload like SealWithOptions, but encodes the message using CMS (RFC 5652) so it can be
+// processed by S/MIME tooling such as openssl cms using the same keys and certificates. The payload is signed in a
+// SignedData using the signature algorithm of the Sealer, with the sealer certificate and its chain in certificates
+// and the creation time in the signingTime attribute. The expiry, message ID, claims and the fingerprints of the
+// receiver certificates are held in signed attributes defined by arcane. The SignedData ContentInfo is encrypted as
+// data using AES-256-GCM in an AuthEnvelopedData (RFC 5083), the way S/MIME nests signed and encrypted content, with
+// the content key wrapped using RSAES-OAEP with SHA-256 for every receiver. As the encrypted content type is id-data,
+// openssl cms decrypts and verifies the message in two separate invocations. All receivers must have RSA keys. The
+// message is DER encoded, timestamps are truncated to whole seconds and metadata is not supported.
+func (s *Sealer) SealCMS(payload []byte, options SealOptions) ([]byte, error) {
+	if len(s.ReceiverCerts) == 0 {
+		return nil, errors.New("no receiver certificates")
+	}
+
+	if len(options.Metadata) > 0 {
+		return nil, errors.New("metadata is not supported by cms messages")
+	}
+
+	if err := validateClaims(currentVersion, options.Claims); err != nil {
+		return nil, err
+	}
+
+	signedData, err := s.cmsSignedData(payload, options.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmsAuthEnvelope(signedData, s.ReceiverCerts)
+}
+
+// cmsAuthEnvelope returns the DER encoded ContentInfo of an AuthEnvelopedData holding content for the receivers.
+func cmsAuthEnvelope(content []byte, receiverCerts []*x509.Certificate) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	var recipientInfos [][]byte
+	for _, cert := range receiverCerts {
+		recipientInfo, err := cmsKeyTransRecipientInfo(cert, key)
+		if err != nil {
+			return nil, err
+		}
+
+		recipientInfos = append(recipientInfos, recipientInfo)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, cmsNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nil, nonce, content, nil)
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(oidAuthEnvelopedData)
+		b.AddASN1(cmsTag0Constructed, func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1Int64(0)
+				b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+					for _, recipientInfo := range recipientInfos {
+						b.AddBytes(recipientInfo)
+					}
+				})
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					b.AddASN1ObjectIdentifier(oidData)
+					b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddASN1ObjectIdentifier(oidAES256GCM)
+						b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+							b.AddASN1OctetString(nonce)
+							b.AddASN1Int64(cmsTagSize)
+						})
+					})
+					b.AddASN1(cmsTag0, func(b *cryptobyte.Builder) {
+						b.AddBytes(sealed[:len(sealed)-cmsTagSize])
+					})
+				})
+				b.AddASN1OctetString(sealed[len(sealed)-cmsTagSize:])
+			})
+		})
+	})
+
+	return b.Bytes()
+}
+
+// cmsSignedData returns the DER encoded ContentInfo of the SignedData of a payload.
+func (s *Sealer) cmsSignedData(payload []byte, claims map[string]string) ([]byte, error) {
+	alg := s.SignatureAlgorithm
+	if alg == "" {
+		alg = defaultSignatureAlgorithm(s.PrivateKey)
+	}
+
+	messageID, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+
+	created := now().Truncate(time.Second)
+	digestAlgorithm, digest := cmsDigest(alg, payload)
+	attributes, err := cmsSignedAttributes(digest, created, created.Add(s.timeToLive()), messageID, claims, s.receiverFingerprints())
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(alg, s.PrivateKey, standardSigningInput(alg, cmsSet(attributes)))
+	if err != nil {
+		return nil, err
+	}
+
+	certs := append([]*x509.Certificate{s.Cert}, s.Chain...)
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(oidSignedData)
+		b.AddASN1(cmsTag0Constructed, func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1Int64(1)
+				b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+					addCMSAlgorithm(b, digestAlgorithm)
+				})
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					b.AddASN1ObjectIdentifier(oidData)
+					b.AddASN1(cmsTag0Constructed, func(b *cryptobyte.Builder) {
+						b.AddASN1OctetString(payload)
+					})
+				})
+				b.AddASN1(cmsTag0Constructed, func(b *cryptobyte.Builder) {
+					for _, cert := range certs {
+						b.AddBytes(cert.Raw)
+					}
+				})
+				b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+					b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddASN1Int64(1)
+						addCMSIssuerAndSerialNumber(b, s.Cert)
+						addCMSAlgorithm(b, digestAlgorithm)
+						b.AddASN1(cmsTag0Constructed, func(b *cryptobyte.Builder) {
+							for _, attribute := range attributes {
+								b.AddBytes(attribute)
+							}
+						})
+						addCMSSignatureAlgorithm(b, alg)
+						b.AddASN1OctetString(signature)
+					})
+				})
+			})
+		})
+	})
+
+	return b.Bytes()
+}
+
+// cmsSignedAttributes returns the DER encoded signed attributes of a message, sorted as required for a SET OF.
+func cmsSignedAttributes(digest []byte, created, expires time.Time, messageID string, claims map[string]string, receivers [][]byte) ([][]byte, error) {
+	values := map[string]cryptobyte.BuilderContinuation{
+		string(cmsAttributeContentType): func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(oidData)
+		},
+		string(cmsAttributeMessageDigest): func(b *cryptobyte.Builder) {
+			b.AddASN1OctetString(digest)
+		},
+		string(cmsAttributeSigningTime): func(b *cryptobyte.Builder) {
+			// Times from 1950 through 2049 must be encoded as UTCTime.
+			if created.UTC().Year() < 2050 {
+				b.AddASN1UTCTime(created.UTC())
+			} else {
+				b.AddASN1GeneralizedTime(created.UTC())
+			}
+		},
+		string(cmsAttributeExpires): func(b *cryptobyte.Builder) {
+			b.AddASN1GeneralizedTime(expires.UTC())
+		},
+		string(cmsAttributeMessageID): func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.UTF8String, func(b *cryptobyte.Builder) {
+				b.AddBytes([]byte(messageID))
+			})
+		},
+		string(cmsAttributeReceivers): func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				for _, fingerprint := range receivers {
+					b.AddASN1OctetString(fingerprint)
+				}
+			})
+		},
+	}
+
+	if len(claims) > 0 {
+		values[string(cmsAttributeClaims)] = func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				for _, name := range sortedClaimNames(claims) {
+					b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddASN1(cbasn1.UTF8String, func(b *cryptobyte.Builder) {
+							b.AddBytes([]byte(name))
+						})
+						b.AddASN1(cbasn1.UTF8String, func(b *cryptobyte.Builder) {
+							b.AddBytes([]byte(claims[name]))
+						})
+					})
+				}
+			})
+		}
+	}
+
+	var attributes [][]byte
+	for attributeType, value := range values {
+		var b cryptobyte.Builder
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(attributeType))
+			b.AddASN1(cbasn1.SET, value)
+		})
+
+		attribute, err := b.Bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		attributes = append(attributes, attribute)
+	}
+
+	sort.Slice(attributes, func(i, j int) bool {
+		return bytes.Compare(attributes[i], attributes[j]) < 0
+	})
+
+	return attributes, nil
+}
+
+// cmsKeyTransRecipientInfo returns a KeyTransRecipientInfo holding a content key wrapped for a receiver using
+// RSAES-OAEP with SHA-256. The receiver is identified like in Recipient: by its subject key identifier if the receiver
+// certificate has one, otherwise by issuer and serial number.
+func cmsKeyTransRecipientInfo(cert *x509.Certificate, key []byte) ([]byte, error) {
+	pubKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("receiver certificates must have rsa keys to seal a cms message")
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pubKey, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		if len(cert.SubjectKeyId) != 0 {
+			b.AddASN1Int64(2)
+			b.AddASN1(cmsTag0, func(b *cryptobyte.Builder) {
+				b.AddBytes(cert.SubjectKeyId)
+			})
+		} else {
+			b.AddASN1Int64(0)
+			addCMSIssuerAndSerialNumber(b, cert)
+		}
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(oidRSAESOAEP)
+			b.AddASN1(cbasn1.SEQUENCE, addCMSRSAHashes)
+		})
+		b.AddASN1OctetString(encryptedKey)
+	})
+
+	return b.Bytes()
+}
+
+// cmsDigest returns the digest algorithm used with a signature algorithm and the digest of content. Ed25519 is used
+// with SHA-512 as required by RFC 8419, the other algorithms with SHA-256.
+func cmsDigest(alg SignatureAlgorithm, content []byte) (asn1.ObjectIdentifier, []byte) {
+	if alg == EdDSA {
+		digest := sha512.Sum512(content)
+		return oidSHA512, digest[:]
+	}
+
+	digest := sha256.Sum256(content)
+
+	return oidSHA256, digest[:]
+}
+
+// addCMSAlgorithm adds an AlgorithmIdentifier without parameters.
+func addCMSAlgorithm(b *cryptobyte.Builder, oid asn1.ObjectIdentifier) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(oid)
+	})
+}
+
+// addCMSSignatureAlgorithm adds the AlgorithmIdentifier of a signature algorithm.
+func addCMSSignatureAlgorithm(b *cryptobyte.Builder, alg SignatureAlgorithm) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		switch alg {
+		case RS256:
+			b.AddASN1ObjectIdentifier(oidSHA256WithRSA)
+			b.AddASN1NULL()
+		case PS256:
+			b.AddASN1ObjectIdentifier(oidRSASSAPSS)
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				addCMSRSAHashes(b)
+				b.AddASN1(cmsTag2Constructed, func(b *cryptobyte.Builder) {
+					b.AddASN1Int64(cmsPSSSaltLength)
+				})
+			})
+		case ES256:
+			b.AddASN1ObjectIdentifier(oidECDSAWithSHA256)
+		case EdDSA:
+			b.AddASN1ObjectIdentifier(oidEd25519)
+		default:
+			b.SetError(errors.New("unsupported signature algorithm"))
+		}
+	})
+}
+
+// addCMSRSAHashes adds the hash algorithm and mask generation function shared by the RSASSA-PSS and RSAES-OAEP
+// parameters: SHA-256 and MGF1 with SHA-256.
+func addCMSRSAHashes(b *cryptobyte.Builder) {
+	b.AddASN1(cmsTag0Constructed, func(b *cryptobyte.Builder) {
+		addCMSAlgorithm(b, oidSHA256)
+	})
+	b.AddASN1(cmsTag1Constructed, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(oidMGF1)
+			addCMSAlgorithm(b, oidSHA256)
+		})
+	})
+}
+
+// addCMSIssuerAndSerialNumber adds the IssuerAndSerialNumber identifying a certificate.
+func addCMSIssuerAndSerialNumber(b *cryptobyte.Builder, cert *x509.Certificate) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddBytes(cert.RawIssuer)
+		b.AddASN1BigInt(cert.SerialNumber)
+	})
+}
+
+// cmsSet returns the DER encoding of a SET OF holding elements that are already sorted. Signed attributes are
+// signed, and authenticated attributes authenticated, in this encoding.
+func cmsSet(elements [][]byte) []byte {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+		for _, element := range elements {
+			b.AddBytes(element)
+		}
+	})
+
+	return b.BytesOrPanic()
+}
+
+// cmsOID returns the DER encoding of an object identifier.
+func cmsOID(oid asn1.ObjectIdentifier) []byte {
+	var b cryptobyte.Builder
+	b.AddASN1ObjectIdentifier(oid)
+
+	return b.BytesOrPanic()
+}
+
+// cmsArcaneOID returns the DER encoding of the object identifier 2.25.<cmsArcaneUUID>.arc. The UUID arc does not fit
+// the integers of encoding/asn1.
+func cmsArcaneOID(arc int64) []byte {
+	uuid, _ := new(big.Int).SetString(cmsArcaneUUID, 16)
+	content := []byte{2*40 + 25}
+	content = appendBase128(content, uuid)
+	content = appendBase128(content, big.NewInt(arc))
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.OBJECT_IDENTIFIER, func(b *cryptobyte.Builder) {
+		b.AddBytes(content)
+	})
+
+	return b.BytesOrPanic()
+}
+
+// appendBase128 appends the base 128 encoding of an object identifier arc to b.
+func appendBase128(b []byte, n *big.Int) []byte {
+	var groups []byte
+	n = new(big.Int).Set(n)
+	for {
+		groups = append(groups, byte(n.Uint64()&0x7f))
+		if n.Rsh(n, 7).Sign() == 0 {
+			break
+		}
+	}
+
+	for i := len(groups) - 1; i > 0; i-- {
+		b = append(b, groups[i]|0x80)
+	}
+
+	return append(b, groups[0])
+}
+
+// OpenCMS opens a DER encoded message sealed using SealCMS. The same rules as for Open apply: the sealer certificate
+// must chain to CertPool, must not be revoked and must be allowed by the SenderPolicy, the message must not be expired,
+// must be signed for the Opener certificate and the signature algorithm must be accepted. Messages without a message
+// ID are rejected if replay protection is enabled. The SignedData must carry the expiry attribute of arcane, so
+// messages signed by other CMS implementations are rejected. Suites do not apply to CMS messages. CMS messages carry
+// no stapled OCSP response, so they are rejected with ErrRevocationUnknown if RequireOCSP is set.
+func (o *Opener) OpenCMS(message []byte) ([]byte, *OpenInfo, error) {
+	if err := o.checkPrivateKey(); err != nil {
+		return nil, nil, err
+	}
+
+	enveloped, err := parseCMSAuthEnvelopedData(message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := o.cmsContentKey(enveloped.recipientInfos)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signedData, err := enveloped.decrypt(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return o.openCMSSignedData(signedData)
+}
+
+// cmsAuthEnvelopedData is a parsed AuthEnvelopedData.
+type cmsAuthEnvelopedData struct {
+	recipientInfos   cryptobyte.String
+	nonce            []byte
+	tagSize          int
+	encryptedContent []byte
+	// authAttrs is the DER encoding of the authenticated attributes as a SET OF, or nil if there are none.
+	authAttrs []byte
+	mac       []byte
+}
+
+// parseCMSAuthEnvelopedData parses the ContentInfo of an AuthEnvelopedData encrypting data using AES-256-GCM.
+func parseCMSAuthEnvelopedData(message []byte) (*cmsAuthEnvelopedData, error) {
+	input := cryptobyte.String(message)
+	var contentInfo, content, enveloped cryptobyte.String
+	var contentType asn1.ObjectIdentifier
+	if !input.ReadASN1(&contentInfo, cbasn1.SEQUENCE) || !input.Empty() ||
+		!contentInfo.ReadASN1ObjectIdentifier(&contentType) || !contentType.Equal(oidAuthEnvelopedData) ||
+		!contentInfo.ReadASN1(&content, cmsTag0Constructed) || !contentInfo.Empty() ||
+		!content.ReadASN1(&enveloped, cbasn1.SEQUENCE) || !content.Empty() {
+		return nil, errInvalidCMSMessage
+	}
+
+	e := &cmsAuthEnvelopedData{}
+	var version int64
+	var encryptedContentInfo, authAttrs cryptobyte.String
+	var hasAuthAttrs bool
+	if !enveloped.ReadASN1Int64WithTag(&version, cbasn1.INTEGER) || version != 0 ||
+		!enveloped.SkipOptionalASN1(cmsTag0Constructed) ||
+		!enveloped.ReadASN1(&e.recipientInfos, cbasn1.SET) ||
+		!enveloped.ReadASN1(&encryptedContentInfo, cbasn1.SEQUENCE) ||
+		!enveloped.ReadOptionalASN1(&authAttrs, &hasAuthAttrs, cmsTag1Constructed) ||
+		!enveloped.ReadASN1Bytes(&e.mac, cbasn1.OCTET_STRING) ||
+		!enveloped.SkipOptionalASN1(cmsTag2Constructed) || !enveloped.Empty() {
+		return nil, errInvalidCMSMessage
+	}
+
+	var contentEncryptionAlgorithm, parameters cryptobyte.String
+	var algorithm asn1.ObjectIdentifier
+	if !encryptedContentInfo.ReadASN1ObjectIdentifier(&contentType) || !contentType.Equal(oidData) ||
+		!encryptedContentInfo.ReadASN1(&contentEncryptionAlgorithm, cbasn1.SEQUENCE) ||
+		!encryptedContentInfo.ReadASN1Bytes(&e.encryptedContent, cmsTag0) || !encryptedContentInfo.Empty() ||
+		!contentEncryptionAlgorithm.ReadASN1ObjectIdentifier(&algorithm) || !algorithm.Equal(oidAES256GCM) ||
+		!contentEncryptionAlgorithm.ReadASN1(&parameters, cbasn1.SEQUENCE) || !contentEncryptionAlgorithm.Empty() ||
+		!parameters.ReadASN1Bytes(&e.nonce, cbasn1.OCTET_STRING) {
+		return nil, errInvalidCMSMessage
+	}
+
+	// The size of the authentication tag defaults to 12.
+	e.tagSize = 12
+	if parameters.PeekASN1Tag(cbasn1.INTEGER) && !parameters.ReadASN1Integer(&e.tagSize) || !parameters.Empty() {
+		return nil, errInvalidCMSMessage
+	}
+
+	if len(e.nonce) != cmsNonceSize || e.tagSize < 12 || e.tagSize > 16 || len(e.mac) != e.tagSize {
+		return nil, errInvalidCMSMessage
+	}
+
+	if hasAuthAttrs {
+		var b cryptobyte.Builder
+		b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+			b.AddBytes(authAttrs)
+		})
+		e.authAttrs = b.BytesOrPanic()
+	}
+
+	return e, nil
+}
+
+// decrypt decrypts the content of the AuthEnvelopedData, authenticating the authenticated attributes along with it.
+func (e *cmsAuthEnvelopedData) decrypt(key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	aead, err := cipher.NewGCMWithTagSize(block, e.tagSize)
+	if err != nil {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	sealed := append(append([]byte{}, e.encryptedContent...), e.mac...)
+	plaintext, err := aead.Open(nil, e.nonce, sealed, e.authAttrs)
+	if err != nil {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	return plaintext, nil
+}
+
+// cmsContentKey unwraps the content key from the KeyTransRecipientInfo addressed to the Opener. Other kinds of
+// RecipientInfo are skipped.
+func (o *Opener) cmsContentKey(recipientInfos cryptobyte.String) ([]byte, error) {
+	if o.Cert == nil {
+		return nil, ErrNotRecipient
+	}
+
+	for !recipientInfos.Empty() {
+		var recipientInfo cryptobyte.String
+		var tag cbasn1.Tag
+		if !recipientInfos.ReadAnyASN1(&recipientInfo, &tag) {
+			return nil, errInvalidCMSMessage
+		}
+
+		// KeyTransRecipientInfo is the only kind of RecipientInfo that is not tagged.
+		if tag != cbasn1.SEQUENCE {
+			continue
+		}
+
+		var version int64
+		var rid Recipient
+		var keyEncryptionAlgorithm, parameters cryptobyte.String
+		var algorithm asn1.ObjectIdentifier
+		var encryptedKey []byte
+		if !recipientInfo.ReadASN1Int64WithTag(&version, cbasn1.INTEGER) || !readCMSIdentifier(&recipientInfo, &rid) ||
+			!recipientInfo.ReadASN1(&keyEncryptionAlgorithm, cbasn1.SEQUENCE) ||
+			!recipientInfo.ReadASN1Bytes(&encryptedKey, cbasn1.OCTET_STRING) || !recipientInfo.Empty() ||
+			!keyEncryptionAlgorithm.ReadASN1ObjectIdentifier(&algorithm) {
+			return nil, errInvalidCMSMessage
+		}
+
+		if !rid.matches(o.Cert) {
+			continue
+		}
+
+		if !algorithm.Equal(oidRSAESOAEP) || !keyEncryptionAlgorithm.ReadASN1(&parameters, cbasn1.SEQUENCE) ||
+			!keyEncryptionAlgorithm.Empty() || !readCMSRSAHashes(&parameters) || !readCMSEmptyLabel(&parameters) ||
+			!parameters.Empty() {
+			return nil, ErrUnsupportedKeyWrap
+		}
+
+		decrypter, ok := o.rsaDecrypter()
+		if !ok {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		key, err := decrypter.Decrypt(rand.Reader, encryptedKey, &rsa.OAEPOptions{Hash: crypto.SHA256})
+		if err != nil || len(key) != 32 {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		return key, nil
+	}
+
+	return nil, ErrNotRecipient
+}
+
+// readCMSIdentifier reads the identifier of a certificate in a RecipientInfo or SignerInfo, either an
+// IssuerAndSerialNumber or a subject key identifier, into the fields of a Recipient used to match certificates.
+func readCMSIdentifier(s *cryptobyte.String, id *Recipient) bool {
+	if s.PeekASN1Tag(cmsTag0) {
+		return s.ReadASN1Bytes(&id.SubjectKeyID, cmsTag0) && len(id.SubjectKeyID) != 0
+	}
+
+	var issuerAndSerialNumber, issuer cryptobyte.String
+	id.SerialNumber = new(big.Int)
+	if !s.ReadASN1(&issuerAndSerialNumber, cbasn1.SEQUENCE) ||
+		!issuerAndSerialNumber.ReadASN1Element(&issuer, cbasn1.SEQUENCE) ||
+		!issuerAndSerialNumber.ReadASN1Integer(id.SerialNumber) || !issuerAndSerialNumber.Empty() {
+		return false
+	}
+	id.Issuer = issuer
+
+	return true
+}
+
+// readCMSAlgorithm reads an AlgorithmIdentifier, reporting whether it is oid with absent or NULL parameters.
+func readCMSAlgorithm(s *cryptobyte.String, oid asn1.ObjectIdentifier) bool {
+	var algorithm cryptobyte.String
+	var algorithmOID asn1.ObjectIdentifier
+	if !s.ReadASN1(&algorithm, cbasn1.SEQUENCE) || !algorithm.ReadASN1ObjectIdentifier(&algorithmOID) ||
+		!algorithmOID.Equal(oid) {
+		return false
+	}
+
+	return algorithm.Empty() || (algorithm.SkipASN1(cbasn1.NULL) && algorithm.Empty())
+}
+
+// readCMSRSAHashes reads the hash algorithm and mask generation function of RSASSA-PSS or RSAES-OAEP parameters,
+// reporting whether they are SHA-256 and MGF1 with SHA-256.
+func readCMSRSAHashes(parameters *cryptobyte.String) bool {
+	var hashAlgorithm, maskGenAlgorithm, mgf cryptobyte.String
+	var mgfOID asn1.ObjectIdentifier
+
+	return parameters.ReadASN1(&hashAlgorithm, cmsTag0Constructed) &&
+		readCMSAlgorithm(&hashAlgorithm, oidSHA256) && hashAlgorithm.Empty() &&
+		parameters.ReadASN1(&maskGenAlgorithm, cmsTag1Constructed) &&
+		maskGenAlgorithm.ReadASN1(&mgf, cbasn1.SEQUENCE) && maskGenAlgorithm.Empty() &&
+		mgf.ReadASN1ObjectIdentifier(&mgfOID) && mgfOID.Equal(oidMGF1) &&
+		readCMSAlgorithm(&mgf, oidSHA256) && mgf.Empty()
+}
+
+// readCMSEmptyLabel reads the optional label source of RSAES-OAEP parameters, reporting whether the label is empty.
+func readCMSEmptyLabel(parameters *cryptobyte.String) bool {
+	var pSourceAlgorithm, pSource cryptobyte.String
+	var present bool
+	if !parameters.ReadOptionalASN1(&pSourceAlgorithm, &present, cmsTag2Constructed) {
+		return false
+	}
+	if !present {
+		return true
+	}
+
+	var pSourceOID asn1.ObjectIdentifier
+	var label []byte
+
+	return pSourceAlgorithm.ReadASN1(&pSource, cbasn1.SEQUENCE) && pSourceAlgorithm.Empty() &&
+		pSource.ReadASN1ObjectIdentifier(&pSourceOID) && pSourceOID.Equal(oidPSpecified) &&
+		pSource.ReadASN1Bytes(&label, cbasn1.OCTET_STRING) && len(label) == 0 && pSource.Empty()
+}
+
+// openCMSSignedData verifies the SignedData decrypted from an AuthEnvelopedData and returns its content.
+func (o *Opener) openCMSSignedData(der []byte) ([]byte, *OpenInfo, error) {
+	input := cryptobyte.String(der)
+	var contentInfo, content, signedData cryptobyte.String
+	var contentType asn1.ObjectIdentifier
+	if !input.ReadASN1(&contentInfo, cbasn1.SEQUENCE) || !input.Empty() ||
+		!contentInfo.ReadASN1ObjectIdentifier(&contentType) || !contentType.Equal(oidSignedData) ||
+		!contentInfo.ReadASN1(&content, cmsTag0Constructed) || !contentInfo.Empty() ||
+		!content.ReadASN1(&signedData, cbasn1.SEQUENCE) || !content.Empty() {
+		return nil, nil, errInvalidCMSMessage
+	}
+
+	// The digest algorithms of SignedData are only a hint, the digest algorithm of the signer is checked against its
+	// signature algorithm. Revocation lists are not used, revocation is checked by the Opener.
+	var version int64
+	var encapContentInfo, certificates, signerInfos, signerInfo cryptobyte.String
+	var hasCertificates bool
+	if !signedData.ReadASN1Int64WithTag(&version, cbasn1.INTEGER) ||
+		!signedData.SkipASN1(cbasn1.SET) ||
+		!signedData.ReadASN1(&encapContentInfo, cbasn1.SEQUENCE) ||
+		!signedData.ReadOptionalASN1(&certificates, &hasCertificates, cmsTag0Constructed) ||
+		!signedData.SkipOptionalASN1(cmsTag1Constructed) ||
+		!signedData.ReadASN1(&signerInfos, cbasn1.SET) || !signedData.Empty() ||
+		!signerInfos.ReadASN1(&signerInfo, cbasn1.SEQUENCE) || !signerInfos.Empty() {
+		return nil, nil, errInvalidCMSMessage
+	}
+
+	// Detached content is not supported.
+	var eContent cryptobyte.String
+	var payload []byte
+	if !encapContentInfo.ReadASN1ObjectIdentifier(&contentType) || !contentType.Equal(oidData) ||
+		!encapContentInfo.ReadASN1(&eContent, cmsTag0Constructed) || !encapContentInfo.Empty() ||
+		!eContent.ReadASN1Bytes(&payload, cbasn1.OCTET_STRING) || !eContent.Empty() {
+		return nil, nil, errInvalidCMSMessage
+	}
+
+	signer, err := parseCMSSignerInfo(signerInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, err := signer.signedMessage(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if message.certs, err = cmsSignerCerts(certificates, &signer.sid); err != nil {
+		return nil, nil, err
+	}
+
+	info, err := o.openSigned(message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payload, info, nil
+}
+
+// cmsSignerInfo is a parsed SignerInfo.
+type cmsSignerInfo struct {
+	sid Recipient
+	alg SignatureAlgorithm
+	// digestAlgorithm is the digest algorithm of the signer, which must match its signature algorithm.
+	digestAlgorithm asn1.ObjectIdentifier
+	// attributes maps the DER encoded types of the signed attributes to their values.
+	attributes map[string]cryptobyte.String
+	// signedAttrs is the DER encoding of the signed attributes as a SET OF, which is what is signed.
+	signedAttrs []byte
+	signature   []byte
+}
+
+// parseCMSSignerInfo parses a SignerInfo with signed attributes.
+func parseCMSSignerInfo(s cryptobyte.String) (*cmsSignerInfo, error) {
+	signer := &cmsSignerInfo{attributes: make(map[string]cryptobyte.String)}
+	var version int64
+	var digestAlgorithm, signedAttrs, signatureAlgorithm cryptobyte.String
+	if !s.ReadASN1Int64WithTag(&version, cbasn1.INTEGER) || !readCMSIdentifier(&s, &signer.sid) ||
+		!s.ReadASN1(&digestAlgorithm, cbasn1.SEQUENCE) || !digestAlgorithm.ReadASN1ObjectIdentifier(&signer.digestAlgorithm) ||
+		!s.ReadASN1(&signedAttrs, cmsTag0Constructed) ||
+		!s.ReadASN1(&signatureAlgorithm, cbasn1.SEQUENCE) ||
+		!s.ReadASN1Bytes(&signer.signature, cbasn1.OCTET_STRING) ||
+		!s.SkipOptionalASN1(cmsTag1Constructed) || !s.Empty() {
+		return nil, errInvalidCMSMessage
+	}
+
+	// The version is 1 if the signer is identified by issuer and serial number, and 3 by subject key identifier.
+	if signer.sid.SerialNumber != nil && version != 1 || signer.sid.SerialNumber == nil && version != 3 {
+		return nil, errInvalidCMSMessage
+	}
+
+	var attributes [][]byte
+	for !signedAttrs.Empty() {
+		var element, attribute, attributeType, values cryptobyte.String
+		if !signedAttrs.ReadASN1Element(&element, cbasn1.SEQUENCE) {
+			return nil, errInvalidCMSMessage
+		}
+		attributes = append(attributes, element)
+
+		if !element.ReadASN1(&attribute, cbasn1.SEQUENCE) ||
+			!attribute.ReadASN1Element(&attributeType, cbasn1.OBJECT_IDENTIFIER) ||
+			!attribute.ReadASN1(&values, cbasn1.SET) || !attribute.Empty() {
+			return nil, errInvalidCMSMessage
+		}
+
+		if _, exists := signer.attributes[string(attributeType)]; exists {
+			return nil, errInvalidCMSMessage
+		}
+		signer.attributes[string(attributeType)] = values
+	}
+	signer.signedAttrs = cmsSet(attributes)
+
+	alg, err := cmsSignatureAlgorithm(signatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	signer.alg = alg
+
+	return signer, nil
+}
+
+// cmsSignatureAlgorithm returns the signature algorithm identified by the content of an AlgorithmIdentifier. RSA
+// PKCS #1 v1.5 signatures are accepted with both the rsaEncryption and sha256WithRSAEncryption identifiers, and
+// RSASSA-PSS signatures only with the parameters used by PS256.
+func cmsSignatureAlgorithm(algorithm cryptobyte.String) (SignatureAlgorithm, error) {
+	var oid asn1.ObjectIdentifier
+	if !algorithm.ReadASN1ObjectIdentifier(&oid) {
+		return "", errInvalidCMSMessage
+	}
+
+	var alg SignatureAlgorithm
+	switch {
+	case oid.Equal(oidRSAEncryption), oid.Equal(oidSHA256WithRSA):
+		if !algorithm.Empty() && (!algorithm.SkipASN1(cbasn1.NULL) || !algorithm.Empty()) {
+			return "", ErrUnsupportedSignatureAlgorithm
+		}
+		alg = RS256
+	case oid.Equal(oidRSASSAPSS):
+		var parameters, saltLength cryptobyte.String
+		var salt int64
+		if !algorithm.ReadASN1(&parameters, cbasn1.SEQUENCE) || !algorithm.Empty() || !readCMSRSAHashes(&parameters) ||
+			!parameters.ReadASN1(&saltLength, cmsTag2Constructed) ||
+			!saltLength.ReadASN1Int64WithTag(&salt, cbasn1.INTEGER) || salt != cmsPSSSaltLength ||
+			!parameters.SkipOptionalASN1(cmsTag3Constructed) || !parameters.Empty() {
+			return "", ErrUnsupportedSignatureAlgorithm
+		}
+		alg = PS256
+	case oid.Equal(oidECDSAWithSHA256):
+		alg = ES256
+	case oid.Equal(oidEd25519):
+		alg = EdDSA
+	default:
+		return "", ErrUnsupportedSignatureAlgorithm
+	}
+
+	return alg, nil
+}
+
+// signedMessage returns what the SignerInfo asserts about the content, except for the certificates of the signer.
+func (signer *cmsSignerInfo) signedMessage(content []byte) (*signedMessage, error) {
+	digestAlgorithm, digest := cmsDigest(signer.alg, content)
+	if !signer.digestAlgorithm.Equal(digestAlgorithm) {
+		return nil, ErrUnsupportedSignatureAlgorithm
+	}
+
+	m := &signedMessage{alg: signer.alg, signingInput: signer.signedAttrs, signature: signer.signature}
+	if m.alg == ES256 {
+		var err error
+		if m.signature, err = ecdsaSignatureToRaw(m.signature); err != nil {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	var contentType asn1.ObjectIdentifier
+	var messageDigest []byte
+	value, ok := signer.attribute(cmsAttributeContentType)
+	if !ok || !value.ReadASN1ObjectIdentifier(&contentType) || !contentType.Equal(oidData) {
+		return nil, errInvalidCMSMessage
+	}
+
+	value, ok = signer.attribute(cmsAttributeMessageDigest)
+	if !ok || !value.ReadASN1Bytes(&messageDigest, cbasn1.OCTET_STRING) {
+		return nil, errInvalidCMSMessage
+	}
+
+	if !bytes.Equal(messageDigest, digest) {
+		return nil, ErrInvalidSignature
+	}
+
+	value, ok = signer.attribute(cmsAttributeSigningTime)
+	if !ok || !(value.PeekASN1Tag(cbasn1.UTCTime) && value.ReadASN1UTCTime(&m.created) ||
+		value.ReadASN1GeneralizedTime(&m.created)) {
+		return nil, errInvalidCMSMessage
+	}
+
+	value, ok = signer.attribute(cmsAttributeExpires)
+	if !ok || !value.ReadASN1GeneralizedTime(&m.expires) {
+		return nil, errInvalidCMSMessage
+	}
+
+	if value, ok = signer.attribute(cmsAttributeMessageID); ok {
+		var messageID cryptobyte.String
+		if !value.ReadASN1(&messageID, cbasn1.UTF8String) || !utf8.Valid(messageID) {
+			return nil, errInvalidCMSMessage
+		}
+		m.messageID = string(messageID)
+	}
+
+	if value, ok = signer.attribute(cmsAttributeReceivers); ok {
+		if m.receivers, ok = readCMSReceivers(value); !ok {
+			return nil, errInvalidCMSMessage
+		}
+	}
+
+	if value, ok = signer.attribute(cmsAttributeClaims); ok {
+		if m.claims, ok = readCMSClaims(value); !ok {
+			return nil, errInvalidCMSMessage
+		}
+
+		if err := validateClaims(currentVersion, m.claims); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// attribute returns the value of a signed attribute, or false if the attribute is absent or has more than one value.
+func (signer *cmsSignerInfo) attribute(attributeType []byte) (cryptobyte.String, bool) {
+	values, ok := signer.attributes[string(attributeType)]
+	var value cryptobyte.String
+	var tag cbasn1.Tag
+	if !ok || !values.ReadAnyASN1Element(&value, &tag) || !values.Empty() {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// readCMSClaims reads the value of the claims attribute.
+func readCMSClaims(value cryptobyte.String) (map[string]string, bool) {
+	var sequence cryptobyte.String
+	if !value.ReadASN1(&sequence, cbasn1.SEQUENCE) || !value.Empty() {
+		return nil, false
+	}
+
+	claims := make(map[string]string)
+	for !sequence.Empty() {
+		var claim, name, claimValue cryptobyte.String
+		if !sequence.ReadASN1(&claim, cbasn1.SEQUENCE) || !claim.ReadASN1(&name, cbasn1.UTF8String) ||
+			!claim.ReadASN1(&claimValue, cbasn1.UTF8String) || !claim.Empty() ||
+			!utf8.Valid(name) || !utf8.Valid(claimValue) {
+			return nil, false
+		}
+
+		if _, exists := claims[string(name)]; exists {
+			return nil, false
+		}
+		claims[string(name)] = string(claimValue)
+	}
+
+	return claims, true
+}
+
+// readCMSReceivers reads the value of the receivers attribute.
+func readCMSReceivers(value cryptobyte.String) ([][]byte, bool) {
+	var sequence cryptobyte.String
+	if !value.ReadASN1(&sequence, cbasn1.SEQUENCE) || !value.Empty() {
+		return nil, false
+	}
+
+	var receivers [][]byte
+	for !sequence.Empty() {
+		var fingerprint []byte
+		if !sequence.ReadASN1Bytes(&fingerprint, cbasn1.OCTET_STRING) {
+			return nil, false
+		}
+		receivers = append(receivers, fingerprint)
+	}
+
+	return receivers, true
+}
+
+// cmsSignerCerts returns the certificate of a signer, followed by the other certificates of the SignedData as its
+// intermediates. Certificates in other formats than X.509 are ignored.
+func cmsSignerCerts(certificates cryptobyte.String, sid *Recipient) ([][]byte, error) {
+	var signerCert []byte
+	var intermediates [][]byte
+	for !certificates.Empty() {
+		var cert cryptobyte.String
+		var tag cbasn1.Tag
+		if !certificates.ReadAnyASN1Element(&cert, &tag) {
+			return nil, errInvalidCMSMessage
+		}
+
+		if tag != cbasn1.SEQUENCE {
+			continue
+		}
+
+		parsed, err := x509.ParseCertificate(cert)
+		if err != nil {
+			return nil, ErrUnableToParseSealerCert
+		}
+
+		if signerCert == nil && sid.matches(parsed) {
+			signerCert = cert
+			continue
+		}
+
+		if len(intermediates) == maxSealerChainLength {
+			return nil, ErrUntrustedCert
+		}
+		intermediates = append(intermediates, cert)
+	}
+
+	if signerCert == nil {
+		return nil, ErrUnableToParseSealerCert
+	}
+
+	return append([][]byte{signerCert}, intermediates...), nil
+}
@@ -0,0 +1,285 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+func TestSealer_SealCMS(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name    string
+		sealer  *Sealer
+		opener  *Opener
+		options SealOptions
+	}{
+		{
+			name:   "RSA",
+			sealer: &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+		},
+		{
+			name:   "Multiple receivers",
+			sealer: &Sealer{PrivateKey: signedPk1, Cert: signedCert1, SignatureAlgorithm: PS256, ReceiverCerts: []*x509.Certificate{signedCert2, signedCert3}},
+			opener: &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+		},
+		{
+			name:   "ECDSA sealer",
+			sealer: &Sealer{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+		},
+		{
+			name:   "Ed25519 sealer",
+			sealer: &Sealer{PrivateKey: ed25519Pk, Cert: ed25519Cert, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+		},
+		{
+			name:   "Chain and claims",
+			sealer: &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			options: SealOptions{
+				Claims: map[string]string{"tenantId": "tenant-1", "role": "batch"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		message, err := test.sealer.SealCMS([]byte("This is a test payload."), test.options)
+		assert.NoError(t, err, test.name)
+
+		payload, info, err := test.opener.OpenCMS(message)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+		if assert.NotNil(t, info, test.name) {
+			assert.Equal(t, test.sealer.Cert, info.SealerCert, test.name)
+			assert.True(t, validMessageID(info.MessageID), test.name)
+			assert.Equal(t, test.options.Claims, info.Claims, test.name)
+			assert.True(t, now().Equal(info.Created), test.name)
+			assert.True(t, now().Add(5*time.Minute).Equal(info.Expires), test.name)
+		}
+	}
+
+	_, err := (&Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{ecdsaCert1}}).SealCMS([]byte("This is a test payload."), SealOptions{})
+	assert.Error(t, err)
+}
+
+func TestOpener_OpenCMS(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	message, err := sealer.SealCMS([]byte("This is a test payload."), SealOptions{})
+	assert.NoError(t, err)
+
+	// The authentication tag is the last field of the message.
+	tampered := append([]byte{}, message...)
+	tampered[len(tampered)-1] ^= 1
+
+	// A receiver can encrypt the SignedData for someone else, but not change the receivers it is signed for.
+	enveloped, err := parseCMSAuthEnvelopedData(message)
+	assert.NoError(t, err)
+	key, err := (&Opener{PrivateKey: signedPk2, Cert: signedCert2}).cmsContentKey(enveloped.recipientInfos)
+	assert.NoError(t, err)
+	signedData, err := enveloped.decrypt(key)
+	assert.NoError(t, err)
+	forwarded, err := cmsAuthEnvelope(signedData, []*x509.Certificate{signedCert3})
+	assert.NoError(t, err)
+
+	replayCache := NewMemoryReplayCache()
+	_, _, err = (&Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: replayCache}).OpenCMS(message)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		opener      *Opener
+		message     []byte
+		now         time.Time
+		expectedErr error
+	}{
+		{
+			name:        "Not recipient",
+			opener:      &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+			message:     message,
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Forwarded",
+			opener:      &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+			message:     forwarded,
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Untrusted",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			message:     message,
+			expectedErr: ErrUntrustedCert,
+		},
+		{
+			name:        "Expired",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message:     message,
+			now:         now().Add(6 * time.Minute),
+			expectedErr: ErrMessageExpired,
+		},
+		{
+			name:        "Not yet valid",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message:     message,
+			now:         now().Add(-time.Minute),
+			expectedErr: ErrMessageNotYetValid,
+		},
+		{
+			name:        "Signature algorithm not allowed",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, SignatureAlgorithms: []SignatureAlgorithm{ES256}},
+			message:     message,
+			expectedErr: ErrUnsupportedSignatureAlgorithm,
+		},
+		{
+			name:        "OCSP required",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, RequireOCSP: true},
+			message:     message,
+			expectedErr: ErrRevocationUnknown,
+		},
+		{
+			name:        "Replayed",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: replayCache},
+			message:     message,
+			expectedErr: ErrReplayedMessage,
+		},
+		{
+			name:        "Tampered",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message:     tampered,
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Trailing data",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message:     append(append([]byte{}, message...), 0),
+			expectedErr: errInvalidCMSMessage,
+		},
+		{
+			name:        "Not CMS",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message:     []byte("This is a test payload."),
+			expectedErr: errInvalidCMSMessage,
+		},
+	}
+
+	sealed := now()
+	for _, test := range tests {
+		if !test.now.IsZero() {
+			setNow(t, test.now)
+		}
+
+		_, _, err := test.opener.OpenCMS(test.message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+
+		setNow(t, sealed)
+	}
+}
+
+func TestCMSArcaneOID(t *testing.T) {
+	// 2.25.56471105684210855213273076771661259766.1
+	assert.Equal(t, hexDecode(t, "061469d4fbf89e9983a2b1b18fa7cadb989eeec77601"), cmsArcaneOID(1))
+}
+
+func TestParseCMSSignerInfo(t *testing.T) {
+	signerInfo := func(version int64, subjectKeyID bool) []byte {
+		var b cryptobyte.Builder
+		b.AddASN1Int64(version)
+		if subjectKeyID {
+			b.AddASN1(cmsTag0, func(b *cryptobyte.Builder) {
+				b.AddBytes([]byte{1, 2, 3, 4})
+			})
+		} else {
+			addCMSIssuerAndSerialNumber(&b, signedCert1)
+		}
+		addCMSAlgorithm(&b, oidSHA256)
+		b.AddASN1(cmsTag0Constructed, func(b *cryptobyte.Builder) {})
+		addCMSSignatureAlgorithm(&b, RS256)
+		b.AddASN1OctetString([]byte{1})
+		return b.BytesOrPanic()
+	}
+
+	tests := []struct {
+		name         string
+		version      int64
+		subjectKeyID bool
+		expectedErr  error
+	}{
+		{name: "Issuer and serial number", version: 1},
+		{name: "Subject key identifier", version: 3, subjectKeyID: true},
+		{name: "Issuer and serial number with version 3", version: 3, expectedErr: errInvalidCMSMessage},
+		{name: "Subject key identifier with version 1", version: 1, subjectKeyID: true, expectedErr: errInvalidCMSMessage},
+		{name: "Unknown version", version: 2, expectedErr: errInvalidCMSMessage},
+	}
+
+	for _, test := range tests {
+		_, err := parseCMSSignerInfo(cryptobyte.String(signerInfo(test.version, test.subjectKeyID)))
+		assert.Equal(t, test.expectedErr, err, test.name)
+	}
+}
+
+// TestSealer_SealCMSOpenSSL checks that openssl can decrypt and verify messages sealed using SealCMS, and that OpenCMS
+// can decrypt messages encrypted by openssl.
+func TestSealer_SealCMSOpenSSL(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+
+	setNow(t, sealTime)
+
+	// The test certificates are expired, so openssl verifies them at the time the message is sealed.
+	attime := "1606412276"
+	openssl := func(stdin []byte, args ...string) []byte {
+		cmd := exec.Command("openssl", args...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		assert.NoError(t, err, stderr.String())
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		sealer *Sealer
+	}{
+		{
+			name:   "RS256",
+			sealer: &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}},
+		},
+		{
+			name:   "PS256 with chain",
+			sealer: &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, SignatureAlgorithm: PS256, ReceiverCerts: []*x509.Certificate{signedCert2}},
+		},
+	}
+
+	for _, test := range tests {
+		message, err := test.sealer.SealCMS([]byte("This is a test payload."), SealOptions{Claims: map[string]string{"tenantId": "tenant-1"}})
+		assert.NoError(t, err, test.name)
+
+		signedData := openssl(message, "cms", "-decrypt", "-inform", "DER", "-recip", "test/data/signed2.crt", "-inkey", "test/data/signed2.key")
+		payload := openssl(signedData, "cms", "-verify", "-inform", "DER", "-CAfile", "test/data/ca2.crt", "-attime", attime, "-purpose", "any")
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+	}
+
+	// openssl does not sign the attributes required by OpenCMS, but the envelope it produces can be decrypted.
+	encrypted := openssl([]byte("This is a test payload."), "cms", "-encrypt", "-outform", "DER", "-aes-256-gcm",
+		"-recip", "test/data/signed2.crt", "-keyopt", "rsa_padding_mode:oaep", "-keyopt", "rsa_oaep_md:sha256")
+	enveloped, err := parseCMSAuthEnvelopedData(encrypted)
+	if assert.NoError(t, err) {
+		key, err := (&Opener{PrivateKey: signedPk2, Cert: signedCert2}).cmsContentKey(enveloped.recipientInfos)
+		assert.NoError(t, err)
+		plaintext, err := enveloped.decrypt(key)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("This is a test payload."), plaintext)
+	}
+}
@@ -0,0 +1,852 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"io"
+	"time"
+)
+
+// COSE tags from RFC 9052.
+const (
+	coseTagSign1   = 18
+	coseTagEncrypt = 96
+)
+
+// COSE header labels from RFC 9052 and RFC 9360.
+const (
+	coseHeaderAlgorithm    int64 = 1
+	coseHeaderIV           int64 = 5
+	coseHeaderCWTClaims    int64 = 15
+	coseHeaderX5Chain      int64 = 33
+	coseHeaderX5T          int64 = 34
+	coseHeaderEphemeralKey int64 = -1
+)
+
+// coseHeaderReceivers is a private use header label of the COSE_Sign1 holding the SHA-256 fingerprints of the receiver
+// certificates as an array of byte strings.
+const coseHeaderReceivers int64 = -65537
+
+// COSE algorithm identifiers from RFC 9053 and RFC 8230.
+const (
+	coseAlgA128GCM       int64 = 1
+	coseAlgA192GCM       int64 = 2
+	coseAlgA256GCM       int64 = 3
+	coseAlgA256KW        int64 = -5
+	coseAlgES256         int64 = -7
+	coseAlgEdDSA         int64 = -8
+	coseAlgSHA256        int64 = -16
+	coseAlgECDHESHKDF256 int64 = -25
+	coseAlgECDHESA256KW  int64 = -31
+	coseAlgPS256         int64 = -37
+	coseAlgRSAOAEP256    int64 = -42
+	coseAlgRS256         int64 = -257
+)
+
+// COSE_Key parameters and values from RFC 9052 and RFC 9053.
+const (
+	coseKeyType     int64 = 1
+	coseKeyCurve    int64 = -1
+	coseKeyX        int64 = -2
+	coseKeyY        int64 = -3
+	coseKeyTypeOKP  int64 = 1
+	coseKeyTypeEC2  int64 = 2
+	coseCurveP256   int64 = 1
+	coseCurveX25519 int64 = 4
+)
+
+// CWT claim keys from RFC 8392.
+const (
+	cwtExpiration int64 = 4
+	cwtIssuedAt   int64 = 6
+	cwtID         int64 = 7
+)
+
+// coseSignatureAlgorithms maps signature algorithms to their COSE identifiers.
+var coseSignatureAlgorithms = map[SignatureAlgorithm]int64{
+	RS256: coseAlgRS256,
+	PS256: coseAlgPS256,
+	ES256: coseAlgES256,
+	EdDSA: coseAlgEdDSA,
+}
+
+// errInvalidCOSEMessage is returned by OpenCOSE if the message is not a COSE message as sealed by SealCOSE.
+var errInvalidCOSEMessage = errors.New("invalid cose message")
+
+// SealCOSE encrypts and signs a payload like SealWithOptions, but encodes the message using COSE (RFC 9052) so it can
+// be opened by other COSE implementations. The payload is signed in a COSE_Sign1 carrying the sealer certificate and
+// its chain in x5chain, the claims, timestamps and message ID as CWT claims, and the fingerprints of the receiver
+// certificates in a private use header. The COSE_Sign1 is then encrypted using A256GCM in a COSE_Encrypt with one
+// recipient per receiver, identified by x5t. The content key is wrapped using RSA-OAEP-256 for RSA receivers and
+// ECDH-ES+A256KW for the others. Timestamps are truncated to whole seconds and metadata is not supported.
+func (s *Sealer) SealCOSE(payload []byte, options SealOptions) ([]byte, error) {
+	if len(s.ReceiverCerts) == 0 {
+		return nil, errors.New("no receiver certificates")
+	}
+
+	if len(options.Metadata) > 0 {
+		return nil, errors.New("metadata is not supported by cose messages")
+	}
+
+	if err := validateClaims(currentVersion, options.Claims); err != nil {
+		return nil, err
+	}
+
+	sign1, err := s.coseSign1(payload, options.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return coseEnvelope(sign1, s.ReceiverCerts)
+}
+
+// coseEnvelope returns the tagged COSE_Encrypt of content for the receivers.
+func coseEnvelope(content []byte, receiverCerts []*x509.Certificate) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	protected, err := cborMarshal(cborMapping{coseHeaderAlgorithm: coseAlgA256GCM})
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	additionalData, err := coseEncStructure(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]interface{}, 0, len(receiverCerts))
+	for _, cert := range receiverCerts {
+		recipient, err := coseRecipient(cert, key)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	return cborMarshal(cborTagged{Number: coseTagEncrypt, Content: []interface{}{
+		protected,
+		cborMapping{coseHeaderIV: iv},
+		aead.Seal(nil, iv, content, additionalData),
+		recipients,
+	}})
+}
+
+// coseSign1 returns the tagged COSE_Sign1 of a payload. All headers are protected.
+func (s *Sealer) coseSign1(payload []byte, claims map[string]string) ([]byte, error) {
+	alg := s.SignatureAlgorithm
+	if alg == "" {
+		alg = defaultSignatureAlgorithm(s.PrivateKey)
+	}
+
+	coseAlg, ok := coseSignatureAlgorithms[alg]
+	if !ok {
+		return nil, errors.New("unsupported signature algorithm")
+	}
+
+	messageID, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+
+	created := now()
+	cwtClaims := cborMapping{
+		cwtIssuedAt:   created.Unix(),
+		cwtExpiration: created.Add(s.timeToLive()).Unix(),
+		cwtID:         []byte(messageID),
+	}
+	for name, value := range claims {
+		cwtClaims[name] = value
+	}
+
+	// x5chain is a single certificate, or an array starting with the sealer certificate followed by its chain.
+	var x5chain interface{} = s.Cert.Raw
+	if len(s.Chain) > 0 {
+		chain := []interface{}{s.Cert.Raw}
+		for _, cert := range s.Chain {
+			chain = append(chain, cert.Raw)
+		}
+		x5chain = chain
+	}
+
+	receivers := make([]interface{}, 0, len(s.ReceiverCerts))
+	for _, fingerprint := range s.receiverFingerprints() {
+		receivers = append(receivers, fingerprint)
+	}
+
+	protected, err := cborMarshal(cborMapping{
+		coseHeaderAlgorithm: coseAlg,
+		coseHeaderX5Chain:   x5chain,
+		coseHeaderCWTClaims: cwtClaims,
+		coseHeaderReceivers: receivers,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	toBeSigned, err := coseSigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signStandard(alg, s.PrivateKey, toBeSigned)
+	if err != nil {
+		return nil, err
+	}
+
+	return cborMarshal(cborTagged{Number: coseTagSign1, Content: []interface{}{protected, cborMapping{}, payload, signature}})
+}
+
+// coseRecipient wraps the content key for a receiver.
+func coseRecipient(cert *x509.Certificate, key []byte) ([]interface{}, error) {
+	fingerprint := sha256.Sum256(cert.Raw)
+	unprotected := cborMapping{coseHeaderX5T: []interface{}{coseAlgSHA256, fingerprint[:]}}
+
+	if pubKey, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+		protected, err := cborMarshal(cborMapping{coseHeaderAlgorithm: coseAlgRSAOAEP256})
+		if err != nil {
+			return nil, err
+		}
+
+		encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pubKey, key, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return []interface{}{protected, unprotected, encryptedKey}, nil
+	}
+
+	receiverKey, _, err := keyAgreementPublicKey(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := receiverKey.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedSecret, err := ephemeral.ECDH(receiverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	protected, err := cborMarshal(cborMapping{coseHeaderAlgorithm: coseAlgECDHESA256KW})
+	if err != nil {
+		return nil, err
+	}
+
+	kek, err := coseKDF(sharedSecret, coseAlgA256KW, 32, protected)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := aesKeyWrap(kek, key)
+	if err != nil {
+		return nil, err
+	}
+
+	unprotected[coseHeaderEphemeralKey] = coseKey(ephemeral.PublicKey())
+
+	return []interface{}{protected, unprotected, encryptedKey}, nil
+}
+
+// OpenCOSE opens a message sealed using SealCOSE. The same rules as for Open apply: the sealer certificate must chain
+// to CertPool, must not be revoked and must be allowed by the SenderPolicy, the message must not be expired, must be
+// signed for the Opener certificate and the signature algorithm must be accepted. Messages without a message ID are
+// rejected if replay protection is enabled. Suites do not apply to COSE messages. COSE messages carry no stapled OCSP
+// response, so they are rejected with ErrRevocationUnknown if RequireOCSP is set.
+func (o *Opener) OpenCOSE(message []byte) ([]byte, *OpenInfo, error) {
+	if err := o.checkPrivateKey(); err != nil {
+		return nil, nil, err
+	}
+
+	encrypt, err := parseCOSEEncrypt(message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := o.coseContentKey(encrypt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plaintext, err := encrypt.decrypt(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return o.openCOSESign1(plaintext)
+}
+
+// openCOSESign1 verifies the COSE_Sign1 decrypted from a message and returns its payload.
+func (o *Opener) openCOSESign1(b []byte) ([]byte, *OpenInfo, error) {
+	sign1, err := parseCOSESign1(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signed, err := parseCWTClaims(sign1.headers[coseHeaderCWTClaims])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ok bool
+	if signed.alg, ok = signatureAlgorithmFromCOSE(sign1.alg); !ok {
+		return nil, nil, ErrUnsupportedSignatureAlgorithm
+	}
+
+	if signed.certs, err = parseX5Chain(sign1.headers[coseHeaderX5Chain]); err != nil {
+		return nil, nil, err
+	}
+
+	if signed.receivers, err = parseCOSEReceivers(sign1.headers[coseHeaderReceivers]); err != nil {
+		return nil, nil, err
+	}
+
+	if signed.signingInput, err = coseSigStructure(sign1.protected, sign1.payload); err != nil {
+		return nil, nil, err
+	}
+	signed.signature = sign1.signature
+
+	info, err := o.openSigned(signed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sign1.payload, info, nil
+}
+
+// coseEncrypt is a parsed COSE_Encrypt.
+type coseEncrypt struct {
+	protected  []byte
+	alg        int64
+	iv         []byte
+	ciphertext []byte
+	recipients []coseRecipientInfo
+}
+
+// coseRecipientInfo is a parsed COSE_recipient. Headers holds both the protected and unprotected headers.
+type coseRecipientInfo struct {
+	protected    []byte
+	alg          int64
+	headers      cborMapping
+	encryptedKey []byte
+}
+
+func parseCOSEEncrypt(b []byte) (*coseEncrypt, error) {
+	v, err := cborUnmarshal(b)
+	if err != nil {
+		return nil, errInvalidCOSEMessage
+	}
+
+	tagged, ok := v.(cborTagged)
+	if !ok || tagged.Number != coseTagEncrypt {
+		return nil, errInvalidCOSEMessage
+	}
+
+	items, ok := tagged.Content.([]interface{})
+	if !ok || len(items) != 4 {
+		return nil, errInvalidCOSEMessage
+	}
+
+	protected, headers, err := coseHeaders(items[0], items[1])
+	if err != nil {
+		return nil, err
+	}
+
+	encrypt := &coseEncrypt{protected: protected}
+	encrypt.alg, _ = headers[coseHeaderAlgorithm].(int64)
+	encrypt.iv, _ = headers[coseHeaderIV].([]byte)
+	encrypt.ciphertext, ok = items[2].([]byte)
+	if !ok {
+		return nil, errInvalidCOSEMessage
+	}
+
+	recipients, ok := items[3].([]interface{})
+	if !ok || len(recipients) == 0 {
+		return nil, errInvalidCOSEMessage
+	}
+
+	for _, r := range recipients {
+		fields, ok := r.([]interface{})
+		if !ok || len(fields) != 3 {
+			return nil, errInvalidCOSEMessage
+		}
+
+		protected, headers, err := coseHeaders(fields[0], fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		recipient := coseRecipientInfo{protected: protected, headers: headers}
+		recipient.alg, _ = headers[coseHeaderAlgorithm].(int64)
+		if fields[2] != nil {
+			if recipient.encryptedKey, ok = fields[2].([]byte); !ok {
+				return nil, errInvalidCOSEMessage
+			}
+		}
+
+		encrypt.recipients = append(encrypt.recipients, recipient)
+	}
+
+	return encrypt, nil
+}
+
+// coseHeaders decodes the protected headers and merges them with the unprotected headers. A label can not appear in
+// both.
+func coseHeaders(protected, unprotected interface{}) ([]byte, cborMapping, error) {
+	b, ok := protected.([]byte)
+	if !ok {
+		return nil, nil, errInvalidCOSEMessage
+	}
+
+	headers, ok := unprotected.(cborMapping)
+	if !ok {
+		return nil, nil, errInvalidCOSEMessage
+	}
+
+	if len(b) == 0 {
+		return b, headers, nil
+	}
+
+	v, err := cborUnmarshal(b)
+	if err != nil {
+		return nil, nil, errInvalidCOSEMessage
+	}
+
+	protectedHeaders, ok := v.(cborMapping)
+	if !ok {
+		return nil, nil, errInvalidCOSEMessage
+	}
+
+	merged := make(cborMapping, len(headers)+len(protectedHeaders))
+	for label, value := range headers {
+		merged[label] = value
+	}
+	for label, value := range protectedHeaders {
+		if _, exists := merged[label]; exists {
+			return nil, nil, errInvalidCOSEMessage
+		}
+		merged[label] = value
+	}
+
+	return b, merged, nil
+}
+
+// addressedTo reports whether the recipient is identified by an x5t holding the SHA-256 fingerprint.
+func (r *coseRecipientInfo) addressedTo(fingerprint []byte) bool {
+	x5t, ok := r.headers[coseHeaderX5T].([]interface{})
+	if !ok || len(x5t) != 2 || x5t[0] != coseAlgSHA256 {
+		return false
+	}
+
+	hash, ok := x5t[1].([]byte)
+
+	return ok && bytes.Equal(hash, fingerprint)
+}
+
+// coseContentKey unwraps the content key from the recipient addressed to the Opener.
+func (o *Opener) coseContentKey(encrypt *coseEncrypt) ([]byte, error) {
+	if o.Cert == nil {
+		return nil, ErrNotRecipient
+	}
+
+	fingerprint := sha256.Sum256(o.Cert.Raw)
+	for i := range encrypt.recipients {
+		if encrypt.recipients[i].addressedTo(fingerprint[:]) {
+			return o.unwrapCOSEKey(&encrypt.recipients[i], encrypt.alg)
+		}
+	}
+
+	return nil, ErrNotRecipient
+}
+
+// unwrapCOSEKey returns the content key for contentAlg from a recipient. Besides the algorithms used by SealCOSE,
+// direct key agreement using ECDH-ES + HKDF-256 is accepted.
+func (o *Opener) unwrapCOSEKey(recipient *coseRecipientInfo, contentAlg int64) ([]byte, error) {
+	size := coseContentKeySize(contentAlg)
+	if size == 0 {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	var key []byte
+	switch recipient.alg {
+	case coseAlgRSAOAEP256:
+		decrypter, ok := o.rsaDecrypter()
+		if !ok {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		var err error
+		if key, err = decrypter.Decrypt(rand.Reader, recipient.encryptedKey, &rsa.OAEPOptions{Hash: crypto.SHA256}); err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+	case coseAlgECDHESA256KW, coseAlgECDHESHKDF256:
+		agreer, err := keyAgreer(o.PrivateKey)
+		if err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		receiverKey, _, err := keyAgreementPublicKey(agreer.Public())
+		if err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		ephemeral, err := parseCOSEKey(recipient.headers[coseHeaderEphemeralKey], receiverKey.Curve())
+		if err != nil {
+			return nil, err
+		}
+
+		sharedSecret, err := agreer.ECDH(ephemeral)
+		if err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		if recipient.alg == coseAlgECDHESHKDF256 {
+			if len(recipient.encryptedKey) != 0 {
+				return nil, errInvalidCOSEMessage
+			}
+
+			return coseKDF(sharedSecret, contentAlg, size, recipient.protected)
+		}
+
+		kek, err := coseKDF(sharedSecret, coseAlgA256KW, 32, recipient.protected)
+		if err != nil {
+			return nil, err
+		}
+
+		if key, err = aesKeyUnwrap(kek, recipient.encryptedKey); err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+	default:
+		return nil, ErrUnsupportedKeyWrap
+	}
+
+	if len(key) != size {
+		return nil, ErrUnableToGetEncryptionKey
+	}
+
+	return key, nil
+}
+
+// decrypt decrypts the content of a COSE_Encrypt.
+func (e *coseEncrypt) decrypt(key []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil || len(e.iv) != aead.NonceSize() {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	additionalData, err := coseEncStructure(e.protected)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, e.iv, e.ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	return plaintext, nil
+}
+
+// coseSign1Message is a parsed COSE_Sign1. Only protected headers are used, as the unprotected headers are not
+// covered by the signature.
+type coseSign1Message struct {
+	protected []byte
+	alg       int64
+	headers   cborMapping
+	payload   []byte
+	signature []byte
+}
+
+func parseCOSESign1(b []byte) (*coseSign1Message, error) {
+	v, err := cborUnmarshal(b)
+	if err != nil {
+		return nil, errInvalidCOSEMessage
+	}
+
+	tagged, ok := v.(cborTagged)
+	if !ok || tagged.Number != coseTagSign1 {
+		return nil, errInvalidCOSEMessage
+	}
+
+	items, ok := tagged.Content.([]interface{})
+	if !ok || len(items) != 4 {
+		return nil, errInvalidCOSEMessage
+	}
+
+	protected, ok := items[0].([]byte)
+	if !ok || len(protected) == 0 {
+		return nil, errInvalidCOSEMessage
+	}
+
+	if _, ok := items[1].(cborMapping); !ok {
+		return nil, errInvalidCOSEMessage
+	}
+
+	v, err = cborUnmarshal(protected)
+	if err != nil {
+		return nil, errInvalidCOSEMessage
+	}
+
+	sign1 := &coseSign1Message{protected: protected}
+	if sign1.headers, ok = v.(cborMapping); !ok {
+		return nil, errInvalidCOSEMessage
+	}
+
+	sign1.alg, _ = sign1.headers[coseHeaderAlgorithm].(int64)
+
+	// Detached payloads are not supported.
+	payload, ok := items[2].([]byte)
+	signature, ok2 := items[3].([]byte)
+	if !ok || !ok2 {
+		return nil, errInvalidCOSEMessage
+	}
+
+	sign1.payload = payload
+	sign1.signature = signature
+
+	return sign1, nil
+}
+
+// signatureAlgorithmFromCOSE returns the signature algorithm with the given COSE identifier.
+func signatureAlgorithmFromCOSE(coseAlg int64) (SignatureAlgorithm, bool) {
+	for alg, id := range coseSignatureAlgorithms {
+		if id == coseAlg {
+			return alg, true
+		}
+	}
+
+	return "", false
+}
+
+// coseSigStructure returns the Sig_structure of a COSE_Sign1 without external additional data.
+func coseSigStructure(protected, payload []byte) ([]byte, error) {
+	return cborMarshal([]interface{}{"Signature1", protected, []byte{}, payload})
+}
+
+// coseEncStructure returns the Enc_structure of a COSE_Encrypt without external additional data.
+func coseEncStructure(protected []byte) ([]byte, error) {
+	return cborMarshal([]interface{}{"Encrypt", protected, []byte{}})
+}
+
+// coseKDF derives a key from an ECDH shared secret using HKDF-SHA256 without salt and a COSE_KDF_Context without
+// party information.
+func coseKDF(sharedSecret []byte, alg int64, size int, protected []byte) ([]byte, error) {
+	context, err := cborMarshal([]interface{}{
+		alg,
+		[]interface{}{nil, nil, nil},
+		[]interface{}{nil, nil, nil},
+		[]interface{}{size * 8, protected},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hkdf.Key(sha256.New, sharedSecret, nil, string(context), size)
+}
+
+// coseContentKeySize returns the key size of a content encryption algorithm, or 0 if it is not supported.
+func coseContentKeySize(alg int64) int {
+	switch alg {
+	case coseAlgA128GCM:
+		return 16
+	case coseAlgA192GCM:
+		return 24
+	case coseAlgA256GCM:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// coseKey returns the COSE_Key of an ephemeral public key.
+func coseKey(pubKey *ecdh.PublicKey) cborMapping {
+	b := pubKey.Bytes()
+	if pubKey.Curve() == ecdh.X25519() {
+		return cborMapping{coseKeyType: coseKeyTypeOKP, coseKeyCurve: coseCurveX25519, coseKeyX: b}
+	}
+
+	// P-256 keys are encoded uncompressed as 0x04 || x || y.
+	return cborMapping{coseKeyType: coseKeyTypeEC2, coseKeyCurve: coseCurveP256, coseKeyX: b[1:33], coseKeyY: b[33:]}
+}
+
+// parseCOSEKey parses an ephemeral COSE_Key, which must be on the given curve. EC2 keys may use point compression.
+func parseCOSEKey(v interface{}, curve ecdh.Curve) (*ecdh.PublicKey, error) {
+	key, ok := v.(cborMapping)
+	if !ok {
+		return nil, errInvalidCOSEMessage
+	}
+
+	x, ok := key[coseKeyX].([]byte)
+	if !ok {
+		return nil, errInvalidCOSEMessage
+	}
+
+	kty, crv := key[coseKeyType], key[coseKeyCurve]
+	switch {
+	case curve == ecdh.X25519() && kty == coseKeyTypeOKP && crv == coseCurveX25519:
+		pubKey, err := curve.NewPublicKey(x)
+		if err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+		return pubKey, nil
+	case curve == ecdh.P256() && kty == coseKeyTypeEC2 && crv == coseCurveP256 && len(x) == 32:
+		var point []byte
+		switch y := key[coseKeyY].(type) {
+		case []byte:
+			point = append(append([]byte{4}, x...), y...)
+		case bool:
+			compressed := []byte{2}
+			if y {
+				compressed[0] = 3
+			}
+			px, py := elliptic.UnmarshalCompressed(elliptic.P256(), append(compressed, x...))
+			if px == nil {
+				return nil, ErrUnableToGetEncryptionKey
+			}
+			point = append(append([]byte{4}, px.FillBytes(make([]byte, 32))...), py.FillBytes(make([]byte, 32))...)
+		default:
+			return nil, errInvalidCOSEMessage
+		}
+
+		pubKey, err := curve.NewPublicKey(point)
+		if err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+		return pubKey, nil
+	default:
+		return nil, ErrUnableToGetEncryptionKey
+	}
+}
+
+// parseX5Chain returns the certificates in an x5chain header, starting with the sealer certificate.
+func parseX5Chain(v interface{}) ([][]byte, error) {
+	switch x5chain := v.(type) {
+	case []byte:
+		return [][]byte{x5chain}, nil
+	case []interface{}:
+		if len(x5chain) == 0 || len(x5chain) > maxSealerChainLength+1 {
+			return nil, ErrUntrustedCert
+		}
+
+		certs := make([][]byte, 0, len(x5chain))
+		for _, c := range x5chain {
+			cert, ok := c.([]byte)
+			if !ok {
+				return nil, errInvalidCOSEMessage
+			}
+			certs = append(certs, cert)
+		}
+
+		return certs, nil
+	default:
+		return nil, errInvalidCOSEMessage
+	}
+}
+
+// parseCOSEReceivers returns the fingerprints in the receivers header. A message without the header is addressed to
+// no one.
+func parseCOSEReceivers(v interface{}) ([][]byte, error) {
+	if v == nil {
+		return [][]byte{}, nil
+	}
+
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errInvalidCOSEMessage
+	}
+
+	receivers := make([][]byte, 0, len(items))
+	for _, item := range items {
+		fingerprint, ok := item.([]byte)
+		if !ok {
+			return nil, errInvalidCOSEMessage
+		}
+		receivers = append(receivers, fingerprint)
+	}
+
+	return receivers, nil
+}
+
+// parseCWTClaims parses the CWT claims header. Issued at and expiration are required. Claims with text names are the
+// custom claims of the message; claims with integer keys other than those used by SealCOSE are ignored.
+func parseCWTClaims(v interface{}) (*signedMessage, error) {
+	m, ok := v.(cborMapping)
+	if !ok {
+		return nil, errInvalidCOSEMessage
+	}
+
+	issuedAt, ok := m[cwtIssuedAt].(int64)
+	expiration, ok2 := m[cwtExpiration].(int64)
+	if !ok || !ok2 {
+		return nil, errInvalidCOSEMessage
+	}
+
+	cwt := &signedMessage{created: time.Unix(issuedAt, 0), expires: time.Unix(expiration, 0)}
+
+	if id, ok := m[cwtID]; ok {
+		b, ok := id.([]byte)
+		if !ok {
+			return nil, errInvalidCOSEMessage
+		}
+		cwt.messageID = string(b)
+	}
+
+	for key, value := range m {
+		name, ok := key.(string)
+		if !ok {
+			continue
+		}
+
+		s, ok := value.(string)
+		if !ok {
+			return nil, &InvalidClaimError{Name: name}
+		}
+
+		if cwt.claims == nil {
+			cwt.claims = make(map[string]string)
+		}
+		cwt.claims[name] = s
+	}
+
+	if err := validateClaims(currentVersion, cwt.claims); err != nil {
+		return nil, err
+	}
+
+	return cwt, nil
+}
+
+// newGCM returns AES-GCM using the given key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
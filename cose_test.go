@@ -0,0 +1,323 @@
+package arcane
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealer_SealCOSE(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name    string
+		sealer  *Sealer
+		opener  *Opener
+		options SealOptions
+	}{
+		{
+			name:   "RSA",
+			sealer: &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, signedCert3}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+		},
+		{
+			name:   "PS256",
+			sealer: &Sealer{PrivateKey: signedPk1, Cert: signedCert1, SignatureAlgorithm: PS256, ReceiverCerts: []*x509.Certificate{signedCert3}},
+			opener: &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+		},
+		{
+			name:   "ECDSA sealer and receiver",
+			sealer: &Sealer{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, ReceiverCerts: []*x509.Certificate{signedCert2, ecdsaCert1}},
+			opener: &Opener{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, CertPool: caCertPool},
+		},
+		{
+			name:   "Ed25519 sealer and receiver",
+			sealer: &Sealer{PrivateKey: ed25519Pk, Cert: ed25519Cert, ReceiverCerts: []*x509.Certificate{ed25519Cert}},
+			opener: &Opener{PrivateKey: ed25519Pk, Cert: ed25519Cert, CertPool: caCertPool},
+		},
+		{
+			name:   "Chain and claims",
+			sealer: &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			options: SealOptions{
+				Claims: map[string]string{"tenantId": "tenant-1", "subject": ""},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		message, err := test.sealer.SealCOSE([]byte("This is a test payload."), test.options)
+		assert.NoError(t, err, test.name)
+
+		payload, info, err := test.opener.OpenCOSE(message)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+		if assert.NotNil(t, info, test.name) {
+			assert.Equal(t, test.sealer.Cert, info.SealerCert, test.name)
+			assert.Equal(t, test.sealer.Cert, info.Chain[0], test.name)
+			assert.True(t, validMessageID(info.MessageID), test.name)
+			assert.Equal(t, test.options.Claims, info.Claims, test.name)
+			assert.True(t, now().Equal(info.Created), test.name)
+			assert.True(t, now().Add(5*time.Minute).Equal(info.Expires), test.name)
+		}
+
+		// The signature is verified like any COSE_Sign1.
+		encrypt, err := parseCOSEEncrypt(message)
+		assert.NoError(t, err, test.name)
+		key, err := test.opener.coseContentKey(encrypt)
+		assert.NoError(t, err, test.name)
+		plaintext, err := encrypt.decrypt(key)
+		assert.NoError(t, err, test.name)
+		sign1, err := parseCOSESign1(plaintext)
+		assert.NoError(t, err, test.name)
+		alg, ok := signatureAlgorithmFromCOSE(sign1.alg)
+		assert.True(t, ok, test.name)
+		assert.NoError(t, verifyCOSESign1(sign1, alg, test.sealer.Cert.PublicKey), test.name)
+	}
+}
+
+func TestOpener_OpenCOSE(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	message, err := sealer.SealCOSE([]byte("This is a test payload."), SealOptions{})
+	assert.NoError(t, err)
+
+	tampered := append([]byte(nil), message...)
+	tampered[len(tampered)/3] ^= 1
+
+	// A receiver can encrypt the COSE_Sign1 for someone else, but not change the receivers it is signed for.
+	encrypt, err := parseCOSEEncrypt(message)
+	assert.NoError(t, err)
+	key, err := (&Opener{PrivateKey: signedPk2, Cert: signedCert2}).coseContentKey(encrypt)
+	assert.NoError(t, err)
+	sign1, err := encrypt.decrypt(key)
+	assert.NoError(t, err)
+	forwarded, err := coseEnvelope(sign1, []*x509.Certificate{signedCert3})
+	assert.NoError(t, err)
+
+	replayCache := NewMemoryReplayCache()
+	_, _, err = (&Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: replayCache}).OpenCOSE(message)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		opener      *Opener
+		message     []byte
+		now         time.Time
+		expectedErr error
+	}{
+		{
+			name:        "Not recipient",
+			opener:      &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+			message:     message,
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Forwarded",
+			opener:      &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+			message:     forwarded,
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Untrusted",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			message:     message,
+			expectedErr: ErrUntrustedCert,
+		},
+		{
+			name:        "Expired",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message:     message,
+			now:         now().Add(6 * time.Minute),
+			expectedErr: ErrMessageExpired,
+		},
+		{
+			name:        "Signature algorithm not allowed",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, SignatureAlgorithms: []SignatureAlgorithm{PS256}},
+			message:     message,
+			expectedErr: ErrUnsupportedSignatureAlgorithm,
+		},
+		{
+			name:        "Sender not authorized",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, SenderPolicy: &Policy{CommonNames: []string{"other"}}},
+			message:     message,
+			expectedErr: &SenderNotAuthorizedError{Rule: "CommonNames"},
+		},
+		{
+			name:        "OCSP required",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, RequireOCSP: true},
+			message:     message,
+			expectedErr: ErrRevocationUnknown,
+		},
+		{
+			name:        "Replayed",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: replayCache},
+			message:     message,
+			expectedErr: ErrReplayedMessage,
+		},
+		{
+			name:        "Tampered",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message:     tampered,
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Not COSE",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			message:     []byte("{}"),
+			expectedErr: errInvalidCOSEMessage,
+		},
+	}
+
+	sealed := now()
+	for _, test := range tests {
+		if !test.now.IsZero() {
+			setNow(t, test.now)
+		}
+
+		_, _, err := test.opener.OpenCOSE(test.message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+
+		setNow(t, sealed)
+	}
+
+	_, err = sealer.SealCOSE([]byte("This is a test payload."), SealOptions{Metadata: map[string]string{"filename": "test.txt"}})
+	assert.Error(t, err)
+}
+
+func TestOpener_OpenCOSEExample(t *testing.T) {
+	// Example C.3.1 of RFC 9052: ECDH-ES + HKDF-256 direct key agreement with A128GCM, for the key of
+	// meriadoc.brandybuck@buckland.example.
+	message := hexDecode(t, "d8608443a10101a1054cc9cf4df2fe6c632bf788641358247adbe2709ca818fb415f1e5df66f4e1a5105"+
+		"3ba6d65a1a0c52a357da7a644b8070a151b0818344a1013818a220a40102200121582098f50a4ff6c05861c8860d13a638ea56c3"+
+		"f5ad7590bbfbf054e1c7b4d91d628022f50458246d65726961646f632e6272616e64796275636b406275636b6c616e642e6578616d"+
+		"706c6540")
+	privKey, err := ecdh.P256().NewPrivateKey(hexDecode(t, "aff907c99f9ad3aae6c4cdf21122bce2bd68b5283e6907154ad911840fa208cf"))
+	assert.NoError(t, err)
+
+	encrypt, err := parseCOSEEncrypt(message)
+	assert.NoError(t, err)
+	assert.Equal(t, coseAlgA128GCM, encrypt.alg)
+	assert.Len(t, encrypt.recipients, 1)
+
+	opener := &Opener{PrivateKey: privKey}
+	key, err := opener.unwrapCOSEKey(&encrypt.recipients[0], encrypt.alg)
+	assert.NoError(t, err)
+
+	plaintext, err := encrypt.decrypt(key)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("This is the content."), plaintext)
+
+	// The recipient is identified by kid rather than x5t.
+	_, _, err = opener.OpenCOSE(message)
+	assert.Equal(t, ErrNotRecipient, err)
+}
+
+func TestVerifyCOSESign1Examples(t *testing.T) {
+	// Examples sign1-pass-02 and rsa-pss-01 from the COSE working group examples, signed by the key "11" and by
+	// meriadoc.brandybuck@rsa.example.
+	ecdsaKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(base64URLDecode(t, "usWxHK2PmfnHKwXPS54m0kTcGJ90UiglWiGahtagnv8")),
+		Y:     new(big.Int).SetBytes(base64URLDecode(t, "IBOL-C3BttVivg-lSreASjpkttcsz-1rb7btKLv8EX4")),
+	}
+	rsaKey := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(base64URLDecode(t, "6M7oif8zc9GmjmOZZD5dLhhY-xSZvsIOP4fAXJ0osOYYi5NjEAGtTpTJG35dDvzslxzEVO"+
+			"rVtA-_lRkvp3xT8KXqdGhiNH9T5rK6nGZ1eLqghM9zkVrwrC2cc4t1TvdQFiB9IRrFHPXP98C9vcWBJH_5VjpKeTSgPu2TqAgdqrto2QKI4n_"+
+			"BfKIu2NSwKmShlogTR0vdEL16y251Es6jWRygxSLg3_KU2j8Wu48GArYOBA7tIIDH3qtvYKw9NurJNxG7Iql4IXTR6b5zRb3Ic8bKnMe6JNzjWS"+
+			"hf0Vv46Zqf-oRFADyi6rPEMyQaRnXIqRHrKw3kUcXmXMphT79k3w")),
+		E: 65537,
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		alg     SignatureAlgorithm
+		pubKey  interface{}
+	}{
+		{
+			name: "ES256",
+			message: "d28445a201260300a10442313154546869732069732074686520636f6e74656e742e58402ad3b9dcc1e13d04f357e11cc8ac" +
+				"d825196620e62f0d8deca72672508b829d90e07a3f23be6aa36fd6ebd31e2ed08d1760bffd981f991bfc94a45199a54875c4",
+			alg:    ES256,
+			pubKey: ecdsaKey,
+		},
+		{
+			name: "PS256",
+			message: "d28444a1013824a104581e62696c626f2e62616767696e7340686f626269746f6e2e6578616d706c65545468697320697320" +
+				"74686520636f6e74656e742e590100788ef717e37b7a127010f87d458be5788151a734aeaf1ef52a8f7ac40d05daf1f5dc575b29c0bf" +
+				"0e1d326cfcae1af5dcf62b6dc26eb18a35456fd7c3477774d2c664babc5db7618309dc2ba38392c3dba61f0d27974ea5d4df329060334b" +
+				"8bbd9d8f41cc090913cb2cd4470ae2c8560173793e703d2dda52a4e804ececd57db5ba30200b4d0939f89adc1f13f829e516625109684b4" +
+				"29a088e0a2766564cfd2ee1a1acc4f20ad981e4bc27e427d754481ca93ee16a7677e24cdd31d03b44fe3260ee35bbb5b57c1264af6ca879" +
+				"f67b39b2680d920252e37b916e970baa4762c65cc4ea071b2ab65c5c992518597c7b7fbf9608564c5c2c3caae9449d46f8df32",
+			alg:    PS256,
+			pubKey: rsaKey,
+		},
+	}
+
+	for _, test := range tests {
+		sign1, err := parseCOSESign1(hexDecode(t, test.message))
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is the content."), sign1.payload, test.name)
+
+		alg, ok := signatureAlgorithmFromCOSE(sign1.alg)
+		assert.True(t, ok, test.name)
+		assert.Equal(t, test.alg, alg, test.name)
+		assert.NoError(t, verifyCOSESign1(sign1, alg, test.pubKey), test.name)
+
+		sign1.payload = []byte("This is not the content.")
+		assert.Equal(t, ErrInvalidSignature, verifyCOSESign1(sign1, alg, test.pubKey), test.name)
+	}
+}
+
+func TestAESKeyWrap(t *testing.T) {
+	// Test vector 4.6 of RFC 3394: 256 bits of key data with a 256-bit KEK.
+	kek := hexDecode(t, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	key := hexDecode(t, "00112233445566778899aabbccddeeff000102030405060708090a0b0c0d0e0f")
+	expected := hexDecode(t, "28c9f404c4b810f4cbccb35cfb87f8263f5786e2d80ed326cbc7f0e71a99f43bfb988b9b7a02dd21")
+
+	wrapped, err := aesKeyWrap(kek, key)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, wrapped)
+
+	unwrapped, err := aesKeyUnwrap(kek, wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, key, unwrapped)
+
+	wrapped[0] ^= 1
+	_, err = aesKeyUnwrap(kek, wrapped)
+	assert.Equal(t, ErrUnableToGetEncryptionKey, err)
+}
+
+func hexDecode(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+	return b
+}
+
+func base64URLDecode(t *testing.T, s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	assert.NoError(t, err)
+	return b
+}
+
+// verifyCOSESign1 verifies the signature of a COSE_Sign1.
+func verifyCOSESign1(sign1 *coseSign1Message, alg SignatureAlgorithm, pubKey crypto.PublicKey) error {
+	toBeSigned, err := coseSigStructure(sign1.protected, sign1.payload)
+	if err != nil {
+		return err
+	}
+
+	return verifyStandard(alg, pubKey, toBeSigned, sign1.signature)
+}
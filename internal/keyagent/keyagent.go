@@ -0,0 +1,127 @@
+// Package keyagent holds a private key in a separate goroutine and only exposes operations on it, the same way a key
+// held by an external process or hardware token would be. It is used to test that arcane works with any
+// crypto.Signer, crypto.Decrypter and arcane.KeyAgreer.
+package keyagent
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/larwef/arcane/internal/x25519"
+)
+
+// ErrClosed is returned when an operation is requested after the Agent is closed.
+var ErrClosed = errors.New("key agent is closed")
+
+type request struct {
+	op       func(privKey crypto.PrivateKey) ([]byte, error)
+	response chan<- response
+}
+
+type response struct {
+	result []byte
+	err    error
+}
+
+// Agent performs private key operations in its own goroutine. The private key is never accessible outside that
+// goroutine.
+type Agent struct {
+	publicKey crypto.PublicKey
+	requests  chan request
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New starts an Agent holding privKey. The key must implement crypto.Signer.
+func New(privKey crypto.Signer) *Agent {
+	a := &Agent{
+		publicKey: privKey.Public(),
+		requests:  make(chan request),
+		done:      make(chan struct{}),
+	}
+
+	go a.serve(privKey)
+
+	return a
+}
+
+func (a *Agent) serve(privKey crypto.PrivateKey) {
+	for {
+		select {
+		case req := <-a.requests:
+			result, err := req.op(privKey)
+			req.response <- response{result: result, err: err}
+		case <-a.done:
+			return
+		}
+	}
+}
+
+func (a *Agent) do(op func(privKey crypto.PrivateKey) ([]byte, error)) ([]byte, error) {
+	responses := make(chan response, 1)
+	select {
+	case a.requests <- request{op: op, response: responses}:
+	case <-a.done:
+		return nil, ErrClosed
+	}
+
+	res := <-responses
+
+	return res.result, res.err
+}
+
+// Close stops the Agent. Subsequent operations return ErrClosed. Close can be called more than once.
+func (a *Agent) Close() {
+	a.closeOnce.Do(func() { close(a.done) })
+}
+
+// Public returns the public key corresponding to the private key held by the Agent.
+func (a *Agent) Public() crypto.PublicKey {
+	return a.publicKey
+}
+
+// Sign implements crypto.Signer.
+func (a *Agent) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return a.do(func(privKey crypto.PrivateKey) ([]byte, error) {
+		return privKey.(crypto.Signer).Sign(rand, digest, opts)
+	})
+}
+
+// Decrypt implements crypto.Decrypter. Only RSA keys support decryption.
+func (a *Agent) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return a.do(func(privKey crypto.PrivateKey) ([]byte, error) {
+		decrypter, ok := privKey.(crypto.Decrypter)
+		if !ok {
+			return nil, errors.New("key does not support decryption")
+		}
+
+		return decrypter.Decrypt(rand, msg, opts)
+	})
+}
+
+// ECDH implements arcane.KeyAgreer. ECDSA keys perform ECDH on their curve and Ed25519 keys use their X25519
+// equivalent.
+func (a *Agent) ECDH(remote *ecdh.PublicKey) ([]byte, error) {
+	return a.do(func(privKey crypto.PrivateKey) ([]byte, error) {
+		var ecdhKey *ecdh.PrivateKey
+		var err error
+		switch key := privKey.(type) {
+		case *ecdsa.PrivateKey:
+			ecdhKey, err = key.ECDH()
+		case ed25519.PrivateKey:
+			ecdhKey, err = x25519.FromEd25519PrivateKey(key)
+		default:
+			return nil, errors.New("key does not support key agreement")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return ecdhKey.ECDH(remote)
+	})
+}
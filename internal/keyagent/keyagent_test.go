@@ -0,0 +1,66 @@
+package keyagent
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgent(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	agent := New(rsaKey)
+	assert.Equal(t, &rsaKey.PublicKey, agent.Public())
+
+	digest := sha256.Sum256([]byte("test"))
+	signature, err := agent.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], signature))
+
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &rsaKey.PublicKey, []byte("test"), nil)
+	assert.NoError(t, err)
+	plaintext, err := agent.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("test"), plaintext)
+
+	_, err = agent.ECDH(nil)
+	assert.Error(t, err)
+
+	agent.Close()
+	_, err = agent.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.Equal(t, ErrClosed, err)
+
+	// Closing again has no effect.
+	agent.Close()
+}
+
+func TestAgentECDH(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	agent := New(ecdsaKey)
+	defer agent.Close()
+
+	remote, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	secret, err := agent.ECDH(remote.PublicKey())
+	assert.NoError(t, err)
+
+	ecdhKey, err := ecdsaKey.ECDH()
+	assert.NoError(t, err)
+	expected, err := remote.ECDH(ecdhKey.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, secret)
+
+	_, err = agent.Decrypt(rand.Reader, []byte("test"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+// Package ocspresponder is a minimal OCSP responder for certificates issued by a single CA, such as the test CAs
+// created using cmd/generatecert. Every certificate not marked as revoked is reported as good. It implements
+// http.Handler, so it can be served using httptest to test OCSP stapling without network access.
+package ocspresponder
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxRequestSize limits the size of requests accepted by the responder.
+const maxRequestSize = 16 * 1024
+
+// Responder answers OCSP requests for certificates issued by a single CA. Responses are signed directly by the CA.
+type Responder struct {
+	// Now returns the time used as the update time of responses. Defaults to time.Now.
+	Now func() time.Time
+	// Validity is the time from the update time to the next update time of responses. Defaults to 24 hours.
+	Validity time.Duration
+
+	issuer  *x509.Certificate
+	signer  crypto.Signer
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// New returns a Responder for certificates issued by issuer. The signer must hold the private key of issuer.
+func New(issuer *x509.Certificate, signer crypto.Signer) *Responder {
+	return &Responder{
+		issuer:  issuer,
+		signer:  signer,
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Revoke marks the certificate with the given serial number as revoked at revokedAt.
+func (r *Responder) Revoke(serial *big.Int, revokedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revoked[serial.String()] = revokedAt
+}
+
+// Respond returns the DER encoded response to a DER encoded OCSP request. Requests for certificates from other issuers
+// get an unauthorized response.
+func (r *Responder) Respond(request []byte) ([]byte, error) {
+	req, err := ocsp.ParseRequest(request)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil
+	}
+
+	if !r.issuedBy(req) {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+
+	validity := r.Validity
+	if validity == 0 {
+		validity = 24 * time.Hour
+	}
+
+	thisUpdate := now()
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   thisUpdate,
+		NextUpdate:   thisUpdate.Add(validity),
+		IssuerHash:   req.HashAlgorithm,
+	}
+
+	r.mu.Lock()
+	revokedAt, revoked := r.revoked[req.SerialNumber.String()]
+	r.mu.Unlock()
+
+	if revoked {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = revokedAt
+		template.RevocationReason = ocsp.Unspecified
+	}
+
+	return ocsp.CreateResponse(r.issuer, r.issuer, template, r.signer)
+}
+
+// ServeHTTP answers OCSP requests sent using POST, or using GET with the base64 encoded request as the last path
+// segment.
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var request []byte
+	switch req.Method {
+	case http.MethodPost:
+		b, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxRequestSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request = b
+	case http.MethodGet:
+		segment := req.URL.EscapedPath()
+		segment = segment[strings.LastIndex(segment, "/")+1:]
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		b, err := base64.StdEncoding.DecodeString(unescaped)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request = b
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, err := r.Respond(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(response)
+}
+
+// issuedBy reports whether the request is for a certificate issued by the issuer of the Responder.
+func (r *Responder) issuedBy(req *ocsp.Request) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+
+	nameHash := req.HashAlgorithm.New()
+	nameHash.Write(r.issuer.RawSubject)
+
+	keyHash := req.HashAlgorithm.New()
+	keyHash.Write(spki.PublicKey.RightAlign())
+
+	return bytes.Equal(req.IssuerNameHash, nameHash.Sum(nil)) && bytes.Equal(req.IssuerKeyHash, keyHash.Sum(nil))
+}
@@ -0,0 +1,114 @@
+package ocspresponder
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestResponder(t *testing.T) {
+	ca, caKey := createCert(t, 1, "Test CA", nil, nil)
+	cert, _ := createCert(t, 2, "Test Cert", ca, caKey)
+	revoked, _ := createCert(t, 3, "Test Revoked", ca, caKey)
+	other, otherKey := createCert(t, 4, "Other CA", nil, nil)
+	otherCert, _ := createCert(t, 5, "Other Cert", other, otherKey)
+
+	updated := time.Date(2020, 11, 26, 17, 0, 0, 0, time.UTC)
+	responder := New(ca, caKey)
+	responder.Now = func() time.Time { return updated }
+	responder.Revoke(revoked.SerialNumber, updated.Add(-time.Hour))
+
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	response := post(t, server.URL, cert, ca)
+	parsed, err := ocsp.ParseResponseForCert(response, cert, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Good, parsed.Status)
+	assert.Equal(t, updated, parsed.ThisUpdate)
+	assert.Equal(t, updated.Add(24*time.Hour), parsed.NextUpdate)
+
+	response = post(t, server.URL, revoked, ca)
+	parsed, err = ocsp.ParseResponseForCert(response, revoked, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, parsed.Status)
+	assert.Equal(t, updated.Add(-time.Hour), parsed.RevokedAt)
+
+	// Requests can also be sent using GET.
+	request, err := ocsp.CreateRequest(revoked, ca, nil)
+	assert.NoError(t, err)
+	resp, err := http.Get(server.URL + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(request)))
+	assert.NoError(t, err)
+	response, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	parsed, err = ocsp.ParseResponseForCert(response, revoked, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, parsed.Status)
+
+	// Certificates from other issuers are not answered for.
+	response = post(t, server.URL, otherCert, other)
+	_, err = ocsp.ParseResponse(response, other)
+	assert.Equal(t, ocsp.ResponseError{Status: ocsp.Unauthorized}, err)
+
+	response, err = responder.Respond([]byte("not a request"))
+	assert.NoError(t, err)
+	_, err = ocsp.ParseResponse(response, ca)
+	assert.Equal(t, ocsp.ResponseError{Status: ocsp.Malformed}, err)
+}
+
+func post(t *testing.T, url string, cert, issuer *x509.Certificate) []byte {
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	assert.NoError(t, err)
+
+	resp, err := http.Post(url, "application/ocsp-request", bytes.NewReader(request))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/ocsp-response", resp.Header.Get("Content-Type"))
+
+	response, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return response
+}
+
+func createCert(t *testing.T, serial int64, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(b)
+	assert.NoError(t, err)
+
+	return cert, key
+}
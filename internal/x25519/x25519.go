@@ -0,0 +1,77 @@
+// Package x25519 converts Ed25519 keys to their X25519 equivalent, so a key used to sign can also be used for key
+// agreement. It is shared by arcane and internal/keyagent.
+package x25519
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+)
+
+// curve25519P is the field prime 2^255 - 19 shared by Ed25519 and X25519.
+var curve25519P = bigFromHex("7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffed")
+
+// lowOrderY holds the y coordinates of the Edwards points of small order: the identity, the point of order 2 and the
+// points of order 4 and 8. Key agreement using them gives a shared secret that does not depend on the private key.
+var lowOrderY = []*big.Int{
+	big.NewInt(1),
+	new(big.Int).Sub(curve25519P, big.NewInt(1)),
+	big.NewInt(0),
+	bigFromHex("5fc536d880238b13933c6d305acdfd5f098eff289f4c345b027b2c28f95e826"),
+	bigFromHex("7a03ac9277fdc74ec6cc392cfa53202a0f67100d760b3cba4fd84d3d706a17c7"),
+}
+
+func bigFromHex(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 16)
+	return n
+}
+
+// FromEd25519PrivateKey returns the X25519 private key that has the same hashed scalar as the Ed25519 key.
+func FromEd25519PrivateKey(privKey ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	h := sha512.Sum512(privKey.Seed())
+	return ecdh.X25519().NewPrivateKey(h[:32])
+}
+
+// FromEd25519PublicKey maps an Edwards point to the birationally equivalent Montgomery point u = (1 + y) / (1 - y).
+func FromEd25519PublicKey(pubKey ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	if len(pubKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+
+	// The key is the little endian y coordinate with the sign of x in the most significant bit.
+	yBytes := make([]byte, ed25519.PublicKeySize)
+	for i, b := range pubKey {
+		yBytes[len(yBytes)-1-i] = b
+	}
+	yBytes[0] &= 0x7f
+	y := new(big.Int).SetBytes(yBytes)
+
+	// Non-canonical encodings, where y is not reduced modulo p, would let several keys map to the same X25519 key.
+	if y.Cmp(curve25519P) >= 0 {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+	for _, lowOrder := range lowOrderY {
+		if y.Cmp(lowOrder) == 0 {
+			return nil, errors.New("ed25519 public key has low order")
+		}
+	}
+
+	denominator := new(big.Int).Sub(big.NewInt(1), y)
+	denominator.Mod(denominator, curve25519P)
+	if denominator.Sign() == 0 || denominator.ModInverse(denominator, curve25519P) == nil {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+
+	u := new(big.Int).Add(big.NewInt(1), y)
+	u.Mul(u, denominator)
+	u.Mod(u, curve25519P)
+
+	uBytes := u.FillBytes(make([]byte, 32))
+	for i, j := 0, len(uBytes)-1; i < j; i, j = i+1, j-1 {
+		uBytes[i], uBytes[j] = uBytes[j], uBytes[i]
+	}
+
+	return ecdh.X25519().NewPublicKey(uBytes)
+}
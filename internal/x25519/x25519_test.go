@@ -0,0 +1,60 @@
+package x25519
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromEd25519(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+
+		x25519PubKey, err := FromEd25519PublicKey(pubKey)
+		assert.NoError(t, err)
+
+		x25519PrivKey, err := FromEd25519PrivateKey(privKey)
+		assert.NoError(t, err)
+		assert.Equal(t, x25519PrivKey.PublicKey().Bytes(), x25519PubKey.Bytes())
+	}
+
+	_, err := FromEd25519PublicKey(ed25519.PublicKey{1, 2, 3})
+	assert.Error(t, err)
+
+	// y = 1 is the identity element which has no Montgomery equivalent.
+	identity := make(ed25519.PublicKey, ed25519.PublicKeySize)
+	identity[0] = 1
+	_, err = FromEd25519PublicKey(identity)
+	assert.Error(t, err)
+}
+
+func TestFromEd25519PublicKeyRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		pubKey string
+	}{
+		// Non-canonical encodings of y = 2 and y = 2^255 - 1.
+		{name: "y = p + 2", pubKey: "efffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"},
+		{name: "y = 2^255 - 1", pubKey: "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"},
+		{name: "y = p with sign bit", pubKey: "edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		// Points of small order.
+		{name: "Order 2", pubKey: "ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"},
+		{name: "Order 4", pubKey: "0000000000000000000000000000000000000000000000000000000000000000"},
+		{name: "Order 4 with sign bit", pubKey: "0000000000000000000000000000000000000000000000000000000000000080"},
+		{name: "Order 8", pubKey: "26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05"},
+		{name: "Order 8 with sign bit", pubKey: "26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc85"},
+		{name: "Order 8 other y", pubKey: "c7176a703d4dd84fba3c0b760d10670f2a2053fa2c39ccc64ec7fd7792ac037a"},
+	}
+
+	for _, test := range tests {
+		pubKey, err := hex.DecodeString(test.pubKey)
+		assert.NoError(t, err, test.name)
+
+		_, err = FromEd25519PublicKey(pubKey)
+		assert.Error(t, err, test.name)
+	}
+}
@@ -0,0 +1,457 @@
+package arcane
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// joseEncA256GCM is the content encryption algorithm of JWEs sealed using SealJWE.
+	joseEncA256GCM = "A256GCM"
+	// joseX5TS256 is the header parameter holding the SHA-256 fingerprint of the receiver certificate.
+	joseX5TS256 = "x5t#S256"
+	// joseTagSize is the size of the A256GCM authentication tag.
+	joseTagSize = 16
+)
+
+// errInvalidJOSEMessage is returned by OpenJWE if the message is not a JWE as sealed by SealJWE.
+var errInvalidJOSEMessage = errors.New("invalid jose message")
+
+// JWE is a JWE (RFC 7516) in the general JSON serialization. It is encoded as JSON using encoding/json, and can be
+// converted to and from the compact serialization using Compact and ParseCompactJWE.
+type JWE struct {
+	Protected   string                 `json:"protected"`
+	Unprotected map[string]interface{} `json:"unprotected,omitempty"`
+	Recipients  []JWERecipient         `json:"recipients,omitempty"`
+	// Header and EncryptedKey are only set on a JWE decoded from the flattened JSON serialization, where they hold the
+	// single recipient.
+	Header       map[string]interface{} `json:"header,omitempty"`
+	EncryptedKey string                 `json:"encrypted_key,omitempty"`
+	AAD          string                 `json:"aad,omitempty"`
+	IV           string                 `json:"iv"`
+	Ciphertext   string                 `json:"ciphertext"`
+	Tag          string                 `json:"tag"`
+}
+
+// JWERecipient holds the content key wrapped for one receiver of a JWE.
+type JWERecipient struct {
+	Header       map[string]interface{} `json:"header,omitempty"`
+	EncryptedKey string                 `json:"encrypted_key,omitempty"`
+}
+
+// jwsHeader is the protected header of the JWS sealed inside a JWE. Arcane specific values are carried as header
+// parameters so the payload of the JWS is the payload of the message. The JWS is not a JWT, so iat, exp and jti are
+// header parameters rather than claims.
+type jwsHeader struct {
+	Alg SignatureAlgorithm `json:"alg"`
+	// X5C holds the sealer certificate followed by its chain, base64 encoded.
+	X5C      []string `json:"x5c"`
+	IssuedAt *int64   `json:"iat,omitempty"`
+	Expires  *int64   `json:"exp,omitempty"`
+	ID       string   `json:"jti,omitempty"`
+	// Audience holds the x5t#S256 of the receiver certificates.
+	Audience []string          `json:"aud,omitempty"`
+	Claims   map[string]string `json:"claims,omitempty"`
+	Crit     []string          `json:"crit,omitempty"`
+	B64      *bool             `json:"b64,omitempty"`
+}
+
+// SealJWE encrypts and signs a payload like SealWithOptions, but encodes the message as a JWS nested in a JWE so it
+// can be opened by JOSE implementations using the same keys and certificates. The JWS is signed using the signature
+// algorithm of the Sealer, with the sealer certificate and its chain in x5c, the timestamps, message ID and claims as
+// the iat, exp, jti and claims header parameters, and the x5t#S256 of the receiver certificates in aud. The JWS is
+// encrypted using A256GCM, with the content key wrapped using RSA-OAEP-256 for every receiver, identified by
+// x5t#S256. All receivers must have RSA keys. Timestamps are truncated to whole seconds and metadata is not supported.
+//
+// The payload of the JWS is the payload of the message rather than a JWT claims set, so the JWE has no cty header
+// parameter. The expiry of the message is only enforced by OpenJWE; other JOSE implementations verify the signature
+// but ignore the exp header parameter.
+//
+// With a single receiver every header parameter of the JWE is protected, so it can be converted to the compact
+// serialization.
+func (s *Sealer) SealJWE(payload []byte, options SealOptions) (*JWE, error) {
+	if len(s.ReceiverCerts) == 0 {
+		return nil, errors.New("no receiver certificates")
+	}
+
+	if len(options.Metadata) > 0 {
+		return nil, errors.New("metadata is not supported by jwe messages")
+	}
+
+	if err := validateClaims(currentVersion, options.Claims); err != nil {
+		return nil, err
+	}
+
+	jws, err := s.jws(payload, options.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return joseEnvelope(jws, s.ReceiverCerts)
+}
+
+// joseEnvelope returns the JWE of a JWS for the receivers.
+func joseEnvelope(jws string, receiverCerts []*x509.Certificate) (*JWE, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	protected := map[string]interface{}{"enc": joseEncA256GCM}
+	var recipients []JWERecipient
+	for _, cert := range receiverCerts {
+		pubKey, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("receiver certificates must have rsa keys to seal a jwe")
+		}
+
+		encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pubKey, key, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		fingerprint := sha256.Sum256(cert.Raw)
+		recipients = append(recipients, JWERecipient{
+			Header: map[string]interface{}{
+				"alg":       string(RSAOAEP256),
+				joseX5TS256: base64.RawURLEncoding.EncodeToString(fingerprint[:]),
+			},
+			EncryptedKey: base64.RawURLEncoding.EncodeToString(encryptedKey),
+		})
+	}
+
+	if len(recipients) == 1 {
+		for name, value := range recipients[0].Header {
+			protected[name] = value
+		}
+		recipients[0].Header = nil
+	}
+
+	protectedJSON, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	jwe := &JWE{Protected: base64.RawURLEncoding.EncodeToString(protectedJSON), Recipients: recipients}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nil, iv, []byte(jws), jwe.additionalData())
+	jwe.IV = base64.RawURLEncoding.EncodeToString(iv)
+	jwe.Ciphertext = base64.RawURLEncoding.EncodeToString(sealed[:len(sealed)-joseTagSize])
+	jwe.Tag = base64.RawURLEncoding.EncodeToString(sealed[len(sealed)-joseTagSize:])
+
+	return jwe, nil
+}
+
+// jws returns the compact serialization of the JWS of a payload.
+func (s *Sealer) jws(payload []byte, claims map[string]string) (string, error) {
+	alg := s.SignatureAlgorithm
+	if alg == "" {
+		alg = defaultSignatureAlgorithm(s.PrivateKey)
+	}
+
+	messageID, err := newMessageID()
+	if err != nil {
+		return "", err
+	}
+
+	created := now()
+	issuedAt, expires := created.Unix(), created.Add(s.timeToLive()).Unix()
+	header := jwsHeader{
+		Alg:      alg,
+		X5C:      []string{base64.StdEncoding.EncodeToString(s.Cert.Raw)},
+		IssuedAt: &issuedAt,
+		Expires:  &expires,
+		ID:       messageID,
+		Claims:   copyClaims(claims),
+	}
+	for _, fingerprint := range s.receiverFingerprints() {
+		header.Audience = append(header.Audience, base64.RawURLEncoding.EncodeToString(fingerprint))
+	}
+	for _, cert := range s.Chain {
+		header.X5C = append(header.X5C, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+
+	headerJSON, err := json.Marshal(&header)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signStandard(alg, s.PrivateKey, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Compact returns the compact serialization of the JWE. It is only available for a JWE with a single recipient and
+// no unprotected header parameters or additional authenticated data.
+func (j *JWE) Compact() (string, error) {
+	recipients := j.recipients()
+	if len(recipients) != 1 || len(recipients[0].Header) != 0 || len(j.Unprotected) != 0 || j.AAD != "" {
+		return "", errors.New("jwe can not use the compact serialization")
+	}
+
+	return strings.Join([]string{j.Protected, recipients[0].EncryptedKey, j.IV, j.Ciphertext, j.Tag}, "."), nil
+}
+
+// ParseCompactJWE parses a JWE in the compact serialization.
+func ParseCompactJWE(token string) (*JWE, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 5 {
+		return nil, errInvalidJOSEMessage
+	}
+
+	return &JWE{
+		Protected:  parts[0],
+		Recipients: []JWERecipient{{EncryptedKey: parts[1]}},
+		IV:         parts[2],
+		Ciphertext: parts[3],
+		Tag:        parts[4],
+	}, nil
+}
+
+// recipients returns the recipients of the JWE, including the single recipient of the flattened serialization.
+func (j *JWE) recipients() []JWERecipient {
+	if len(j.Recipients) == 0 && (j.EncryptedKey != "" || len(j.Header) != 0) {
+		return []JWERecipient{{Header: j.Header, EncryptedKey: j.EncryptedKey}}
+	}
+
+	return j.Recipients
+}
+
+// additionalData returns the additional authenticated data of the content encryption.
+func (j *JWE) additionalData() []byte {
+	if j.AAD != "" {
+		return []byte(j.Protected + "." + j.AAD)
+	}
+
+	return []byte(j.Protected)
+}
+
+// OpenJWE opens a JWE sealed using SealJWE, in any serialization. The same rules as for Open apply: the sealer
+// certificate must chain to CertPool, must not be revoked and must be allowed by the SenderPolicy, the message must
+// not be expired, the aud of the JWS must hold the Opener certificate and the signature algorithm must be accepted.
+// Messages without a message ID are rejected if replay protection is enabled. Suites do not apply to JWEs. JWEs carry
+// no stapled OCSP response, so they are rejected with ErrRevocationUnknown if RequireOCSP is set.
+func (o *Opener) OpenJWE(jwe *JWE) ([]byte, *OpenInfo, error) {
+	if err := o.checkPrivateKey(); err != nil {
+		return nil, nil, err
+	}
+
+	protectedJSON, err := base64.RawURLEncoding.DecodeString(jwe.Protected)
+	if err != nil {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	var protected map[string]interface{}
+	if err := json.Unmarshal(protectedJSON, &protected); err != nil {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	shared, err := mergeJOSEHeaders(protected, jwe.Unprotected)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Compression and critical extensions are not supported.
+	if shared["enc"] != joseEncA256GCM || shared["zip"] != nil || shared["crit"] != nil {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	key, err := o.joseContentKey(jwe, shared)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plaintext, err := jwe.decrypt(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return o.openJWS(string(plaintext))
+}
+
+// mergeJOSEHeaders returns the union of sets of header parameters. A parameter can not appear in more than one set.
+func mergeJOSEHeaders(headers ...map[string]interface{}) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	for _, header := range headers {
+		for name, value := range header {
+			if _, exists := merged[name]; exists {
+				return nil, errInvalidJOSEMessage
+			}
+			merged[name] = value
+		}
+	}
+
+	return merged, nil
+}
+
+// joseContentKey unwraps the content key from the recipient addressed to the Opener.
+func (o *Opener) joseContentKey(jwe *JWE, shared map[string]interface{}) ([]byte, error) {
+	if o.Cert == nil {
+		return nil, ErrNotRecipient
+	}
+
+	fingerprint := sha256.Sum256(o.Cert.Raw)
+	x5t := base64.RawURLEncoding.EncodeToString(fingerprint[:])
+	for _, recipient := range jwe.recipients() {
+		header, err := mergeJOSEHeaders(shared, recipient.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		if header[joseX5TS256] != x5t {
+			continue
+		}
+
+		if header["alg"] != string(RSAOAEP256) {
+			return nil, ErrUnsupportedKeyWrap
+		}
+
+		decrypter, ok := o.rsaDecrypter()
+		if !ok {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		encryptedKey, err := base64.RawURLEncoding.DecodeString(recipient.EncryptedKey)
+		if err != nil {
+			return nil, errInvalidJOSEMessage
+		}
+
+		key, err := decrypter.Decrypt(rand.Reader, encryptedKey, &rsa.OAEPOptions{Hash: crypto.SHA256})
+		if err != nil || len(key) != 32 {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		return key, nil
+	}
+
+	return nil, ErrNotRecipient
+}
+
+// decrypt decrypts the content of the JWE using A256GCM.
+func (j *JWE) decrypt(key []byte) ([]byte, error) {
+	iv, err := base64.RawURLEncoding.DecodeString(j.IV)
+	if err != nil {
+		return nil, errInvalidJOSEMessage
+	}
+
+	ciphertext, err := base64.RawURLEncoding.DecodeString(j.Ciphertext)
+	if err != nil {
+		return nil, errInvalidJOSEMessage
+	}
+
+	tag, err := base64.RawURLEncoding.DecodeString(j.Tag)
+	if err != nil || len(tag) != joseTagSize {
+		return nil, errInvalidJOSEMessage
+	}
+
+	aead, err := newGCM(key)
+	if err != nil || len(iv) != aead.NonceSize() {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	plaintext, err := aead.Open(nil, iv, append(ciphertext, tag...), j.additionalData())
+	if err != nil {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	return plaintext, nil
+}
+
+// openJWS verifies the JWS decrypted from a JWE and returns its payload.
+func (o *Opener) openJWS(token string) ([]byte, *OpenInfo, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	// Critical extensions, including unencoded payloads, are not supported.
+	if header.Crit != nil || header.B64 != nil || header.IssuedAt == nil || header.Expires == nil {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, errInvalidJOSEMessage
+	}
+
+	if len(header.X5C) > maxSealerChainLength+1 {
+		return nil, nil, ErrUntrustedCert
+	}
+
+	certs := make([][]byte, 0, len(header.X5C))
+	for _, c := range header.X5C {
+		cert, err := base64.StdEncoding.DecodeString(c)
+		if err != nil {
+			return nil, nil, ErrUnableToParseSealerCert
+		}
+		certs = append(certs, cert)
+	}
+
+	if err := validateClaims(currentVersion, header.Claims); err != nil {
+		return nil, nil, err
+	}
+
+	receivers := make([][]byte, 0, len(header.Audience))
+	for _, audience := range header.Audience {
+		fingerprint, err := base64.RawURLEncoding.DecodeString(audience)
+		if err != nil {
+			return nil, nil, errInvalidJOSEMessage
+		}
+		receivers = append(receivers, fingerprint)
+	}
+
+	info, err := o.openSigned(&signedMessage{
+		alg:          header.Alg,
+		certs:        certs,
+		created:      time.Unix(*header.IssuedAt, 0),
+		expires:      time.Unix(*header.Expires, 0),
+		messageID:    header.ID,
+		claims:       header.Claims,
+		receivers:    receivers,
+		signingInput: []byte(parts[0] + "." + parts[1]),
+		signature:    signature,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payload, info, nil
+}
@@ -0,0 +1,296 @@
+package arcane
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealer_SealJWE(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name    string
+		sealer  *Sealer
+		opener  *Opener
+		options SealOptions
+		compact bool
+	}{
+		{
+			name:    "RSA",
+			sealer:  &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:  &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			compact: true,
+		},
+		{
+			name:   "Multiple receivers",
+			sealer: &Sealer{PrivateKey: signedPk1, Cert: signedCert1, SignatureAlgorithm: PS256, ReceiverCerts: []*x509.Certificate{signedCert2, signedCert3}},
+			opener: &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+		},
+		{
+			name:    "ECDSA sealer",
+			sealer:  &Sealer{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:  &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			compact: true,
+		},
+		{
+			name:    "Ed25519 sealer",
+			sealer:  &Sealer{PrivateKey: ed25519Pk, Cert: ed25519Cert, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:  &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			compact: true,
+		},
+		{
+			name:   "Chain and claims",
+			sealer: &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener: &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			options: SealOptions{
+				Claims: map[string]string{"tenantId": "tenant-1"},
+			},
+			compact: true,
+		},
+	}
+
+	for _, test := range tests {
+		jwe, err := test.sealer.SealJWE([]byte("This is a test payload."), test.options)
+		assert.NoError(t, err, test.name)
+
+		// The general JSON serialization.
+		b, err := json.Marshal(jwe)
+		assert.NoError(t, err, test.name)
+		var decoded JWE
+		assert.NoError(t, json.Unmarshal(b, &decoded), test.name)
+
+		payload, info, err := test.opener.OpenJWE(&decoded)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+		if assert.NotNil(t, info, test.name) {
+			assert.Equal(t, test.sealer.Cert, info.SealerCert, test.name)
+			assert.True(t, validMessageID(info.MessageID), test.name)
+			assert.Equal(t, test.options.Claims, info.Claims, test.name)
+			assert.True(t, now().Equal(info.Created), test.name)
+			assert.True(t, now().Add(5*time.Minute).Equal(info.Expires), test.name)
+		}
+
+		// The compact serialization.
+		compact, err := jwe.Compact()
+		if !test.compact {
+			assert.Error(t, err, test.name)
+			continue
+		}
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, 4, strings.Count(compact, "."), test.name)
+
+		parsed, err := ParseCompactJWE(compact)
+		assert.NoError(t, err, test.name)
+		payload, _, err = test.opener.OpenJWE(parsed)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+
+		// The flattened JSON serialization.
+		flattened := &JWE{Protected: jwe.Protected, EncryptedKey: jwe.Recipients[0].EncryptedKey, IV: jwe.IV, Ciphertext: jwe.Ciphertext, Tag: jwe.Tag}
+		payload, _, err = test.opener.OpenJWE(flattened)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+	}
+
+	_, err := (&Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{ecdsaCert1}}).SealJWE([]byte("This is a test payload."), SealOptions{})
+	assert.Error(t, err)
+}
+
+func TestOpener_OpenJWE(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	jwe, err := sealer.SealJWE([]byte("This is a test payload."), SealOptions{})
+	assert.NoError(t, err)
+
+	// The protected header is authenticated along with the content.
+	protected, err := base64.RawURLEncoding.DecodeString(jwe.Protected)
+	assert.NoError(t, err)
+	// The content is a JWS but not a JWT.
+	assert.NotContains(t, string(protected), `"cty"`)
+
+	// A receiver can encrypt the JWS for someone else, but not change the receivers it is signed for.
+	var shared map[string]interface{}
+	assert.NoError(t, json.Unmarshal(protected, &shared))
+	key, err := (&Opener{PrivateKey: signedPk2, Cert: signedCert2}).joseContentKey(jwe, shared)
+	assert.NoError(t, err)
+	jws, err := jwe.decrypt(key)
+	assert.NoError(t, err)
+	forwarded, err := joseEnvelope(string(jws), []*x509.Certificate{signedCert3})
+	assert.NoError(t, err)
+	tampered := *jwe
+	tampered.Protected = base64.RawURLEncoding.EncodeToString(append(protected[:len(protected)-1], []byte(`,"kid":"1"}`)...))
+
+	unprotected := *jwe
+	unprotected.Unprotected = map[string]interface{}{"enc": "A128GCM"}
+
+	replayCache := NewMemoryReplayCache()
+	_, _, err = (&Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: replayCache}).OpenJWE(jwe)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		opener      *Opener
+		jwe         *JWE
+		now         time.Time
+		expectedErr error
+	}{
+		{
+			name:        "Not recipient",
+			opener:      &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+			jwe:         jwe,
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Forwarded",
+			opener:      &Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool},
+			jwe:         forwarded,
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Untrusted",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: ca2CertPool},
+			jwe:         jwe,
+			expectedErr: ErrUntrustedCert,
+		},
+		{
+			name:        "Expired",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			jwe:         jwe,
+			now:         now().Add(6 * time.Minute),
+			expectedErr: ErrMessageExpired,
+		},
+		{
+			name:        "Not yet valid",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			jwe:         jwe,
+			now:         now().Add(-time.Minute),
+			expectedErr: ErrMessageNotYetValid,
+		},
+		{
+			name:        "Signature algorithm not allowed",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, SignatureAlgorithms: []SignatureAlgorithm{ES256}},
+			jwe:         jwe,
+			expectedErr: ErrUnsupportedSignatureAlgorithm,
+		},
+		{
+			name:        "OCSP required",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, RequireOCSP: true},
+			jwe:         jwe,
+			expectedErr: ErrRevocationUnknown,
+		},
+		{
+			name:        "Replayed",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: replayCache},
+			jwe:         jwe,
+			expectedErr: ErrReplayedMessage,
+		},
+		{
+			name:        "Tampered protected header",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			jwe:         &tampered,
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Duplicate header parameter",
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+			jwe:         &unprotected,
+			expectedErr: errInvalidJOSEMessage,
+		},
+	}
+
+	sealed := now()
+	for _, test := range tests {
+		if !test.now.IsZero() {
+			setNow(t, test.now)
+		}
+
+		_, _, err := test.opener.OpenJWE(test.jwe)
+		assert.Equal(t, test.expectedErr, err, test.name)
+
+		setNow(t, sealed)
+	}
+
+	_, err = ParseCompactJWE("a.b.c")
+	assert.Equal(t, errInvalidJOSEMessage, err)
+}
+
+func TestOpener_OpenJWSHeader(t *testing.T) {
+	setNow(t, sealTime)
+
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+	sign := func(header string) string {
+		signingInput := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte("payload"))
+		signature, err := signStandard(RS256, signedPk1, []byte(signingInput))
+		assert.NoError(t, err)
+		return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	x5c := `"x5c":["` + base64.StdEncoding.EncodeToString(signedCert1.Raw) + `"]`
+	aud := func(cert *x509.Certificate) string {
+		fingerprint := sha256.Sum256(cert.Raw)
+		return `,"aud":["` + base64.RawURLEncoding.EncodeToString(fingerprint[:]) + `"]`
+	}
+	iat := now().Unix()
+
+	tests := []struct {
+		name        string
+		header      string
+		expectedErr error
+	}{
+		{
+			name:   "Valid",
+			header: `{"alg":"RS256",` + x5c + aud(signedCert2) + `,"iat":` + strconv.FormatInt(iat, 10) + `,"exp":` + strconv.FormatInt(iat+60, 10) + `}`,
+		},
+		{
+			name:        "No audience",
+			header:      `{"alg":"RS256",` + x5c + `,"iat":` + strconv.FormatInt(iat, 10) + `,"exp":` + strconv.FormatInt(iat+60, 10) + `}`,
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "Other audience",
+			header:      `{"alg":"RS256",` + x5c + aud(signedCert3) + `,"iat":` + strconv.FormatInt(iat, 10) + `,"exp":` + strconv.FormatInt(iat+60, 10) + `}`,
+			expectedErr: ErrNotRecipient,
+		},
+		{
+			name:        "No algorithm",
+			header:      `{"alg":"none",` + x5c + `,"iat":` + strconv.FormatInt(iat, 10) + `,"exp":` + strconv.FormatInt(iat+60, 10) + `}`,
+			expectedErr: ErrUnsupportedSignatureAlgorithm,
+		},
+		{
+			name:        "No expiry",
+			header:      `{"alg":"RS256",` + x5c + `,"iat":` + strconv.FormatInt(iat, 10) + `}`,
+			expectedErr: errInvalidJOSEMessage,
+		},
+		{
+			name:        "Critical extension",
+			header:      `{"alg":"RS256",` + x5c + `,"iat":` + strconv.FormatInt(iat, 10) + `,"exp":` + strconv.FormatInt(iat+60, 10) + `,"crit":["b64"],"b64":false}`,
+			expectedErr: errInvalidJOSEMessage,
+		},
+		{
+			name:        "No certificate",
+			header:      `{"alg":"RS256","iat":` + strconv.FormatInt(iat, 10) + `,"exp":` + strconv.FormatInt(iat+60, 10) + `}`,
+			expectedErr: ErrUnableToParseSealerCert,
+		},
+		{
+			name:        "Reserved claim",
+			header:      `{"alg":"RS256",` + x5c + `,"iat":` + strconv.FormatInt(iat, 10) + `,"exp":` + strconv.FormatInt(iat+60, 10) + `,"claims":{"exp":"0"}}`,
+			expectedErr: &InvalidClaimError{Name: "exp", Reserved: true},
+		},
+	}
+
+	for _, test := range tests {
+		payload, _, err := opener.openJWS(sign(test.header))
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr == nil {
+			assert.Equal(t, []byte("payload"), payload, test.name)
+		}
+	}
+}
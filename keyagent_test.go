@@ -0,0 +1,93 @@
+package arcane
+
+import (
+	"crypto"
+	"crypto/x509"
+	"testing"
+
+	"github.com/larwef/arcane/internal/keyagent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealerAndOpenerKeyAgent(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name         string
+		sealerKey    crypto.Signer
+		sealerCert   *x509.Certificate
+		sealerAlg    SignatureAlgorithm
+		receiverKey  crypto.Signer
+		receiverCert *x509.Certificate
+	}{
+		{
+			name:         "RSA",
+			sealerKey:    signedPk1,
+			sealerCert:   signedCert1,
+			receiverKey:  signedPk2,
+			receiverCert: signedCert2,
+		},
+		{
+			name:         "RSA PSS",
+			sealerKey:    signedPk1,
+			sealerCert:   signedCert1,
+			sealerAlg:    PS256,
+			receiverKey:  signedPk2,
+			receiverCert: signedCert2,
+		},
+		{
+			name:         "ECDSA",
+			sealerKey:    ecdsaPk1,
+			sealerCert:   ecdsaCert1,
+			receiverKey:  ecdsaPk1,
+			receiverCert: ecdsaCert1,
+		},
+		{
+			name:         "Ed25519",
+			sealerKey:    ed25519Pk,
+			sealerCert:   ed25519Cert,
+			receiverKey:  ed25519Pk,
+			receiverCert: ed25519Cert,
+		},
+	}
+
+	for _, test := range tests {
+		sealerAgent := keyagent.New(test.sealerKey)
+		receiverAgent := keyagent.New(test.receiverKey)
+
+		sealer := &Sealer{PrivateKey: sealerAgent, Cert: test.sealerCert, ReceiverCerts: []*x509.Certificate{test.receiverCert}, SignatureAlgorithm: test.sealerAlg}
+		opener := &Opener{PrivateKey: receiverAgent, Cert: test.receiverCert, CertPool: caCertPool}
+
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err, test.name)
+
+		payload, err := opener.Open(message)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+
+		sealerAgent.Close()
+		receiverAgent.Close()
+	}
+}
+
+func TestOpener_OpenKeyAgentPKCS1v15(t *testing.T) {
+	setNow(t, sealTime)
+
+	agent := keyagent.New(signedPk2)
+	defer agent.Close()
+
+	message := &Envelope{
+		Header: Header{
+			SealerCert:   base64Decode("MIIEWDCCAkCgAwIBAgIBZTANBgkqhkiG9w0BAQsFADBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wHhcNMjAxMDMxMjAxNDM4WhcNMjMxMDMxMjAxNDM4WjBWMQswCQYDVQQGEwJOTzEJMAcGA1UECBMAMRAwDgYDVQQHEwdEcmFtbWVuMQ0wCwYDVQQREwQzMDQxMRswGQYDVQQKExJMZWdpdCBDb21wYW55IElOQy4wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDL75yIXDMATDviotxLwXz80MSrUcqH0OrfK3G3hl5wHrJ8x1PCP/TRTo6PYcUWDyrC5wDPUrFoZ2whyB+4SDkB7CKd/g8CTZeUyNE0wYOjzvgoUeeLa57wBj69cXcYEAndCuxNVJI1fbN+t7YmhHnd6jFIo+/X2gKIq6PwxkPIGrgQzb8H68OkDacw6R6eayYRG1p6R5+sV0qa83RyJBxRg2eflg2KwIcmd4dHO05uSs2t4XZq9AapBa4p7QZ0LSYTxTlGX1Me9t6nnS8zLymGxNFv5iXGxlDSBnnn75nFewm15AVyUz1WCe58V91yc5pqRvRc90wTA3ODmV2ntI9bAgMBAAGjMTAvMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUEFjAUBggrBgEFBQcDAgYIKwYBBQUHAwEwDQYJKoZIhvcNAQELBQADggIBAHXvqPebyIgkn5XJ121rt0HdXK/I/wJhaIy6tMl2ZTtCcmd5nbEdXrUfKgmv4bWHwqIUzcis4iNoWOWNioxiT1M6aUKdMR7DyugoBofBulWMyhW3qYStiHXIEyaYQvkBHgkzA9CgoKNNXkw3cEvFi8komcGS0QIDfcIERr+zwKpqiNxKVPthdNY6qFgDHj5e5whdPEGpDI1DVmoLB0aMMpYeBspq3zkotgqHCpy0xAxZBA5gwUvAtNPPDJJAZz5o0AedBuxNWHIyXreDPqr008iG/ZKM3QI9IH3b4BrgkIm3sNGiG+dIcyrBzEqdn9e6xtjz7QRLHRoyb0SKZsb/2ulgdzWNpP1rUMwwzYE4XdRCNbhAGxw3o8SwmCmD5VbdrWGY7afRxEmFDCZTAwyFcxdop2rMpsaZD89/gmqihOVlDwAwOw/5J8ljpePUDocMSZuxcNqqVhSM/lbnUdpla/lBpa2fa/RkZ9ri0Z8/nlLci2CHxCz0ALpf/blNOGF33GsNXmTEuFmg2/ikRhIcF4sX2YQCH5AOnBuaTe/6NqBwECbhP9/fdsF9a/AAmPe3YHvsP6lvWrZPCOwg5BX6sTxjPW/apgvuDcHL1noWaiNB126b6i3b5ohoTIveAApoe6t3QDePry3HllRLe2ux5CqdorX0A7gYpn3+Ht7GwZVD"),
+			Signature:    base64Decode("T6ZACEUlFLs0Ph7aHMrS8dgfcv8NP7X/+tP0bhr5AYoANmSOjeeLGAgLsRX+39ulem7HdnmQe8/JDjUng5xnOjojz9Sm4xn54VnpIOYUWlCMzbK7XAqVHREjEOw5LvgDpePJ3NZRHpTSfGeHj3wXqH9JH3vGzxd8DZjCqgB2+A3AKt/8x/qs54o0fW1AS96/w3a9EpcOwxRhPjNThL9KVsezreMD3/xtykVu6tsOGGuOeYwW7pnUBewW+85jaDkIAHsONmklgXGk1i6BUhsXJdM2q/qTJgpLJdaFJ6H3++YvM2I9946jnCv656wjWVp6svqYxDqN3jaq4jHg7XumrQ=="),
+			EncryptedKey: base64Decode("QWoRQFGjzgiCLZyd01n9+zWgele49cdSYCzyABGnhaqo6XHV+z4pV2fluqVPYwNG79ShnvJSAJi6kq7cN0a+CXs7PSankWWtoHzNZVKfSGV6kPZsN/f95YXlXN7CtC34WvbyvRCeYhgiRB9LjVKIAN568tFwgdnhKLCn+uYxg2pRlXdKpYQIBjepVC+x6ub2mBk3BAjWaPfs7g7ZX8CvoAMsUPhz6cYhYJU4CiprO9mq4/JwLHDwYsRKubsMBTh7dTsFvrcmtxUtmScp3IVCwkXOCG+JAiHKzSJpjcMh10MoNs/DZSBtYDjYMydsfrIaCj7QpdsHq8SrYgRsV6NMbw=="),
+			Created:      "2020-11-26T18:37:56+01:00",
+			Expires:      "2020-11-26T18:42:56+01:00",
+		},
+		Payload: base64Decode("4EeszCLhFjgpVVyXahSEXrUD/4hVMOq4u8XqsMkjuIQIm7zArID5b0386w=="),
+	}
+
+	opener := &Opener{PrivateKey: agent, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true}
+	_, err := opener.Open(message)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,228 @@
+package arcane
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/larwef/arcane/internal/x25519"
+)
+
+// keyAgreementPublicKey returns the key agreement public key and key wrap algorithm to use for a receiver public key.
+// Ed25519 keys are converted to their X25519 equivalent, so the key of a receiver certificate is used both to sign and
+// for key agreement. Receivers that want separate keys use a certificate with an X25519 key for receiving.
+func keyAgreementPublicKey(pubKey crypto.PublicKey) (*ecdh.PublicKey, KeyWrapAlgorithm, error) {
+	switch key := pubKey.(type) {
+	case *ecdsa.PublicKey:
+		ecdhKey, err := key.ECDH()
+		if err != nil || ecdhKey.Curve() != ecdh.P256() {
+			return nil, "", errors.New("receiver ecdsa key must use curve P-256")
+		}
+		return ecdhKey, ECDHESHKDF256, nil
+	case *ecdh.PublicKey:
+		if key.Curve() == ecdh.P256() {
+			return key, ECDHESHKDF256, nil
+		}
+		if key.Curve() == ecdh.X25519() {
+			return key, X25519HKDF256, nil
+		}
+		return nil, "", errors.New("receiver ecdh key must use curve P-256 or X25519")
+	case ed25519.PublicKey:
+		ecdhKey, err := x25519.FromEd25519PublicKey(key)
+		if err != nil {
+			return nil, "", err
+		}
+		return ecdhKey, X25519HKDF256, nil
+	default:
+		return nil, "", errors.New("receiver public key does not support key agreement")
+	}
+}
+
+// KeyAgreer is implemented by private keys that can perform ECDH key agreement, such as *ecdh.PrivateKey. Public must
+// return an *ecdh.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey. When the public key is an Ed25519 key, ECDH must be
+// performed using the X25519 equivalent of the private key. It allows keys held outside the process to be used by an
+// Opener.
+type KeyAgreer interface {
+	Public() crypto.PublicKey
+	ECDH(remote *ecdh.PublicKey) ([]byte, error)
+}
+
+// keyAgreer returns the KeyAgreer for a receiver private key. Ed25519 keys are converted to their X25519 equivalent.
+func keyAgreer(privKey crypto.PrivateKey) (KeyAgreer, error) {
+	switch key := privKey.(type) {
+	case *ecdsa.PrivateKey:
+		return key.ECDH()
+	case ed25519.PrivateKey:
+		return x25519.FromEd25519PrivateKey(key)
+	case KeyAgreer:
+		return key, nil
+	default:
+		return nil, errors.New("private key does not support key agreement")
+	}
+}
+
+// keyEncryptionCipher derives a key encryption key from the shared secret between the ephemeral and receiver keys. A
+// new ephemeral key is generated for every recipient, so the key encryption key is only ever used once and a fixed
+// nonce is safe.
+func keyEncryptionCipher(alg KeyWrapAlgorithm, sharedSecret, ephemeralKey, receiverKey []byte) (cipher.AEAD, error) {
+	salt := make([]byte, 0, len(ephemeralKey)+len(receiverKey))
+	salt = append(salt, ephemeralKey...)
+	salt = append(salt, receiverKey...)
+
+	kek, err := hkdf.Key(sha256.New, sharedSecret, salt, "arcane "+string(alg), 32)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(c)
+}
+
+// wrapKeyECDH encrypts key using a key derived from ephemeral-static ECDH with the receiver key.
+func wrapKeyECDH(alg KeyWrapAlgorithm, receiverKey *ecdh.PublicKey, key, label []byte) (ephemeralKey, encryptedKey []byte, err error) {
+	ephemeral, err := receiverKey.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sharedSecret, err := ephemeral.ECDH(receiverKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ephemeralKey = ephemeral.PublicKey().Bytes()
+	gcm, err := keyEncryptionCipher(alg, sharedSecret, ephemeralKey, receiverKey.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ephemeralKey, gcm.Seal(nil, make([]byte, gcm.NonceSize()), key, label), nil
+}
+
+// unwrapKeyECDH decrypts an encryption key wrapped by wrapKeyECDH.
+func unwrapKeyECDH(alg KeyWrapAlgorithm, privKey crypto.PrivateKey, ephemeralKey, encryptedKey, label []byte) ([]byte, error) {
+	agreer, err := keyAgreer(privKey)
+	if err != nil {
+		return nil, ErrUnableToGetEncryptionKey
+	}
+
+	receiverKey, receiverAlg, err := keyAgreementPublicKey(agreer.Public())
+	if err != nil || receiverAlg != alg {
+		return nil, ErrUnableToGetEncryptionKey
+	}
+
+	ephemeral, err := receiverKey.Curve().NewPublicKey(ephemeralKey)
+	if err != nil {
+		return nil, ErrUnableToGetEncryptionKey
+	}
+
+	sharedSecret, err := agreer.ECDH(ephemeral)
+	if err != nil {
+		return nil, ErrUnableToGetEncryptionKey
+	}
+
+	gcm, err := keyEncryptionCipher(alg, sharedSecret, ephemeralKey, receiverKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := gcm.Open(nil, make([]byte, gcm.NonceSize()), encryptedKey, label)
+	if err != nil {
+		return nil, ErrUnableToGetEncryptionKey
+	}
+
+	return key, nil
+}
+
+// aesKeyWrapIV is the default initial value of the AES key wrap algorithm.
+var aesKeyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// aesKeyWrap wraps key using the AES key wrap algorithm of RFC 3394. It is used by the key wrap algorithms of COSE,
+// which are defined in terms of it.
+func aesKeyWrap(kek, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, errors.New("invalid key length for aes key wrap")
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(key) / 8
+	wrapped := make([]byte, 8+len(key))
+	copy(wrapped, aesKeyWrapIV)
+	copy(wrapped[8:], key)
+
+	b := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, wrapped[:8])
+			copy(b[8:], wrapped[8*i:8*i+8])
+			block.Encrypt(b, b)
+
+			t := uint64(n*j + i)
+			for k := 7; k >= 0; k-- {
+				b[k] ^= byte(t)
+				t >>= 8
+			}
+
+			copy(wrapped[:8], b[:8])
+			copy(wrapped[8*i:], b[8:])
+		}
+	}
+
+	return wrapped, nil
+}
+
+// aesKeyUnwrap unwraps a key wrapped by aesKeyWrap.
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, ErrUnableToGetEncryptionKey
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(wrapped)/8 - 1
+	key := make([]byte, len(wrapped))
+	copy(key, wrapped)
+
+	b := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			copy(b, key[:8])
+			t := uint64(n*j + i)
+			for k := 7; k >= 0; k-- {
+				b[k] ^= byte(t)
+				t >>= 8
+			}
+
+			copy(b[8:], key[8*i:8*i+8])
+			block.Decrypt(b, b)
+
+			copy(key[:8], b[:8])
+			copy(key[8*i:], b[8:])
+		}
+	}
+
+	if subtle.ConstantTimeCompare(key[:8], aesKeyWrapIV) != 1 {
+		return nil, ErrUnableToGetEncryptionKey
+	}
+
+	return key[8:], nil
+}
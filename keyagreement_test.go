@@ -0,0 +1,172 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealerAndOpenerEllipticCurve(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name         string
+		sealerKey    crypto.Signer
+		sealerCert   *x509.Certificate
+		receiverKey  crypto.PrivateKey
+		receiverCert *x509.Certificate
+		expectedSig  SignatureAlgorithm
+		expectedWrap KeyWrapAlgorithm
+	}{
+		{
+			name:         "ECDSA to ECDSA",
+			sealerKey:    ecdsaPk1,
+			sealerCert:   ecdsaCert1,
+			receiverKey:  ecdsaPk1,
+			receiverCert: ecdsaCert1,
+			expectedSig:  ES256,
+			expectedWrap: ECDHESHKDF256,
+		},
+		{
+			name:         "ECDSA to Ed25519",
+			sealerKey:    ecdsaPk1,
+			sealerCert:   ecdsaCert1,
+			receiverKey:  ed25519Pk,
+			receiverCert: ed25519Cert,
+			expectedSig:  ES256,
+			expectedWrap: X25519HKDF256,
+		},
+		{
+			name:         "Ed25519 to ECDSA",
+			sealerKey:    ed25519Pk,
+			sealerCert:   ed25519Cert,
+			receiverKey:  ecdsaPk1,
+			receiverCert: ecdsaCert1,
+			expectedSig:  EdDSA,
+			expectedWrap: ECDHESHKDF256,
+		},
+		{
+			name:         "Ed25519 to RSA",
+			sealerKey:    ed25519Pk,
+			sealerCert:   ed25519Cert,
+			receiverKey:  signedPk2,
+			receiverCert: signedCert2,
+			expectedSig:  EdDSA,
+			expectedWrap: RSAOAEP256,
+		},
+		{
+			name:         "RSA to Ed25519",
+			sealerKey:    signedPk1,
+			sealerCert:   signedCert1,
+			receiverKey:  ed25519Pk,
+			receiverCert: ed25519Cert,
+			expectedSig:  RS256,
+			expectedWrap: X25519HKDF256,
+		},
+	}
+
+	for _, test := range tests {
+		sealer := &Sealer{PrivateKey: test.sealerKey, Cert: test.sealerCert, ReceiverCerts: []*x509.Certificate{test.receiverCert}}
+		opener := &Opener{PrivateKey: test.receiverKey, Cert: test.receiverCert, CertPool: caCertPool}
+
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expectedSig, message.Header.SignatureAlgorithm, test.name)
+		assert.Equal(t, test.expectedWrap, message.Header.Recipients[0].Algorithm, test.name)
+
+		payload, err := opener.Open(message)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+	}
+}
+
+func TestSealerAndOpenerMixedRecipients(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, ReceiverCerts: []*x509.Certificate{signedCert2, ecdsaCert1, ed25519Cert}}
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+
+	openers := []*Opener{
+		{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool},
+		{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, CertPool: caCertPool},
+		{PrivateKey: ed25519Pk, Cert: ed25519Cert, CertPool: caCertPool},
+	}
+
+	for _, opener := range openers {
+		payload, err := opener.Open(message)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("This is a test payload."), payload)
+	}
+
+	// Swapping ephemeral keys between recipients must not give access to the encryption key.
+	message.Header.Recipients[1].EphemeralKey = message.Header.Recipients[2].EphemeralKey
+	_, err = openers[1].Open(message)
+	assert.Equal(t, ErrUnableToGetEncryptionKey, err)
+}
+
+func TestOpener_OpenWrongKeyType(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{ecdsaCert1, signedCert2}}
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+
+	// Keys not matching the certificate used to find the recipient.
+	_, err = (&Opener{PrivateKey: signedPk2, Cert: ecdsaCert1, CertPool: caCertPool}).Open(message)
+	assert.Equal(t, ErrUnableToGetEncryptionKey, err)
+	_, err = (&Opener{PrivateKey: ed25519Pk, Cert: ecdsaCert1, CertPool: caCertPool}).Open(message)
+	assert.Equal(t, ErrUnableToGetEncryptionKey, err)
+	_, err = (&Opener{PrivateKey: ecdsaPk1, Cert: signedCert2, CertPool: caCertPool}).Open(message)
+	assert.Equal(t, ErrUnableToGetEncryptionKey, err)
+}
+
+func TestOpener_OpenUnsupportedPrivateKey(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+
+	// The key type is checked before the message is processed.
+	for _, privateKey := range []crypto.PrivateKey{nil, []byte("not a key"), signedPk2.Public()} {
+		opener := &Opener{PrivateKey: privateKey, Cert: signedCert2, CertPool: caCertPool}
+
+		_, err = opener.Open(message)
+		assert.Equal(t, ErrUnsupportedPrivateKey, err)
+		assert.Equal(t, ErrUnsupportedPrivateKey, opener.OpenStream(ioutil.Discard, bytes.NewReader(nil)))
+		_, _, err = opener.OpenCOSE(nil)
+		assert.Equal(t, ErrUnsupportedPrivateKey, err)
+		_, _, err = opener.OpenJWE(&JWE{})
+		assert.Equal(t, ErrUnsupportedPrivateKey, err)
+		_, _, err = opener.OpenCMS(nil)
+		assert.Equal(t, ErrUnsupportedPrivateKey, err)
+	}
+}
+
+func TestSealer_SealX25519Receiver(t *testing.T) {
+	receiverKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	pubKey, alg, err := keyAgreementPublicKey(receiverKey.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, X25519HKDF256, alg)
+
+	ephemeralKey, encryptedKey, err := wrapKeyECDH(alg, pubKey, []byte("0123456789abcdef0123456789abcdef"), []byte("label"))
+	assert.NoError(t, err)
+
+	key, err := unwrapKeyECDH(alg, receiverKey, ephemeralKey, encryptedKey, []byte("label"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), key)
+
+	_, err = unwrapKeyECDH(alg, receiverKey, ephemeralKey, encryptedKey, []byte("other label"))
+	assert.Equal(t, ErrUnableToGetEncryptionKey, err)
+	_, err = unwrapKeyECDH(ECDHESHKDF256, receiverKey, ephemeralKey, encryptedKey, []byte("label"))
+	assert.Equal(t, ErrUnableToGetEncryptionKey, err)
+}
@@ -0,0 +1,67 @@
+package arcane
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// maxMetadataSize limits the size of the encrypted metadata of a message.
+const maxMetadataSize = 64 * 1024
+
+// sealMetadata encrypts the metadata of a message using the content cipher of the message. The header, without the
+// encrypted metadata, is used as additional data. The encrypted metadata is in turn part of the header, so it is
+// authenticated along with the payload and covered by the signature.
+func sealMetadata(aead cipher.AEAD, header *Header, metadata map[string]string) ([]byte, error) {
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	encrypted := aead.Seal(nonce, nonce, b, metadataAdditionalData(header))
+	if len(encrypted) > maxMetadataSize {
+		return nil, errors.New("metadata exceeds limit")
+	}
+
+	return encrypted, nil
+}
+
+// openMetadata decrypts the metadata of a message. It returns nil if the message has no metadata.
+func openMetadata(aead cipher.AEAD, header *Header) (map[string]string, error) {
+	if len(header.EncryptedMetadata) == 0 {
+		return nil, nil
+	}
+
+	nonceSize := aead.NonceSize()
+	if header.Version < versionMetadata || len(header.EncryptedMetadata) > maxMetadataSize || len(header.EncryptedMetadata) < nonceSize {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	nonce, ciphertext := header.EncryptedMetadata[:nonceSize], header.EncryptedMetadata[nonceSize:]
+	b, err := aead.Open(nil, nonce, ciphertext, metadataAdditionalData(header))
+	if err != nil {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	var metadata map[string]string
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	return metadata, nil
+}
+
+// metadataAdditionalData returns the canonical encoding of the header without the encrypted metadata.
+func metadataAdditionalData(header *Header) []byte {
+	h := *header
+	h.EncryptedMetadata = nil
+
+	return h.additionalData()
+}
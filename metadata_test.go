@@ -0,0 +1,112 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealer_SealWithOptionsMetadata(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, ecdsaCert1}}
+	rsaOpener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+	ecOpener := &Opener{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, CertPool: caCertPool}
+
+	metadata := map[string]string{"filename": "invoice-2020-11.pdf", "customerId": "c-1234"}
+	message, err := sealer.SealWithOptions([]byte("This is a test payload."), SealOptions{
+		Claims:   map[string]string{"contentType": "application/pdf"},
+		Metadata: metadata,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, currentVersion, message.Header.Version)
+	assert.NotEmpty(t, message.Header.EncryptedMetadata)
+
+	// Metadata is not visible in the header.
+	b, err := json.Marshal(message)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "invoice")
+	assert.NotContains(t, string(b), "customerId")
+
+	for _, opener := range []*Opener{rsaOpener, ecOpener} {
+		payload, info, err := opener.OpenWithInfo(message)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("This is a test payload."), payload)
+		assert.Equal(t, metadata, info.Metadata)
+		assert.Equal(t, map[string]string{"contentType": "application/pdf"}, info.Claims)
+	}
+
+	// Messages without metadata have none.
+	message, err = sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	assert.Empty(t, message.Header.EncryptedMetadata)
+	_, info, err := rsaOpener.OpenWithInfo(message)
+	assert.NoError(t, err)
+	assert.Nil(t, info.Metadata)
+
+	// Metadata is limited in size.
+	_, err = sealer.SealWithOptions([]byte("This is a test payload."), SealOptions{
+		Metadata: map[string]string{"large": strings.Repeat("a", maxMetadataSize)},
+	})
+	assert.Error(t, err)
+}
+
+func TestOpener_OpenMetadataAuthenticated(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+
+	other, err := sealer.SealWithOptions([]byte("This is a test payload."), SealOptions{
+		Metadata: map[string]string{"filename": "other.pdf"},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		tamper      func(header *Header)
+		expectedErr error
+	}{
+		{name: "Flipped bit", tamper: func(header *Header) { header.EncryptedMetadata[len(header.EncryptedMetadata)-1] ^= 1 }, expectedErr: ErrUnableToDecryptPayload},
+		{name: "Removed", tamper: func(header *Header) { header.EncryptedMetadata = nil }, expectedErr: ErrUnableToDecryptPayload},
+		{name: "Truncated", tamper: func(header *Header) { header.EncryptedMetadata = header.EncryptedMetadata[:4] }, expectedErr: ErrUnableToDecryptPayload},
+		{name: "Swapped", tamper: func(header *Header) { header.EncryptedMetadata = other.Header.EncryptedMetadata }, expectedErr: ErrUnableToDecryptPayload},
+		{name: "Version downgraded", tamper: func(header *Header) { header.Version = versionClaims }, expectedErr: &UnsupportedVersionError{Version: versionClaims}},
+	}
+
+	for _, test := range tests {
+		message, err := sealer.SealWithOptions([]byte("This is a test payload."), SealOptions{
+			Metadata: map[string]string{"filename": "invoice.pdf"},
+		})
+		assert.NoError(t, err)
+
+		test.tamper(&message.Header)
+
+		payload, info, err := opener.OpenWithInfo(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		assert.Nil(t, payload, test.name)
+		assert.Nil(t, info, test.name)
+	}
+
+	// Streams can not carry metadata.
+	var sealed bytes.Buffer
+	assert.NoError(t, sealer.SealStream(&sealed, strings.NewReader("This is a test payload.")))
+	headerBytes, err := readLengthPrefixed(&sealed, maxStreamHeaderSize)
+	assert.NoError(t, err)
+
+	var header Header
+	assert.NoError(t, json.Unmarshal(headerBytes, &header))
+	header.EncryptedMetadata = other.Header.EncryptedMetadata
+	headerBytes, err = json.Marshal(&header)
+	assert.NoError(t, err)
+
+	var tampered bytes.Buffer
+	assert.NoError(t, writeLengthPrefixed(&tampered, headerBytes))
+	tampered.Write(sealed.Bytes())
+	assert.Error(t, opener.OpenStream(ioutil.Discard, &tampered))
+}
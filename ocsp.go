@@ -0,0 +1,125 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// defaultOCSPMaxAge is the maximum age of a stapled OCSP response if Opener.OCSPMaxAge is not set.
+const defaultOCSPMaxAge = 7 * 24 * time.Hour
+
+// maxOCSPResponseSize limits the size of a response read by FetchOCSPResponse.
+const maxOCSPResponseSize = 64 * 1024
+
+// FetchOCSPResponse requests the OCSP status of cert from the responder at url and returns the DER encoded response,
+// which can be stapled to messages using Sealer.OCSPResponse. If url is empty the first OCSP server listed in cert is
+// used. The response is verified to be signed for cert by issuer, but its status is not checked.
+func FetchOCSPResponse(client *http.Client, url string, cert, issuer *x509.Certificate) ([]byte, error) {
+	if url == "" {
+		if len(cert.OCSPServer) == 0 {
+			return nil, errors.New("certificate has no ocsp server")
+		}
+		url = cert.OCSPServer[0]
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Post(url, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("ocsp responder returned " + resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > maxOCSPResponseSize {
+		return nil, errors.New("ocsp response exceeds limit")
+	}
+
+	if _, err := ocsp.ParseResponseForCert(body, cert, issuer); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// checkOCSP validates the OCSP response stapled to a message. The response must be signed by the issuer of the sealer
+// certificate in the chain accepted by the Opener, or by a responder certificate the issuer delegated OCSP signing to.
+func (o *Opener) checkOCSP(ocspResponse []byte, chain []*x509.Certificate) error {
+	if len(ocspResponse) == 0 {
+		if o.RequireOCSP {
+			return ErrRevocationUnknown
+		}
+		return nil
+	}
+
+	if len(chain) < 2 {
+		return ErrInvalidOCSPResponse
+	}
+
+	response, err := ocsp.ParseResponseForCert(ocspResponse, chain[0], chain[1])
+	if err != nil || response.Certificate != nil && !o.validOCSPResponder(response.Certificate) {
+		return ErrInvalidOCSPResponse
+	}
+
+	maxAge := o.OCSPMaxAge
+	if maxAge == 0 {
+		maxAge = defaultOCSPMaxAge
+	}
+
+	t := now()
+	if response.ThisUpdate.After(t.Add(o.ClockSkew)) || t.Sub(response.ThisUpdate) > maxAge+o.ClockSkew {
+		return ErrInvalidOCSPResponse
+	}
+
+	if !response.NextUpdate.IsZero() && t.After(response.NextUpdate.Add(o.ClockSkew)) {
+		return ErrInvalidOCSPResponse
+	}
+
+	switch response.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return ErrRevokedCert
+	default:
+		return ErrRevocationUnknown
+	}
+}
+
+// validOCSPResponder reports whether a delegated responder certificate, already verified to be signed by the issuer,
+// is valid and allowed to sign OCSP responses.
+func (o *Opener) validOCSPResponder(cert *x509.Certificate) bool {
+	t := now()
+	if t.Before(cert.NotBefore) || t.After(cert.NotAfter) {
+		return false
+	}
+
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+
+	return false
+}
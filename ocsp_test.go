@@ -0,0 +1,137 @@
+package arcane
+
+import (
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/larwef/arcane/internal/ocspresponder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpener_OpenOCSP(t *testing.T) {
+	setNow(t, sealTime)
+
+	responder := ocspresponder.New(ca2Cert, ca2Pk)
+	responder.Now = func() time.Time { return now().Add(-time.Hour) }
+	responder.Revoke(revokedCert1.SerialNumber, now().Add(-2*time.Hour))
+
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	good, err := FetchOCSPResponse(server.Client(), server.URL, signedCert4, ca2Cert)
+	assert.NoError(t, err)
+	revoked, err := FetchOCSPResponse(server.Client(), server.URL, revokedCert1, ca2Cert)
+	assert.NoError(t, err)
+
+	// Responses are verified when fetched.
+	_, err = FetchOCSPResponse(server.Client(), server.URL, signedCert4, caCert)
+	assert.Error(t, err)
+	_, err = FetchOCSPResponse(server.Client(), "", signedCert4, ca2Cert)
+	assert.Error(t, err)
+
+	responder.Now = func() time.Time { return now().Add(-8 * 24 * time.Hour) }
+	responder.Validity = 30 * 24 * time.Hour
+	stale, err := FetchOCSPResponse(server.Client(), server.URL, signedCert4, ca2Cert)
+	assert.NoError(t, err)
+
+	responder.Validity = 0
+	expired, err := FetchOCSPResponse(server.Client(), server.URL, signedCert4, ca2Cert)
+	assert.NoError(t, err)
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(caCert)
+	certPool.AddCert(ca2Cert)
+
+	tests := []struct {
+		name        string
+		sealer      *Sealer
+		opener      *Opener
+		expectedErr error
+	}{
+		{
+			name:        "Good",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}, OCSPResponse: good},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool, RequireOCSP: true},
+			expectedErr: nil,
+		},
+		{
+			name:        "Revoked",
+			sealer:      &Sealer{PrivateKey: revokedPk1, Cert: revokedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}, OCSPResponse: revoked},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool},
+			expectedErr: ErrRevokedCert,
+		},
+		{
+			name:        "Response for other certificate",
+			sealer:      &Sealer{PrivateKey: revokedPk1, Cert: revokedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}, OCSPResponse: good},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool},
+			expectedErr: ErrInvalidOCSPResponse,
+		},
+		{
+			name:        "Response from other issuer",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}, OCSPResponse: good},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool},
+			expectedErr: ErrInvalidOCSPResponse,
+		},
+		{
+			name:        "Stale",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}, OCSPResponse: stale},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool},
+			expectedErr: ErrInvalidOCSPResponse,
+		},
+		{
+			name:        "Stale with longer max age",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}, OCSPResponse: stale},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool, OCSPMaxAge: 10 * 24 * time.Hour},
+			expectedErr: nil,
+		},
+		{
+			name:        "Past next update",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}, OCSPResponse: expired},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool, OCSPMaxAge: 10 * 24 * time.Hour},
+			expectedErr: ErrInvalidOCSPResponse,
+		},
+		{
+			name:        "Not stapled",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool},
+			expectedErr: nil,
+		},
+		{
+			name:        "Not stapled when required",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			opener:      &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool, RequireOCSP: true},
+			expectedErr: ErrRevocationUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		message, err := test.sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+
+		payload, err := test.opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr == nil {
+			assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+		}
+	}
+
+	// The stapled response is authenticated.
+	sealer := &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}, OCSPResponse: good}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool}
+
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	responder.Now = func() time.Time { return now().Add(-time.Minute) }
+	message.Header.OCSPResponse, err = FetchOCSPResponse(server.Client(), server.URL, signedCert4, ca2Cert)
+	assert.NoError(t, err)
+
+	_, err = opener.Open(message)
+	assert.Equal(t, ErrUnableToDecryptPayload, err)
+
+	// The response must be signed by the issuer in the chain accepted by the Opener, not in any chain of the sealer.
+	assert.NoError(t, opener.checkOCSP(good, []*x509.Certificate{signedCert4, ca2Cert}))
+	assert.Equal(t, ErrInvalidOCSPResponse, opener.checkOCSP(good, []*x509.Certificate{signedCert4, caCert}))
+	assert.Equal(t, ErrInvalidOCSPResponse, opener.checkOCSP(good, []*x509.Certificate{signedCert4}))
+}
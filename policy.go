@@ -0,0 +1,203 @@
+package arcane
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"path"
+	"strings"
+)
+
+// SenderPolicy decides whether the sealer of a message is allowed to send messages to the Opener.
+type SenderPolicy interface {
+	// Authorize is called with a verified chain of the sealer certificate, starting with the sealer certificate and
+	// ending with a root in Opener.CertPool. It returns a SenderNotAuthorizedError if the sealer is not allowed to send
+	// messages. Any other error also rejects the message.
+	Authorize(chain []*x509.Certificate) error
+}
+
+// SenderPolicyFunc is an adapter allowing a function to be used as a SenderPolicy.
+type SenderPolicyFunc func(chain []*x509.Certificate) error
+
+// Authorize calls f(chain).
+func (f SenderPolicyFunc) Authorize(chain []*x509.Certificate) error {
+	return f(chain)
+}
+
+// Policy is a SenderPolicy matching the sealer certificate against a set of rules. Every rule that is set must match.
+// A rule listing several values matches if any of them does, except ExtKeyUsages and PolicyIdentifiers where the
+// sealer certificate must have all of them. The zero Policy authorizes every sealer.
+type Policy struct {
+	// CommonNames lists the allowed subject common names.
+	CommonNames []string
+	// Organizations lists the allowed subject organizations. One of the organizations of the subject must be listed.
+	Organizations []string
+	// OrganizationalUnits lists the allowed subject organizational units. One of the organizational units of the
+	// subject must be listed.
+	OrganizationalUnits []string
+	// DNSNames lists patterns for the allowed DNS subject alternative names. A pattern starting with "*." matches a
+	// single label in that position. One of the DNS names of the sealer certificate must match.
+	DNSNames []string
+	// URIs lists patterns for the allowed URI subject alternative names, using the syntax of path.Match. One of the
+	// URIs of the sealer certificate must match.
+	URIs []string
+	// SPIFFEIDs lists patterns for the allowed SPIFFE IDs, using the syntax of path.Match. The sealer certificate must
+	// have exactly one URI subject alternative name, and it must be a SPIFFE ID.
+	SPIFFEIDs []string
+	// ExtKeyUsages lists the extended key usages the sealer certificate must have. A certificate allowing any usage
+	// has all of them.
+	ExtKeyUsages []x509.ExtKeyUsage
+	// PolicyIdentifiers lists the certificate policies the sealer certificate must assert.
+	PolicyIdentifiers []asn1.ObjectIdentifier
+}
+
+// Authorize returns a SenderNotAuthorizedError naming the first rule the sealer certificate does not match.
+func (p *Policy) Authorize(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return &SenderNotAuthorizedError{Rule: "Chain"}
+	}
+
+	cert := chain[0]
+	switch {
+	case len(p.CommonNames) > 0 && !contains(p.CommonNames, cert.Subject.CommonName):
+		return &SenderNotAuthorizedError{Rule: "CommonNames"}
+	case len(p.Organizations) > 0 && !containsAny(p.Organizations, cert.Subject.Organization):
+		return &SenderNotAuthorizedError{Rule: "Organizations"}
+	case len(p.OrganizationalUnits) > 0 && !containsAny(p.OrganizationalUnits, cert.Subject.OrganizationalUnit):
+		return &SenderNotAuthorizedError{Rule: "OrganizationalUnits"}
+	case len(p.DNSNames) > 0 && !matchDNSNames(p.DNSNames, cert.DNSNames):
+		return &SenderNotAuthorizedError{Rule: "DNSNames"}
+	case len(p.URIs) > 0 && !matchURIs(p.URIs, cert):
+		return &SenderNotAuthorizedError{Rule: "URIs"}
+	case len(p.SPIFFEIDs) > 0 && !matchSPIFFEID(p.SPIFFEIDs, cert):
+		return &SenderNotAuthorizedError{Rule: "SPIFFEIDs"}
+	case !hasExtKeyUsages(cert, p.ExtKeyUsages):
+		return &SenderNotAuthorizedError{Rule: "ExtKeyUsages"}
+	case !hasPolicyIdentifiers(cert, p.PolicyIdentifiers):
+		return &SenderNotAuthorizedError{Rule: "PolicyIdentifiers"}
+	}
+
+	return nil
+}
+
+// authorize checks a verified chain of the sealer certificate against the SenderPolicy of the Opener.
+func (o *Opener) authorize(chain []*x509.Certificate) error {
+	if o.SenderPolicy == nil {
+		return nil
+	}
+
+	return o.SenderPolicy.Authorize(chain)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsAny(allowed, values []string) bool {
+	for _, value := range values {
+		if contains(allowed, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchDNSNames(patterns, names []string) bool {
+	for _, name := range names {
+		for _, pattern := range patterns {
+			if matchDNSName(pattern, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchDNSName matches a DNS name against a pattern, ignoring case. A leading "*." in the pattern matches exactly one
+// label.
+func matchDNSName(pattern, name string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if !strings.HasPrefix(pattern, "*.") {
+		return pattern == name
+	}
+
+	i := strings.IndexByte(name, '.')
+	if i <= 0 {
+		return false
+	}
+
+	return name[i:] == pattern[1:]
+}
+
+func matchURIs(patterns []string, cert *x509.Certificate) bool {
+	for _, uri := range cert.URIs {
+		if matchPatterns(patterns, uri.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchSPIFFEID(patterns []string, cert *x509.Certificate) bool {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" || cert.URIs[0].Host == "" {
+		return false
+	}
+
+	return matchPatterns(patterns, cert.URIs[0].String())
+}
+
+func matchPatterns(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, value); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasExtKeyUsages(cert *x509.Certificate, required []x509.ExtKeyUsage) bool {
+	for _, usage := range required {
+		found := false
+		for _, u := range cert.ExtKeyUsage {
+			if u == usage || u == x509.ExtKeyUsageAny {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasPolicyIdentifiers(cert *x509.Certificate, required []asn1.ObjectIdentifier) bool {
+	for _, policy := range required {
+		found := false
+		for _, p := range cert.PolicyIdentifiers {
+			if p.Equal(policy) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,153 @@
+package arcane
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Authorize(t *testing.T) {
+	spiffeID, err := url.Parse("spiffe://example.org/ns/payments/sa/api")
+	assert.NoError(t, err)
+	httpsURI, err := url.Parse("https://example.org/services/api")
+	assert.NoError(t, err)
+
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "api",
+			Organization:       []string{"Example", "Legit Company INC."},
+			OrganizationalUnit: []string{"Payments"},
+		},
+		DNSNames:          []string{"api.payments.example.org"},
+		URIs:              []*url.URL{spiffeID},
+		ExtKeyUsage:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		PolicyIdentifiers: []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+	}
+
+	tests := []struct {
+		name         string
+		policy       *Policy
+		expectedRule string
+	}{
+		{name: "Empty policy", policy: &Policy{}},
+		{name: "Common name", policy: &Policy{CommonNames: []string{"other", "api"}}},
+		{name: "Common name not allowed", policy: &Policy{CommonNames: []string{"other"}}, expectedRule: "CommonNames"},
+		{name: "Organization", policy: &Policy{Organizations: []string{"Legit Company INC."}}},
+		{name: "Organization not allowed", policy: &Policy{Organizations: []string{"Other"}}, expectedRule: "Organizations"},
+		{name: "Organizational unit", policy: &Policy{OrganizationalUnits: []string{"Payments"}}},
+		{name: "Organizational unit not allowed", policy: &Policy{OrganizationalUnits: []string{"Billing"}}, expectedRule: "OrganizationalUnits"},
+		{name: "DNS name", policy: &Policy{DNSNames: []string{"API.payments.example.org."}}},
+		{name: "DNS name wildcard", policy: &Policy{DNSNames: []string{"*.payments.example.org"}}},
+		{name: "DNS name wildcard matches one label", policy: &Policy{DNSNames: []string{"*.example.org"}}, expectedRule: "DNSNames"},
+		{name: "URI", policy: &Policy{URIs: []string{"spiffe://example.org/ns/*/sa/api"}}},
+		{name: "URI not allowed", policy: &Policy{URIs: []string{"spiffe://example.org/ns/billing/*"}}, expectedRule: "URIs"},
+		{name: "SPIFFE ID", policy: &Policy{SPIFFEIDs: []string{"spiffe://example.org/ns/payments/sa/api"}}},
+		{name: "SPIFFE ID not allowed", policy: &Policy{SPIFFEIDs: []string{"spiffe://other.org/*"}}, expectedRule: "SPIFFEIDs"},
+		{name: "Extended key usage", policy: &Policy{ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}},
+		{name: "Extended key usage missing", policy: &Policy{ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageCodeSigning}}, expectedRule: "ExtKeyUsages"},
+		{name: "Policy identifier", policy: &Policy{PolicyIdentifiers: []asn1.ObjectIdentifier{{1, 2, 3, 4}}}},
+		{name: "Policy identifier missing", policy: &Policy{PolicyIdentifiers: []asn1.ObjectIdentifier{{1, 2, 3, 5}}}, expectedRule: "PolicyIdentifiers"},
+		{
+			name:         "First failing rule is named",
+			policy:       &Policy{CommonNames: []string{"api"}, Organizations: []string{"Other"}, DNSNames: []string{"other.org"}},
+			expectedRule: "Organizations",
+		},
+	}
+
+	for _, test := range tests {
+		err := test.policy.Authorize([]*x509.Certificate{cert})
+		if test.expectedRule == "" {
+			assert.NoError(t, err, test.name)
+		} else {
+			assert.Equal(t, &SenderNotAuthorizedError{Rule: test.expectedRule}, err, test.name)
+		}
+	}
+
+	// A SPIFFE ID must be the only URI of the certificate.
+	cert.URIs = append(cert.URIs, httpsURI)
+	assert.NoError(t, (&Policy{URIs: []string{"https://example.org/services/*"}}).Authorize([]*x509.Certificate{cert}))
+	assert.Equal(t, &SenderNotAuthorizedError{Rule: "SPIFFEIDs"}, (&Policy{SPIFFEIDs: []string{"spiffe://example.org/*/*/*/*"}}).Authorize([]*x509.Certificate{cert}))
+}
+
+func TestOpener_OpenSenderPolicy(t *testing.T) {
+	setNow(t, sealTime)
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(caCert)
+	certPool.AddCert(ca2Cert)
+
+	errCustom := errors.New("custom")
+
+	tests := []struct {
+		name        string
+		sealer      *Sealer
+		policy      SenderPolicy
+		expectedErr error
+	}{
+		{
+			name:        "Allowed",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			policy:      &Policy{CommonNames: []string{"signed4", "signed5"}, Organizations: []string{"Legit Company INC."}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Allowed through intermediate",
+			sealer:      &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			policy:      &Policy{CommonNames: []string{"signed4", "signed5"}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Not allowed",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			policy:      &Policy{CommonNames: []string{"signed4", "signed5"}},
+			expectedErr: &SenderNotAuthorizedError{Rule: "CommonNames"},
+		},
+		{
+			name:   "Custom policy on chain",
+			sealer: &Sealer{PrivateKey: signedPk5, Cert: signedCert5, Chain: []*x509.Certificate{intermediate1}, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			policy: SenderPolicyFunc(func(chain []*x509.Certificate) error {
+				if len(chain) != 3 || chain[1].Subject.CommonName != "Arcane Test Intermediate CA" {
+					return &SenderNotAuthorizedError{Rule: "issued by intermediate"}
+				}
+				return nil
+			}),
+			expectedErr: nil,
+		},
+		{
+			name:   "Custom policy rejecting",
+			sealer: &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			policy: SenderPolicyFunc(func(chain []*x509.Certificate) error {
+				return &SenderNotAuthorizedError{Rule: "issued by intermediate"}
+			}),
+			expectedErr: &SenderNotAuthorizedError{Rule: "issued by intermediate"},
+		},
+		{
+			name:        "Custom policy error",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			policy:      SenderPolicyFunc(func(chain []*x509.Certificate) error { return errCustom }),
+			expectedErr: errCustom,
+		},
+	}
+
+	for _, test := range tests {
+		opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool, SenderPolicy: test.policy}
+
+		message, err := test.sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+
+		payload, err := opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr == nil {
+			assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+		}
+	}
+
+	err := &SenderNotAuthorizedError{Rule: "CommonNames"}
+	assert.True(t, errors.Is(err, ErrSenderNotAuthorized))
+	assert.Equal(t, "sender is not authorized by rule CommonNames", err.Error())
+}
@@ -0,0 +1,224 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"math/big"
+)
+
+// KeyWrapAlgorithm identifies the algorithm used to encrypt the encryption key for a recipient.
+type KeyWrapAlgorithm string
+
+const (
+	// RSA1_5 is RSA PKCS#1 v1.5 encryption. It is only used by messages sealed by older versions of Sealer.
+	RSA1_5 KeyWrapAlgorithm = "RSA1_5"
+	// RSAOAEP256 is RSA-OAEP using SHA-256 and MGF1 with SHA-256.
+	RSAOAEP256 KeyWrapAlgorithm = "RSA-OAEP-256"
+	// ECDHESHKDF256 is ephemeral-static ECDH on P-256 with a key encryption key derived using HKDF-SHA256.
+	ECDHESHKDF256 KeyWrapAlgorithm = "ECDH-ES+HKDF-SHA256"
+	// X25519HKDF256 is ephemeral-static X25519 with a key encryption key derived using HKDF-SHA256. Used for receivers
+	// with Ed25519 or X25519 keys.
+	X25519HKDF256 KeyWrapAlgorithm = "X25519+HKDF-SHA256"
+)
+
+// Recipient holds the encryption key wrapped for one receiver. The receiver is identified by its
+// subject key identifier if the receiver certificate has one, otherwise by issuer and serial number.
+type Recipient struct {
+	SubjectKeyID []byte   `json:"subjectKeyId,omitempty"`
+	Issuer       []byte   `json:"issuer,omitempty"`
+	SerialNumber *big.Int `json:"serialNumber,omitempty"`
+	// Algorithm is empty for messages sealed before it was introduced, which means RSA1_5.
+	Algorithm KeyWrapAlgorithm `json:"algorithm,omitempty"`
+	// EphemeralKey is the public key of the ephemeral key pair used with ECDH key wrap algorithms.
+	EphemeralKey []byte `json:"ephemeralKey,omitempty"`
+	EncryptedKey []byte `json:"encryptedKey"`
+	// CertFingerprint is the SHA-256 hash of the receiver certificate. It is covered by the signature, so the Opener
+	// can verify that the sealer addressed the message to it.
+	CertFingerprint []byte `json:"certFingerprint,omitempty"`
+}
+
+func (r *Recipient) matches(cert *x509.Certificate) bool {
+	if len(r.SubjectKeyID) != 0 {
+		return bytes.Equal(r.SubjectKeyID, cert.SubjectKeyId)
+	}
+
+	return r.SerialNumber != nil && bytes.Equal(r.Issuer, cert.RawIssuer) && r.SerialNumber.Cmp(cert.SerialNumber) == 0
+}
+
+// keyWrapLabel is used as the RSA-OAEP label to bind a wrapped key to the sealer and timestamps of the
+// envelope it was sealed in.
+func keyWrapLabel(header *Header) []byte {
+	sealerCertHash := sha256.Sum256(header.SealerCert)
+
+	label := []byte("arcane key wrap\x00")
+	label = append(label, sealerCertHash[:]...)
+	label = append(label, header.Created...)
+	label = append(label, 0)
+	label = append(label, header.Expires...)
+
+	return label
+}
+
+// receiverFingerprints returns the SHA-256 fingerprints of the receiver certificates of the Sealer.
+func (s *Sealer) receiverFingerprints() [][]byte {
+	fingerprints := make([][]byte, 0, len(s.ReceiverCerts))
+	for _, cert := range s.ReceiverCerts {
+		fingerprint := sha256.Sum256(cert.Raw)
+		fingerprints = append(fingerprints, fingerprint[:])
+	}
+
+	return fingerprints
+}
+
+// wrapKey encrypts key with the public key in cert.
+func wrapKey(cert *x509.Certificate, key, label []byte) (Recipient, error) {
+	fingerprint := sha256.Sum256(cert.Raw)
+	recipient := Recipient{CertFingerprint: fingerprint[:]}
+	if len(cert.SubjectKeyId) != 0 {
+		recipient.SubjectKeyID = cert.SubjectKeyId
+	} else {
+		recipient.Issuer = cert.RawIssuer
+		recipient.SerialNumber = cert.SerialNumber
+	}
+
+	if pubKey, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+		encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pubKey, key, label)
+		if err != nil {
+			return Recipient{}, err
+		}
+
+		recipient.Algorithm = RSAOAEP256
+		recipient.EncryptedKey = encryptedKey
+
+		return recipient, nil
+	}
+
+	pubKey, alg, err := keyAgreementPublicKey(cert.PublicKey)
+	if err != nil {
+		return Recipient{}, err
+	}
+
+	ephemeralKey, encryptedKey, err := wrapKeyECDH(alg, pubKey, key, label)
+	if err != nil {
+		return Recipient{}, err
+	}
+
+	recipient.Algorithm = alg
+	recipient.EphemeralKey = ephemeralKey
+	recipient.EncryptedKey = encryptedKey
+
+	return recipient, nil
+}
+
+// recipient finds the encryption key addressed to the Opener. From versionSignedRecipients the recipient must also
+// carry the fingerprint of the Opener certificate.
+func (o *Opener) recipient(header *Header) (*Recipient, error) {
+	if len(header.Recipients) == 0 {
+		return &Recipient{Algorithm: RSA1_5, EncryptedKey: header.EncryptedKey}, nil
+	}
+
+	if o.Cert == nil {
+		return nil, ErrNotRecipient
+	}
+
+	fingerprint := sha256.Sum256(o.Cert.Raw)
+	for i := range header.Recipients {
+		recipient := &header.Recipients[i]
+		if !recipient.matches(o.Cert) {
+			continue
+		}
+
+		if header.Version >= versionSignedRecipients && !bytes.Equal(recipient.CertFingerprint, fingerprint[:]) {
+			return nil, ErrNotRecipient
+		}
+
+		return recipient, nil
+	}
+
+	return nil, ErrNotRecipient
+}
+
+// signedFor reports whether the fingerprint of the Opener certificate is among the receivers signed by the sealer.
+func (o *Opener) signedFor(receivers [][]byte) bool {
+	if o.Cert == nil {
+		return false
+	}
+
+	fingerprint := sha256.Sum256(o.Cert.Raw)
+	for _, receiver := range receivers {
+		if bytes.Equal(receiver, fingerprint[:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unwrapKey decrypts the encryption key in recipient.
+func (o *Opener) unwrapKey(recipient *Recipient, label []byte) ([]byte, error) {
+	switch recipient.Algorithm {
+	case ECDHESHKDF256, X25519HKDF256:
+		return unwrapKeyECDH(recipient.Algorithm, o.PrivateKey, recipient.EphemeralKey, recipient.EncryptedKey, label)
+	case RSAOAEP256:
+		decrypter, ok := o.rsaDecrypter()
+		if !ok {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		key, err := decrypter.Decrypt(rand.Reader, recipient.EncryptedKey, &rsa.OAEPOptions{Hash: crypto.SHA256, Label: label})
+		if err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		return key, nil
+	case RSA1_5, "":
+		if !o.AllowPKCS1v15 {
+			return nil, ErrUnsupportedKeyWrap
+		}
+
+		decrypter, ok := o.rsaDecrypter()
+		if !ok {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		// Session key decryption returns a random key if decryption fails so that a padding error is
+		// indistinguishable from a payload that fails to decrypt. This prevents the Opener from being used as a
+		// padding oracle.
+		key, err := decrypter.Decrypt(rand.Reader, recipient.EncryptedKey, &rsa.PKCS1v15DecryptOptions{SessionKeyLen: 32})
+		if err != nil {
+			return nil, ErrUnableToGetEncryptionKey
+		}
+
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKeyWrap
+	}
+}
+
+// checkPrivateKey returns ErrUnsupportedPrivateKey if PrivateKey is neither an RSA crypto.Decrypter nor a key that
+// supports key agreement, so a misconfigured Opener is reported before any message is processed.
+func (o *Opener) checkPrivateKey() error {
+	if _, ok := o.rsaDecrypter(); ok {
+		return nil
+	}
+	if _, err := keyAgreer(o.PrivateKey); err == nil {
+		return nil
+	}
+
+	return ErrUnsupportedPrivateKey
+}
+
+func (o *Opener) rsaDecrypter() (crypto.Decrypter, bool) {
+	decrypter, ok := o.PrivateKey.(crypto.Decrypter)
+	if !ok {
+		return nil, false
+	}
+
+	_, ok = decrypter.Public().(*rsa.PublicKey)
+
+	return decrypter, ok
+}
@@ -0,0 +1,65 @@
+package arcane
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpener_OpenKeyWrapLabel(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+
+	tests := []struct {
+		name        string
+		tamper      func(header *Header)
+		expectedErr error
+	}{
+		{
+			name:        "Untampered",
+			tamper:      func(header *Header) {},
+			expectedErr: nil,
+		},
+		{
+			name:        "Tampered created",
+			tamper:      func(header *Header) { header.Created = "2020-11-26T18:36:56+01:00" },
+			expectedErr: ErrUnableToGetEncryptionKey,
+		},
+		{
+			name:        "Tampered expires",
+			tamper:      func(header *Header) { header.Expires = "2020-11-26T18:45:56+01:00" },
+			expectedErr: ErrUnableToGetEncryptionKey,
+		},
+		{
+			name: "Downgraded algorithm",
+			tamper: func(header *Header) {
+				header.Recipients[0].Algorithm = RSA1_5
+			},
+			expectedErr: ErrUnsupportedKeyWrap,
+		},
+		{
+			name: "Unknown algorithm",
+			tamper: func(header *Header) {
+				header.Recipients[0].Algorithm = "RSA-OAEP-512"
+			},
+			expectedErr: ErrUnsupportedKeyWrap,
+		},
+	}
+
+	for _, test := range tests {
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+		assert.Equal(t, RSAOAEP256, message.Header.Recipients[0].Algorithm)
+
+		test.tamper(&message.Header)
+
+		payload, err := opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr != nil {
+			assert.Nil(t, payload)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package arcane
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMessageIDLength limits the size of message IDs accepted when replay protection is enabled.
+	maxMessageIDLength = 64
+	// maxReplayKeyLength is the size of the longest key passed to ReplayCache.Add: the hex encoded SHA-256 fingerprint
+	// of the sealer certificate, '_' and the message ID.
+	maxReplayKeyLength = 2*sha256.Size + 1 + maxMessageIDLength
+)
+
+// ReplayCache records the opened messages. It is used by Opener to make sure a message is only opened once. Messages
+// are identified by the fingerprint of the sealer certificate and the message ID, so a sealer can not block the
+// messages of another sealer by reusing their message IDs.
+type ReplayCache interface {
+	// Add records the key of a message until the message expires. It returns false if the key is already recorded.
+	// Keys only contain ASCII letters, digits, '-' and '_'. Add must be safe for concurrent use.
+	Add(key string, expires time.Time) (bool, error)
+}
+
+// newMessageID returns a random 128 bit message ID encoded as hex. It is a variable to simplify testing.
+var newMessageID = func() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// validMessageID reports whether id is non-empty, at most maxMessageIDLength long and only contains ASCII letters,
+// digits, '-' and '_'.
+func validMessageID(id string) bool {
+	return len(id) <= maxMessageIDLength && validReplayKey(id)
+}
+
+// validReplayKey reports whether key is non-empty, at most maxReplayKeyLength long and only contains ASCII letters,
+// digits, '-' and '_'.
+func validReplayKey(key string) bool {
+	if len(key) == 0 || len(key) > maxReplayKeyLength {
+		return false
+	}
+
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// replayKey returns the key recording a message in a ReplayCache: the hex encoded SHA-256 fingerprint of the sealer
+// certificate, '_' and the message ID.
+func replayKey(sealerCert *x509.Certificate, messageID string) string {
+	fingerprint := sha256.Sum256(sealerCert.Raw)
+
+	return hex.EncodeToString(fingerprint[:]) + "_" + messageID
+}
+
+// checkReplay records the message of the sealer in the replay cache of the Opener. It must only be called after the
+// signature is verified, so forged messages can not fill the cache.
+func (o *Opener) checkReplay(sealerCert *x509.Certificate, messageID string, expires time.Time) error {
+	if o.ReplayCache == nil {
+		return nil
+	}
+
+	if !validMessageID(messageID) {
+		return ErrInvalidMessageID
+	}
+
+	added, err := o.ReplayCache.Add(replayKey(sealerCert, messageID), expires)
+	if err != nil {
+		return err
+	}
+
+	if !added {
+		return ErrReplayedMessage
+	}
+
+	return nil
+}
+
+// MemoryReplayCache is a ReplayCache holding keys in memory. Keys are removed once the message they belong to is
+// expired, so the size of the cache is bounded by the rate of messages and their time to live.
+type MemoryReplayCache struct {
+	mu        sync.Mutex
+	ids       map[string]time.Time
+	nextPurge int
+}
+
+// minPurgeSize is the number of entries a MemoryReplayCache holds before expired entries are first removed.
+const minPurgeSize = 1024
+
+// NewMemoryReplayCache returns an empty MemoryReplayCache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{
+		ids:       make(map[string]time.Time),
+		nextPurge: minPurgeSize,
+	}
+}
+
+// Add records a key until the message expires. It returns false if the key is already recorded.
+func (c *MemoryReplayCache) Add(key string, expires time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.add(key, expires), nil
+}
+
+// Len returns the number of keys recorded, including those not yet removed after expiring.
+func (c *MemoryReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.ids)
+}
+
+// contains reports whether key is recorded and not expired.
+func (c *MemoryReplayCache) contains(key string) bool {
+	e, exists := c.ids[key]
+
+	return exists && !now().After(e)
+}
+
+func (c *MemoryReplayCache) add(key string, expires time.Time) bool {
+	if c.contains(key) {
+		return false
+	}
+
+	t := now()
+	// Expired entries are removed when the cache has doubled in size since the last purge, so the cost is amortized
+	// over the calls to add.
+	if len(c.ids) >= c.nextPurge {
+		for id, e := range c.ids {
+			if t.After(e) {
+				delete(c.ids, id)
+			}
+		}
+
+		c.nextPurge = 2 * len(c.ids)
+		if c.nextPurge < minPurgeSize {
+			c.nextPurge = minPurgeSize
+		}
+	}
+
+	c.ids[key] = expires
+
+	return true
+}
+
+// FileReplayCache is a ReplayCache that persists keys to a file, so replays are detected across restarts. Keys are
+// appended to the file as they are added, and expired entries are removed from the file when it is opened.
+type FileReplayCache struct {
+	mu     sync.Mutex
+	memory *MemoryReplayCache
+	file   *os.File
+}
+
+// OpenFileReplayCache opens the replay cache stored in the file at path, creating it if it does not exist. The file
+// holds one key and its expiry time in RFC 3339 format per line.
+func OpenFileReplayCache(path string) (*FileReplayCache, error) {
+	memory := NewMemoryReplayCache()
+
+	existing, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if existing != nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 2 || !validReplayKey(fields[0]) {
+				existing.Close()
+				return nil, errors.New("invalid replay cache entry")
+			}
+
+			expires, err := time.Parse(time.RFC3339Nano, fields[1])
+			if err != nil {
+				existing.Close()
+				return nil, err
+			}
+
+			if !now().After(expires) {
+				memory.add(fields[0], expires)
+			}
+		}
+
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write the entries that are not expired to a new file and replace the old one.
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for id, expires := range memory.ids {
+		w.WriteString(replayCacheEntry(id, expires))
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileReplayCache{memory: memory, file: file}, nil
+}
+
+// Add records a key until the message expires. It returns false if the key is already recorded. The key is written to
+// the file before Add returns.
+func (c *FileReplayCache) Add(key string, expires time.Time) (bool, error) {
+	if !validReplayKey(key) {
+		return false, ErrInvalidMessageID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return false, errors.New("replay cache is closed")
+	}
+
+	if c.memory.contains(key) {
+		return false, nil
+	}
+
+	// The key is only recorded in memory once it is written, so a message is not rejected as replayed when opening it
+	// is retried after a failed write.
+	if _, err := c.file.WriteString(replayCacheEntry(key, expires)); err != nil {
+		return false, err
+	}
+
+	if err := c.file.Sync(); err != nil {
+		return false, err
+	}
+
+	return c.memory.add(key, expires), nil
+}
+
+// Close closes the underlying file.
+func (c *FileReplayCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+
+	err := c.file.Close()
+	c.file = nil
+
+	return err
+}
+
+func replayCacheEntry(key string, expires time.Time) string {
+	return key + " " + expires.UTC().Format(time.RFC3339Nano) + "\n"
+}
@@ -0,0 +1,220 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpener_OpenReplayed(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: NewMemoryReplayCache()}
+
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	assert.Len(t, message.Header.MessageID, 32)
+
+	payload, err := opener.Open(message)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("This is a test payload."), payload)
+
+	_, err = opener.Open(message)
+	assert.Equal(t, ErrReplayedMessage, err)
+
+	// Other messages are not affected.
+	other, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	assert.NotEqual(t, message.Header.MessageID, other.Header.MessageID)
+
+	_, err = opener.Open(other)
+	assert.NoError(t, err)
+
+	// The message ID is authenticated.
+	other.Header.MessageID = message.Header.MessageID + "0"
+	_, err = opener.Open(other)
+	assert.Equal(t, ErrUnableToDecryptPayload, err)
+
+	// Messages without a message ID are rejected when replay protection is enabled.
+	other.Header.MessageID = ""
+	assert.Equal(t, ErrInvalidMessageID, opener.checkReplay(signedCert1, other.Header.MessageID, now()))
+
+	// Messages failing verification are not recorded.
+	forged, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	forged.Header.Signature[0] ^= 1
+	_, err = opener.Open(forged)
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	forged.Header.Signature[0] ^= 1
+	_, err = opener.Open(forged)
+	assert.NoError(t, err)
+}
+
+func TestOpener_OpenReplayedOtherSealer(t *testing.T) {
+	setNow(t, sealTime)
+
+	// Sealers can choose the message IDs of their messages, so they could copy the IDs of other sealers.
+	defer func(f func() (string, error)) { newMessageID = f }(newMessageID)
+	newMessageID = func() (string, error) { return "0123456789abcdef", nil }
+
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: NewMemoryReplayCache()}
+
+	message, err := (&Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}).Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	copied, err := (&Sealer{PrivateKey: signedPk3, Cert: signedCert3, ReceiverCerts: []*x509.Certificate{signedCert2}}).Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	assert.Equal(t, message.Header.MessageID, copied.Header.MessageID)
+
+	_, err = opener.Open(copied)
+	assert.NoError(t, err)
+
+	_, err = opener.Open(message)
+	assert.NoError(t, err)
+
+	_, err = opener.Open(message)
+	assert.Equal(t, ErrReplayedMessage, err)
+}
+
+func TestOpener_OpenStreamReplayed(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, ReplayCache: NewMemoryReplayCache()}
+
+	var sealed bytes.Buffer
+	assert.NoError(t, sealer.SealStream(&sealed, strings.NewReader("This is a test payload.")))
+	stream := sealed.Bytes()
+
+	assert.NoError(t, opener.OpenStream(ioutil.Discard, bytes.NewReader(stream)))
+	assert.Equal(t, ErrReplayedMessage, opener.OpenStream(ioutil.Discard, bytes.NewReader(stream)))
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	start := sealTime
+	current := start
+	setNow(t, current)
+
+	cache := NewMemoryReplayCache()
+
+	added, err := cache.Add("a", start.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = cache.Add("a", start.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	// An ID can be added again once the message it belongs to is expired.
+	current = start.Add(2 * time.Minute)
+	setNow(t, current)
+	added, err = cache.Add("a", current.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	// Expired entries are removed as the cache grows.
+	for i := 0; i < minPurgeSize-1; i++ {
+		_, err := cache.Add(strings.Repeat("b", i+1), current.Add(time.Second))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, minPurgeSize, cache.Len())
+
+	current = current.Add(2 * time.Second)
+	setNow(t, current)
+	_, err = cache.Add("c", current.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestFileReplayCache(t *testing.T) {
+	start := sealTime
+	current := start
+	setNow(t, current)
+
+	path := filepath.Join(t.TempDir(), "replay")
+
+	cache, err := OpenFileReplayCache(path)
+	assert.NoError(t, err)
+
+	added, err := cache.Add("a", start.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = cache.Add("b", start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	_, err = cache.Add("not valid", start.Add(time.Hour))
+	assert.Equal(t, ErrInvalidMessageID, err)
+
+	assert.NoError(t, cache.Close())
+	_, err = cache.Add("c", start.Add(time.Hour))
+	assert.Error(t, err)
+
+	// IDs are remembered when the cache is opened again.
+	cache, err = OpenFileReplayCache(path)
+	assert.NoError(t, err)
+
+	added, err = cache.Add("a", start.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, added)
+	assert.NoError(t, cache.Close())
+
+	// Expired IDs are removed from the file when it is opened.
+	current = start.Add(2 * time.Minute)
+	setNow(t, current)
+	cache, err = OpenFileReplayCache(path)
+	assert.NoError(t, err)
+	assert.NoError(t, cache.Close())
+
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "b 2020-11-26T18:37:56Z\n", string(b))
+
+	// Keys of the length used by Opener are accepted.
+	key := replayKey(signedCert1, strings.Repeat("a", maxMessageIDLength))
+	cache, err = OpenFileReplayCache(path)
+	assert.NoError(t, err)
+	added, err = cache.Add(key, start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, added)
+	_, err = cache.Add(key+"a", start.Add(time.Hour))
+	assert.Equal(t, ErrInvalidMessageID, err)
+	assert.NoError(t, cache.Close())
+
+	cache, err = OpenFileReplayCache(path)
+	assert.NoError(t, err)
+	added, err = cache.Add(key, start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, added)
+	assert.NoError(t, cache.Close())
+
+	// Keys are not recorded if writing them fails, so they can be added again.
+	cache, err = OpenFileReplayCache(path)
+	assert.NoError(t, err)
+	file := cache.file
+	cache.file, err = os.Open(path)
+	assert.NoError(t, err)
+	_, err = cache.Add("d", start.Add(time.Hour))
+	assert.Error(t, err)
+	assert.NoError(t, cache.file.Close())
+
+	cache.file = file
+	added, err = cache.Add("d", start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, added)
+	assert.NoError(t, cache.Close())
+
+	// A corrupt file is not accepted.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("a\n"), 0600))
+	_, err = OpenFileReplayCache(path)
+	assert.Error(t, err)
+}
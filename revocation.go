@@ -0,0 +1,127 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+)
+
+// RevocationChecker checks whether a certificate in the chain of a sealer certificate is revoked.
+type RevocationChecker interface {
+	// CheckRevocation returns ErrRevokedCert if cert is revoked. The issuer is the certificate that signed cert in
+	// the verified chain. Any other error means the revocation status could not be determined.
+	CheckRevocation(cert, issuer *x509.Certificate) error
+}
+
+// CRLChecker is a RevocationChecker using certificate revocation lists. The CRL for a certificate must be signed by
+// its issuer and be current. Certificates with no matching CRL are rejected with ErrRevocationUnknown unless
+// AllowUnknown is set.
+type CRLChecker struct {
+	crls []*x509.RevocationList
+	// AllowUnknown accepts certificates whose issuer has no current CRL.
+	AllowUnknown bool
+}
+
+// NewCRLChecker returns a CRLChecker using the given CRLs.
+func NewCRLChecker(crls ...*x509.RevocationList) *CRLChecker {
+	return &CRLChecker{crls: crls}
+}
+
+// LoadCRLChecker returns a CRLChecker using the CRLs in the files at paths. A file can hold a DER encoded CRL or any
+// number of PEM encoded CRLs.
+func LoadCRLChecker(paths ...string) (*CRLChecker, error) {
+	checker := &CRLChecker{}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checker.add(b); err != nil {
+			return nil, err
+		}
+	}
+
+	return checker, nil
+}
+
+func (c *CRLChecker) add(b []byte) error {
+	if !bytes.Contains(b, []byte("-----BEGIN")) {
+		crl, err := x509.ParseRevocationList(b)
+		if err != nil {
+			return err
+		}
+
+		c.crls = append(c.crls, crl)
+
+		return nil
+	}
+
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return nil
+		}
+
+		if block.Type != "X509 CRL" {
+			continue
+		}
+
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return err
+		}
+
+		c.crls = append(c.crls, crl)
+	}
+}
+
+// CheckRevocation returns ErrRevokedCert if cert is listed in a current CRL signed by issuer.
+func (c *CRLChecker) CheckRevocation(cert, issuer *x509.Certificate) error {
+	t := now()
+	found := false
+	for _, crl := range c.crls {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) || crl.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+
+		if t.Before(crl.ThisUpdate) || (!crl.NextUpdate.IsZero() && t.After(crl.NextUpdate)) {
+			continue
+		}
+
+		found = true
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return ErrRevokedCert
+			}
+		}
+	}
+
+	if !found && !c.AllowUnknown {
+		return ErrRevocationUnknown
+	}
+
+	return nil
+}
+
+// checkRevocation checks every certificate in a verified chain, except the root, using the RevocationChecker of the
+// Opener.
+func (o *Opener) checkRevocation(chain []*x509.Certificate) error {
+	if o.RevocationChecker == nil {
+		return nil
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		if err := o.RevocationChecker.CheckRevocation(chain[i], chain[i+1]); err != nil {
+			if errors.Is(err, ErrRevokedCert) {
+				return ErrRevokedCert
+			}
+			return err
+		}
+	}
+
+	return nil
+}
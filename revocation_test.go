@@ -0,0 +1,146 @@
+package arcane
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpener_OpenRevoked(t *testing.T) {
+	setNow(t, sealTime)
+
+	crlChecker, err := LoadCRLChecker("test/data/ca2.crl")
+	assert.NoError(t, err)
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(caCert)
+	certPool.AddCert(ca2Cert)
+
+	tests := []struct {
+		name        string
+		sealer      *Sealer
+		checker     RevocationChecker
+		expectedErr error
+	}{
+		{
+			name:        "Not revoked",
+			sealer:      &Sealer{PrivateKey: signedPk4, Cert: signedCert4, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			checker:     crlChecker,
+			expectedErr: nil,
+		},
+		{
+			name:        "Revoked",
+			sealer:      &Sealer{PrivateKey: revokedPk1, Cert: revokedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			checker:     crlChecker,
+			expectedErr: ErrRevokedCert,
+		},
+		{
+			name:        "Revoked without checker",
+			sealer:      &Sealer{PrivateKey: revokedPk1, Cert: revokedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			checker:     nil,
+			expectedErr: nil,
+		},
+		{
+			name:        "No CRL for issuer",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			checker:     crlChecker,
+			expectedErr: ErrRevocationUnknown,
+		},
+		{
+			name:        "No CRL for issuer allowed",
+			sealer:      &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}},
+			checker:     &CRLChecker{crls: crlChecker.crls, AllowUnknown: true},
+			expectedErr: nil,
+		},
+	}
+
+	for _, test := range tests {
+		opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: certPool, RevocationChecker: test.checker}
+
+		message, err := test.sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+
+		payload, err := opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr == nil {
+			assert.Equal(t, []byte("This is a test payload."), payload, test.name)
+		}
+	}
+}
+
+func TestCRLChecker_CheckRevocation(t *testing.T) {
+	thisUpdate, err := time.Parse(time.RFC3339, "2020-10-31T20:14:38Z")
+	assert.NoError(t, err)
+
+	crl := createCRL(t, thisUpdate, thisUpdate.Add(24*time.Hour), revokedCert1.SerialNumber)
+	checker := NewCRLChecker(crl)
+
+	setNow(t, thisUpdate.Add(time.Hour))
+	assert.Equal(t, ErrRevokedCert, checker.CheckRevocation(revokedCert1, ca2Cert))
+	assert.NoError(t, checker.CheckRevocation(signedCert4, ca2Cert))
+
+	// CRLs that are not current are ignored.
+	setNow(t, thisUpdate.Add(25*time.Hour))
+	assert.Equal(t, ErrRevocationUnknown, checker.CheckRevocation(revokedCert1, ca2Cert))
+	setNow(t, thisUpdate.Add(-time.Hour))
+	assert.Equal(t, ErrRevocationUnknown, checker.CheckRevocation(revokedCert1, ca2Cert))
+
+	// CRLs not signed by the issuer are ignored.
+	setNow(t, thisUpdate.Add(time.Hour))
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	forgedIssuer := *ca2Cert
+	forgedIssuer.PublicKey = &otherKey.PublicKey
+	assert.Equal(t, ErrRevocationUnknown, checker.CheckRevocation(revokedCert1, &forgedIssuer))
+}
+
+func TestLoadCRLChecker(t *testing.T) {
+	setNow(t, sealTime)
+
+	pemBytes, err := ioutil.ReadFile("test/data/ca2.crl")
+	assert.NoError(t, err)
+	block, _ := pem.Decode(pemBytes)
+
+	derPath := filepath.Join(t.TempDir(), "ca2.der")
+	assert.NoError(t, ioutil.WriteFile(derPath, block.Bytes, 0600))
+
+	checker, err := LoadCRLChecker(derPath)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrRevokedCert, checker.CheckRevocation(revokedCert1, ca2Cert))
+
+	// PEM blocks other than CRLs are skipped.
+	checker, err = LoadCRLChecker("test/data/ca2.crt")
+	assert.NoError(t, err)
+	assert.Equal(t, ErrRevocationUnknown, checker.CheckRevocation(revokedCert1, ca2Cert))
+
+	_, err = LoadCRLChecker("test/data/missing.crl")
+	assert.Error(t, err)
+}
+
+func createCRL(t *testing.T, thisUpdate, nextUpdate time.Time, revoked ...*big.Int) *x509.RevocationList {
+	var entries []x509.RevocationListEntry
+	for _, serial := range revoked {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: thisUpdate})
+	}
+
+	b, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(2),
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                nextUpdate,
+		RevokedCertificateEntries: entries,
+	}, ca2Cert, ca2Pk)
+	assert.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(b)
+	assert.NoError(t, err)
+
+	return crl
+}
@@ -0,0 +1,263 @@
+package arcane
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// SignatureAlgorithm identifies the algorithm used to sign a message.
+type SignatureAlgorithm string
+
+const (
+	// RS256 is RSASSA-PKCS1-v1_5 using SHA-256.
+	RS256 SignatureAlgorithm = "RS256"
+	// PS256 is RSASSA-PSS using SHA-256 and MGF1 with SHA-256.
+	PS256 SignatureAlgorithm = "PS256"
+	// ES256 is ECDSA using P-256 and SHA-256. The signature is ASN.1 DER encoded.
+	ES256 SignatureAlgorithm = "ES256"
+	// EdDSA is Ed25519 over the SHA-256 digest of the signed data.
+	EdDSA SignatureAlgorithm = "EdDSA"
+)
+
+// DefaultSignatureAlgorithms are the signature algorithms accepted by Opener if SignatureAlgorithms is not set.
+var DefaultSignatureAlgorithms = []SignatureAlgorithm{RS256, PS256, ES256, EdDSA}
+
+// signatureContext separates signatures made by arcane from signatures made with the same key for other purposes.
+const signatureContext = "arcane signature"
+
+// streamSignatureContext separates signatures on streams from signatures on messages sealed using Seal.
+const streamSignatureContext = "arcane stream signature"
+
+// signatureDigest returns the SHA-256 digest signed by the sealer.
+func signatureDigest(header *Header, encryptedPayload, plaintext []byte) []byte {
+	if header.Version < versionCanonicalSignature {
+		return legacySignatureDigest(header, encryptedPayload, plaintext)
+	}
+
+	digest := sha256.Sum256(signingInput(header, encryptedPayload, plaintext))
+
+	return digest[:]
+}
+
+// signingInput returns the data signed by the sealer. It is the canonical encoding of the signature context, the
+// format version, the canonical encoding of the header without the signature, the encrypted payload and the
+// plaintext.
+func signingInput(header *Header, encryptedPayload, plaintext []byte) []byte {
+	var w canonicalWriter
+	w.stringField(tagSigningContext, signatureContext)
+	w.intField(tagSigningVersion, header.Version)
+	w.field(tagSigningHeader, header.additionalData())
+	w.field(tagSigningEncryptedPayload, encryptedPayload)
+	w.field(tagSigningPlaintext, plaintext)
+
+	return w.bytes()
+}
+
+// streamSignatureDigest returns the SHA-256 digest signed by the sealer of a stream. The signing input has the same
+// layout as for messages sealed using Seal, but holds the SHA-256 digests of the encrypted chunks and the plaintext
+// instead of the data itself.
+func streamSignatureDigest(header *Header, ciphertextDigest, plaintextDigest []byte) []byte {
+	var w canonicalWriter
+	w.stringField(tagSigningContext, streamSignatureContext)
+	w.intField(tagSigningVersion, header.Version)
+	w.field(tagSigningHeader, header.additionalData())
+	w.field(tagSigningEncryptedPayload, ciphertextDigest)
+	w.field(tagSigningPlaintext, plaintextDigest)
+
+	digest := sha256.Sum256(w.bytes())
+
+	return digest[:]
+}
+
+// legacySignatureDigest returns the digest signed in messages from before versionCanonicalSignature. Fields are
+// concatenated without any encoding of their boundaries. From versionSignedRecipients the digest also covers who the
+// message is addressed to and the encrypted payload.
+func legacySignatureDigest(header *Header, encryptedPayload, plaintext []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(header.Created))
+	h.Write([]byte(header.Expires))
+	if header.Version >= versionSignedRecipients {
+		for _, recipient := range header.Recipients {
+			h.Write(recipient.CertFingerprint)
+			h.Write(recipient.EncryptedKey)
+		}
+		h.Write(encryptedPayload)
+	}
+	h.Write(plaintext)
+
+	return h.Sum(nil)
+}
+
+var pssOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+
+// defaultSignatureAlgorithm returns the signature algorithm used for a signer when none is set on Sealer.
+func defaultSignatureAlgorithm(signer crypto.Signer) SignatureAlgorithm {
+	switch signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		return ES256
+	case ed25519.PublicKey:
+		return EdDSA
+	default:
+		return RS256
+	}
+}
+
+func sign(alg SignatureAlgorithm, signer crypto.Signer, digest []byte) ([]byte, error) {
+	var ok bool
+	var opts crypto.SignerOpts = crypto.SHA256
+	switch alg {
+	case RS256:
+		_, ok = signer.Public().(*rsa.PublicKey)
+	case PS256:
+		_, ok = signer.Public().(*rsa.PublicKey)
+		opts = pssOptions
+	case ES256:
+		var ecdsaKey *ecdsa.PublicKey
+		ecdsaKey, ok = signer.Public().(*ecdsa.PublicKey)
+		ok = ok && ecdsaKey.Curve == elliptic.P256()
+	case EdDSA:
+		// Ed25519 signs the digest as the message.
+		_, ok = signer.Public().(ed25519.PublicKey)
+		opts = crypto.Hash(0)
+	default:
+		return nil, errors.New("unsupported signature algorithm")
+	}
+
+	if !ok {
+		return nil, errors.New("private key can not be used with signature algorithm " + string(alg))
+	}
+
+	return signer.Sign(rand.Reader, digest, opts)
+}
+
+func verify(alg SignatureAlgorithm, pubKey crypto.PublicKey, digest, signature []byte) error {
+	valid := false
+	switch alg {
+	case RS256, PS256:
+		rsaKey, ok := pubKey.(*rsa.PublicKey)
+		if !ok {
+			break
+		}
+		if alg == PS256 {
+			valid = rsa.VerifyPSS(rsaKey, crypto.SHA256, digest, signature, pssOptions) == nil
+		} else {
+			valid = rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, signature) == nil
+		}
+	case ES256:
+		ecdsaKey, ok := pubKey.(*ecdsa.PublicKey)
+		valid = ok && ecdsaKey.Curve == elliptic.P256() && ecdsa.VerifyASN1(ecdsaKey, digest, signature)
+	case EdDSA:
+		edKey, ok := pubKey.(ed25519.PublicKey)
+		valid = ok && ed25519.Verify(edKey, digest, signature)
+	default:
+		return ErrUnsupportedSignatureAlgorithm
+	}
+
+	if !valid {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signatureAlgorithm returns the signature algorithm recorded in header if it is accepted by the Opener.
+func (o *Opener) signatureAlgorithm(header *Header) (SignatureAlgorithm, error) {
+	alg := header.SignatureAlgorithm
+	if alg == "" {
+		// Messages sealed before the algorithm was recorded are always signed using RS256.
+		alg = RS256
+	}
+
+	if !o.allowsSignatureAlgorithm(alg) {
+		return "", ErrUnsupportedSignatureAlgorithm
+	}
+
+	return alg, nil
+}
+
+// allowsSignatureAlgorithm reports whether alg is accepted by the Opener.
+func (o *Opener) allowsSignatureAlgorithm(alg SignatureAlgorithm) bool {
+	allowed := o.SignatureAlgorithms
+	if allowed == nil {
+		allowed = DefaultSignatureAlgorithms
+	}
+
+	for _, a := range allowed {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signStandard signs data the way COSE and JWS do: EdDSA signs the data itself rather than its SHA-256 digest, and
+// ES256 signatures are the concatenation of r and s.
+func signStandard(alg SignatureAlgorithm, signer crypto.Signer, data []byte) ([]byte, error) {
+	signature, err := sign(alg, signer, standardSigningInput(alg, data))
+	if err != nil {
+		return nil, err
+	}
+
+	if alg == ES256 {
+		return ecdsaSignatureToRaw(signature)
+	}
+
+	return signature, nil
+}
+
+// verifyStandard verifies a signature made by signStandard.
+func verifyStandard(alg SignatureAlgorithm, pubKey crypto.PublicKey, data, signature []byte) error {
+	if alg == ES256 {
+		var err error
+		if signature, err = ecdsaSignatureFromRaw(signature); err != nil {
+			return ErrInvalidSignature
+		}
+	}
+
+	return verify(alg, pubKey, standardSigningInput(alg, data), signature)
+}
+
+// standardSigningInput returns the data passed to sign and verify by signStandard and verifyStandard.
+func standardSigningInput(alg SignatureAlgorithm, data []byte) []byte {
+	if alg == EdDSA {
+		return data
+	}
+
+	digest := sha256.Sum256(data)
+
+	return digest[:]
+}
+
+// ecdsaSignatureToRaw converts an ASN.1 DER encoded ES256 signature to the concatenation of r and s, each 32 bytes,
+// as used by COSE and JWS.
+func ecdsaSignatureToRaw(signature []byte) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(signature, &sig)
+	if err != nil || len(rest) != 0 || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.BitLen() > 256 || sig.S.BitLen() > 256 {
+		return nil, errors.New("invalid ecdsa signature")
+	}
+
+	raw := make([]byte, 64)
+	sig.R.FillBytes(raw[:32])
+	sig.S.FillBytes(raw[32:])
+
+	return raw, nil
+}
+
+// ecdsaSignatureFromRaw converts an ES256 signature encoded as the concatenation of r and s to ASN.1 DER.
+func ecdsaSignatureFromRaw(raw []byte) ([]byte, error) {
+	if len(raw) != 64 {
+		return nil, ErrInvalidSignature
+	}
+
+	return asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(raw[:32]), new(big.Int).SetBytes(raw[32:])})
+}
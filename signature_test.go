@@ -0,0 +1,322 @@
+package arcane
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpener_OpenSignatureAlgorithm(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name        string
+		sealerAlg   SignatureAlgorithm
+		openerAlgs  []SignatureAlgorithm
+		tamper      func(header *Header)
+		expectedAlg SignatureAlgorithm
+		expectedErr error
+	}{
+		{
+			name:        "Default",
+			expectedAlg: RS256,
+		},
+		{
+			name:        "PS256",
+			sealerAlg:   PS256,
+			expectedAlg: PS256,
+		},
+		{
+			name:        "PS256 only",
+			sealerAlg:   PS256,
+			openerAlgs:  []SignatureAlgorithm{PS256},
+			expectedAlg: PS256,
+		},
+		{
+			name:        "RS256 not allowed",
+			sealerAlg:   RS256,
+			openerAlgs:  []SignatureAlgorithm{PS256},
+			expectedAlg: RS256,
+			expectedErr: ErrUnsupportedSignatureAlgorithm,
+		},
+		{
+			name:        "Nothing allowed",
+			sealerAlg:   PS256,
+			openerAlgs:  []SignatureAlgorithm{},
+			expectedAlg: PS256,
+			expectedErr: ErrUnsupportedSignatureAlgorithm,
+		},
+		{
+			name:        "Algorithm swapped",
+			sealerAlg:   PS256,
+			tamper:      func(header *Header) { header.SignatureAlgorithm = RS256 },
+			expectedAlg: PS256,
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Algorithm removed",
+			sealerAlg:   PS256,
+			tamper:      func(header *Header) { header.SignatureAlgorithm = "" },
+			expectedAlg: PS256,
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name:        "Unknown algorithm",
+			sealerAlg:   PS256,
+			openerAlgs:  []SignatureAlgorithm{"none"},
+			tamper:      func(header *Header) { header.SignatureAlgorithm = "none" },
+			expectedAlg: PS256,
+			expectedErr: ErrUnsupportedSignatureAlgorithm,
+		},
+	}
+
+	for _, test := range tests {
+		sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}, SignatureAlgorithm: test.sealerAlg}
+		opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, SignatureAlgorithms: test.openerAlgs}
+
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedAlg, message.Header.SignatureAlgorithm, test.name)
+
+		if test.tamper != nil {
+			test.tamper(&message.Header)
+		}
+
+		payload, err := opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr != nil {
+			assert.Nil(t, payload)
+		}
+	}
+}
+
+func TestSealer_SealUnsupportedSignatureAlgorithm(t *testing.T) {
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}, SignatureAlgorithm: "none"}
+
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.Error(t, err)
+	assert.Nil(t, message)
+}
+
+func TestSealer_SealSignatureAlgorithmKeyMismatch(t *testing.T) {
+	tests := []struct {
+		key crypto.Signer
+		alg SignatureAlgorithm
+	}{
+		{signedPk1, ES256},
+		{signedPk1, EdDSA},
+		{ecdsaPk1, RS256},
+		{ecdsaPk1, PS256},
+		{ecdsaPk1, EdDSA},
+		{ed25519Pk, ES256},
+		{ed25519Pk, PS256},
+	}
+
+	for _, test := range tests {
+		sealer := &Sealer{PrivateKey: test.key, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}, SignatureAlgorithm: test.alg}
+
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		assert.Error(t, err, test.alg)
+		assert.Nil(t, message)
+	}
+}
+
+func TestVerifyKeyMismatch(t *testing.T) {
+	digest := make([]byte, 32)
+
+	signature, err := sign(ES256, ecdsaPk1, digest)
+	assert.NoError(t, err)
+	assert.NoError(t, verify(ES256, ecdsaCert1.PublicKey, digest, signature))
+	assert.Equal(t, ErrInvalidSignature, verify(ES256, signedCert1.PublicKey, digest, signature))
+	assert.Equal(t, ErrInvalidSignature, verify(EdDSA, ed25519Cert.PublicKey, digest, signature))
+	assert.Equal(t, ErrInvalidSignature, verify(RS256, ecdsaCert1.PublicKey, digest, signature))
+	assert.Equal(t, ErrUnsupportedSignatureAlgorithm, verify("none", ecdsaCert1.PublicKey, digest, signature))
+}
+
+func TestOpener_OpenForwarded(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+
+	payload, err := (&Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}).Open(message)
+	assert.NoError(t, err)
+
+	// The receiver re-encrypts the payload for a third party, keeping the original sealers signature.
+	forwarded, err := reseal(message.Header, signedCert3, payload)
+	assert.NoError(t, err)
+
+	_, err = (&Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool}).Open(forwarded)
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestOpener_OpenForwardedLegacy(t *testing.T) {
+	setNow(t, sealTime)
+
+	// Legacy messages only sign the timestamps and the plaintext, so a receiver can wrap the encryption key for a third
+	// party using RSA-OAEP and forward the message.
+	payload := []byte("This is a test payload.")
+	header := Header{
+		SealerCert: signedCert1.Raw,
+		Created:    sealTime.Format(time.RFC3339),
+		Expires:    sealTime.Add(5 * time.Minute).Format(time.RFC3339),
+	}
+	signature, err := sign(RS256, signedPk1, legacySignatureDigest(&header, nil, payload))
+	assert.NoError(t, err)
+	header.Signature = signature
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	assert.NoError(t, err)
+	recipient, err := wrapKey(signedCert3, key, keyWrapLabel(&header))
+	assert.NoError(t, err)
+	header.Recipients = []Recipient{recipient}
+
+	c, err := aes.NewCipher(key)
+	assert.NoError(t, err)
+	gcm, err := cipher.NewGCM(c)
+	assert.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	forwarded := &Envelope{Header: header, Payload: gcm.Seal(nonce, nonce, payload, nil)}
+
+	_, err = (&Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool}).Open(forwarded)
+	assert.Equal(t, &UnsupportedVersionError{Version: versionLegacy}, err)
+
+	// Legacy messages are only opened when AllowPKCS1v15 is set.
+	opened, err := (&Opener{PrivateKey: signedPk3, Cert: signedCert3, CertPool: caCertPool, AllowPKCS1v15: true}).Open(forwarded)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, opened)
+
+	// Versions between the legacy and the current version were never released.
+	message, err := (&Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}).Seal(payload)
+	assert.NoError(t, err)
+	for version := versionHeaderAAD; version < currentVersion; version++ {
+		message.Header.Version = version
+		_, err = (&Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, AllowPKCS1v15: true}).Open(message)
+		assert.Equal(t, &UnsupportedVersionError{Version: version}, err, version)
+	}
+}
+
+func TestOpener_RecipientFingerprint(t *testing.T) {
+	header := &Header{
+		Version: currentVersion,
+		Recipients: []Recipient{
+			{Issuer: signedCert2.RawIssuer, SerialNumber: signedCert2.SerialNumber, CertFingerprint: []byte{1}},
+		},
+	}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2}
+
+	_, err := opener.recipient(header)
+	assert.Equal(t, ErrNotRecipient, err)
+
+	header.Recipients[0].CertFingerprint = nil
+	_, err = opener.recipient(header)
+	assert.Equal(t, ErrNotRecipient, err)
+
+	fingerprint := sha256.Sum256(signedCert2.Raw)
+	header.Recipients[0].CertFingerprint = fingerprint[:]
+	recipient, err := opener.recipient(header)
+	assert.NoError(t, err)
+	assert.Equal(t, &header.Recipients[0], recipient)
+
+	// Fingerprints are not required before they were introduced.
+	header.Version = versionHeaderAAD
+	header.Recipients[0].CertFingerprint = nil
+	_, err = opener.recipient(header)
+	assert.NoError(t, err)
+}
+
+// reseal encrypts payload for receiverCert using the timestamps, sealer certificate and signature from header.
+func reseal(header Header, receiverCert *x509.Certificate, payload []byte) (*Envelope, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	recipient, err := wrapKey(receiverCert, key, keyWrapLabel(&header))
+	if err != nil {
+		return nil, err
+	}
+	header.Recipients = []Recipient{recipient}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Header:  header,
+		Payload: gcm.Seal(nonce, nonce, payload, header.additionalData()),
+	}, nil
+}
+
+func TestSignatureVectors(t *testing.T) {
+	b, err := ioutil.ReadFile("test/data/signature_vectors.json")
+	assert.NoError(t, err)
+
+	var vectors []struct {
+		Name             string `json:"name"`
+		Header           Header `json:"header"`
+		EncryptedPayload []byte `json:"encryptedPayload"`
+		Plaintext        []byte `json:"plaintext"`
+		SigningInput     string `json:"signingInput"`
+		Digest           string `json:"digest"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &vectors))
+	assert.NotEmpty(t, vectors)
+
+	for _, vector := range vectors {
+		// The vectors must be regenerated when the format version changes.
+		assert.Equal(t, currentVersion, vector.Header.Version, vector.Name)
+
+		input := signingInput(&vector.Header, vector.EncryptedPayload, vector.Plaintext)
+		assert.Equal(t, vector.SigningInput, hex.EncodeToString(input), vector.Name)
+
+		digest := signatureDigest(&vector.Header, vector.EncryptedPayload, vector.Plaintext)
+		assert.Equal(t, vector.Digest, hex.EncodeToString(digest), vector.Name)
+
+		sealerCert, err := x509.ParseCertificate(vector.Header.SealerCert)
+		assert.NoError(t, err)
+		assert.NoError(t, verify(vector.Header.SignatureAlgorithm, sealerCert.PublicKey, digest, vector.Header.Signature), vector.Name)
+	}
+}
+
+func TestSigningInputUnambiguous(t *testing.T) {
+	header := &Header{Version: currentVersion, Created: "2020-11-26T18:37:56+01:00", Expires: "2020-11-26T18:42:56+01:00"}
+
+	// Moving bytes from the encrypted payload to the plaintext must change the digest.
+	assert.NotEqual(t,
+		signatureDigest(header, []byte("ab"), []byte("c")),
+		signatureDigest(header, []byte("a"), []byte("bc")),
+	)
+
+	// Moving bytes between timestamps must change the digest.
+	moved := *header
+	moved.Created, moved.Expires = header.Created+"2", header.Expires[1:]
+	assert.NotEqual(t, signatureDigest(header, nil, nil), signatureDigest(&moved, nil, nil))
+
+	// Legacy messages concatenate the fields.
+	legacy := &Header{Created: "a", Expires: "b"}
+	assert.Equal(t, signatureDigest(legacy, nil, []byte("c")), signatureDigest(&Header{Created: "ab"}, nil, []byte("c")))
+}
@@ -0,0 +1,321 @@
+package arcane
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+)
+
+const (
+	// streamChunkSize is the size of the plaintext chunks written by SealStream.
+	streamChunkSize = 64 * 1024
+	// maxStreamChunkSize limits the chunk size accepted by OpenStream, and so the memory needed to open a stream.
+	maxStreamChunkSize = 16 * 1024 * 1024
+	// maxStreamHeaderSize limits the size of the header accepted by OpenStream.
+	maxStreamHeaderSize = 1024 * 1024
+	// maxStreamSignatureSize limits the size of the signature accepted by OpenStream.
+	maxStreamSignatureSize = 16 * 1024
+	// streamNonceSize is the nonce size of the content cipher required for streams.
+	streamNonceSize = 12
+)
+
+// Flags marking whether a chunk is the last in a stream.
+const (
+	chunkMore  byte = 0
+	chunkFinal byte = 1
+)
+
+// SealStream encrypts and signs everything read from r and writes the sealed stream to w. The plaintext is encrypted
+// in chunks, so memory use does not depend on the size of the payload. The stream can be opened by any of the
+// receivers using OpenStream.
+//
+// A stream consists of the header encoded as JSON, followed by the encrypted chunks and the signature. Each of these
+// are prefixed by their length as a four byte big endian integer, and each chunk is also prefixed by a flag marking
+// whether it is the final chunk. Chunks are encrypted using a nonce made from a counter and the final chunk flag as in
+// the STREAM construction, so chunks can not be reordered, dropped or truncated. The signature covers the header and
+// digests of the whole encrypted and plaintext stream.
+func (s *Sealer) SealStream(w io.Writer, r io.Reader) error {
+	header, suite, encryptionKey, err := s.header()
+	if err != nil {
+		return err
+	}
+
+	header.ChunkSize = streamChunkSize
+
+	aead, err := suite.contentCipher(encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	if aead.NonceSize() != streamNonceSize {
+		return errors.New("content algorithm can not be used with streams")
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	if err := writeLengthPrefixed(w, headerBytes); err != nil {
+		return err
+	}
+
+	cw := &chunkWriter{
+		w:              w,
+		aead:           aead,
+		additionalData: header.additionalData(),
+		ciphertextHash: sha256.New(),
+	}
+	plaintextHash := sha256.New()
+
+	br := bufio.NewReader(r)
+	chunk := make([]byte, header.ChunkSize)
+	for {
+		n, err := io.ReadFull(br, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		final := n < len(chunk)
+		if !final {
+			if _, err := br.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		plaintextHash.Write(chunk[:n])
+		if err := cw.writeChunk(chunk[:n], final); err != nil {
+			return err
+		}
+
+		if final {
+			break
+		}
+	}
+
+	digest := streamSignatureDigest(header, cw.ciphertextHash.Sum(nil), plaintextHash.Sum(nil))
+	signature, err := sign(header.SignatureAlgorithm, s.PrivateKey, digest)
+	if err != nil {
+		return err
+	}
+
+	return writeLengthPrefixed(w, signature)
+}
+
+// OpenStream opens a stream sealed using SealStream and writes the plaintext to w.
+//
+// Chunks are written to w as soon as they are decrypted, before the signature at the end of the stream is verified.
+// Anything written to w must be discarded if OpenStream returns an error. r is read until EOF, and streams with data
+// after the signature are rejected.
+func (o *Opener) OpenStream(w io.Writer, r io.Reader) error {
+	_, err := o.OpenStreamWithInfo(w, r)
+	return err
+}
+
+// OpenStreamWithInfo opens a stream like OpenStream, and also returns who sealed it and when.
+func (o *Opener) OpenStreamWithInfo(w io.Writer, r io.Reader) (*OpenInfo, error) {
+	if err := o.checkPrivateKey(); err != nil {
+		return nil, err
+	}
+
+	headerBytes, err := readLengthPrefixed(r, maxStreamHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var header Header
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, err
+	}
+
+	// Streams can not carry metadata.
+	if header.ChunkSize <= 0 || header.ChunkSize > maxStreamChunkSize || len(header.Signature) != 0 || len(header.EncryptedMetadata) != 0 {
+		return nil, errors.New("invalid stream header")
+	}
+
+	if header.Version < versionSuite {
+		return nil, &UnsupportedVersionError{Version: header.Version}
+	}
+
+	opened, err := o.openHeader(&header)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := opened.suite.contentCipher(opened.encryptionKey)
+	if err != nil || aead.NonceSize() != streamNonceSize {
+		return nil, ErrUnableToDecryptPayload
+	}
+
+	cr := &chunkReader{
+		r:              r,
+		aead:           aead,
+		additionalData: header.additionalData(),
+		chunkSize:      header.ChunkSize,
+		ciphertextHash: sha256.New(),
+	}
+	plaintextHash := sha256.New()
+
+	for {
+		plaintext, final, err := cr.readChunk()
+		if err != nil {
+			return nil, err
+		}
+
+		plaintextHash.Write(plaintext)
+		if _, err := w.Write(plaintext); err != nil {
+			return nil, err
+		}
+
+		if final {
+			break
+		}
+	}
+
+	signature, err := readLengthPrefixed(r, maxStreamSignatureSize)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	digest := streamSignatureDigest(&header, cr.ciphertextHash.Sum(nil), plaintextHash.Sum(nil))
+	if err := verify(opened.signatureAlgorithm, opened.sealerCert.PublicKey, digest, signature); err != nil {
+		return nil, err
+	}
+
+	// The signature is the last record of the stream, so anything after it was not sealed along with the stream.
+	if _, err := io.ReadFull(r, make([]byte, 1)); err != io.EOF {
+		if err == nil {
+			return nil, ErrInvalidMessage
+		}
+		return nil, err
+	}
+
+	if err := o.checkReplay(opened.sealerCert, header.MessageID, opened.acceptUntil); err != nil {
+		return nil, err
+	}
+
+	return opened.info(&header), nil
+}
+
+// chunkNonce returns the nonce for a chunk. It is the chunk counter as an 11 byte big endian integer followed by the
+// final chunk flag.
+func chunkNonce(counter uint64, final bool) []byte {
+	nonce := make([]byte, streamNonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if final {
+		nonce[11] = chunkFinal
+	}
+
+	return nonce
+}
+
+type chunkWriter struct {
+	w              io.Writer
+	aead           cipher.AEAD
+	additionalData []byte
+	counter        uint64
+	ciphertextHash hash.Hash
+}
+
+func (cw *chunkWriter) writeChunk(plaintext []byte, final bool) error {
+	flag := chunkMore
+	if final {
+		flag = chunkFinal
+	}
+
+	sealed := cw.aead.Seal(nil, chunkNonce(cw.counter, final), plaintext, cw.additionalData)
+	cw.counter++
+
+	record := make([]byte, 5, 5+len(sealed))
+	record[0] = flag
+	binary.BigEndian.PutUint32(record[1:], uint32(len(sealed)))
+	record = append(record, sealed...)
+
+	cw.ciphertextHash.Write(record)
+	_, err := cw.w.Write(record)
+
+	return err
+}
+
+type chunkReader struct {
+	r              io.Reader
+	aead           cipher.AEAD
+	additionalData []byte
+	chunkSize      int
+	counter        uint64
+	ciphertextHash hash.Hash
+}
+
+// readChunk reads and decrypts the next chunk. Every chunk except the last must hold exactly chunkSize bytes of
+// plaintext, and only a stream with no plaintext can end with an empty chunk.
+func (cr *chunkReader) readChunk() ([]byte, bool, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(cr.r, prefix[:]); err != nil {
+		return nil, false, ErrUnableToDecryptPayload
+	}
+
+	final := prefix[0] == chunkFinal
+	if prefix[0] != chunkMore && !final {
+		return nil, false, ErrUnableToDecryptPayload
+	}
+
+	maxLength := cr.chunkSize + cr.aead.Overhead()
+	length := int(binary.BigEndian.Uint32(prefix[1:]))
+	if length > maxLength || (!final && length != maxLength) || (final && cr.counter > 0 && length == cr.aead.Overhead()) {
+		return nil, false, ErrUnableToDecryptPayload
+	}
+
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(cr.r, sealed); err != nil {
+		return nil, false, ErrUnableToDecryptPayload
+	}
+
+	plaintext, err := cr.aead.Open(nil, chunkNonce(cr.counter, final), sealed, cr.additionalData)
+	if err != nil {
+		return nil, false, ErrUnableToDecryptPayload
+	}
+	cr.counter++
+
+	cr.ciphertextHash.Write(prefix[:])
+	cr.ciphertextHash.Write(sealed)
+
+	return plaintext, final, nil
+}
+
+func writeLengthPrefixed(w io.Writer, b []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(b)))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(b)
+
+	return err
+}
+
+func readLengthPrefixed(r io.Reader, maxLength int) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(length[:])
+	if uint64(n) > uint64(maxLength) {
+		return nil, errors.New("length exceeds limit")
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
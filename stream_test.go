@@ -0,0 +1,203 @@
+package arcane
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealer_SealStream(t *testing.T) {
+	setNow(t, sealTime)
+
+	rsaSealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2, ecdsaCert1}}
+	ecSealer := &Sealer{PrivateKey: ed25519Pk, Cert: ed25519Cert, ReceiverCerts: []*x509.Certificate{ecdsaCert1}}
+	rsaOpener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+	ecOpener := &Opener{PrivateKey: ecdsaPk1, Cert: ecdsaCert1, CertPool: caCertPool}
+
+	tests := []struct {
+		name   string
+		sealer *Sealer
+		opener *Opener
+		size   int
+	}{
+		{name: "Empty", sealer: rsaSealer, opener: rsaOpener, size: 0},
+		{name: "One byte", sealer: rsaSealer, opener: ecOpener, size: 1},
+		{name: "Less than a chunk", sealer: ecSealer, opener: ecOpener, size: streamChunkSize - 1},
+		{name: "One chunk", sealer: rsaSealer, opener: rsaOpener, size: streamChunkSize},
+		{name: "More than a chunk", sealer: ecSealer, opener: ecOpener, size: streamChunkSize + 1},
+		{name: "Several chunks", sealer: rsaSealer, opener: ecOpener, size: 3*streamChunkSize + 7},
+	}
+
+	for _, test := range tests {
+		payload := make([]byte, test.size)
+		_, err := rand.Read(payload)
+		assert.NoError(t, err)
+
+		var sealed bytes.Buffer
+		assert.NoError(t, test.sealer.SealStream(&sealed, bytes.NewReader(payload)), test.name)
+
+		header, chunks, _ := splitStream(t, sealed.Bytes())
+		expectedChunks := (test.size + streamChunkSize - 1) / streamChunkSize
+		if expectedChunks == 0 {
+			expectedChunks = 1
+		}
+		assert.Equal(t, expectedChunks, len(chunks), test.name)
+		assert.Contains(t, string(header), `"chunkSize":65536`, test.name)
+
+		var opened bytes.Buffer
+		info, err := test.opener.OpenStreamWithInfo(&opened, &sealed)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, string(payload), opened.String(), test.name)
+		assert.Equal(t, test.sealer.Cert.Raw, info.SealerCert.Raw, test.name)
+		assert.Len(t, info.MessageID, 32, test.name)
+	}
+}
+
+func TestOpener_OpenStreamTampered(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+
+	payload := make([]byte, 2*streamChunkSize+10)
+	_, err := rand.Read(payload)
+	assert.NoError(t, err)
+
+	var sealed bytes.Buffer
+	assert.NoError(t, sealer.SealStream(&sealed, bytes.NewReader(payload)))
+	header, chunks, signature := splitStream(t, sealed.Bytes())
+
+	tests := []struct {
+		name        string
+		tamper      func(chunks [][]byte, signature []byte) ([][]byte, []byte)
+		expectedErr error
+	}{
+		{
+			name:        "Untampered",
+			tamper:      func(chunks [][]byte, signature []byte) ([][]byte, []byte) { return chunks, signature },
+			expectedErr: nil,
+		},
+		{
+			name: "Final chunk dropped",
+			tamper: func(chunks [][]byte, signature []byte) ([][]byte, []byte) {
+				return chunks[:2], signature
+			},
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name: "Truncated as final",
+			tamper: func(chunks [][]byte, signature []byte) ([][]byte, []byte) {
+				chunks[1][0] = chunkFinal
+				return chunks[:2], signature
+			},
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name: "Chunks reordered",
+			tamper: func(chunks [][]byte, signature []byte) ([][]byte, []byte) {
+				return [][]byte{chunks[1], chunks[0], chunks[2]}, signature
+			},
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name: "Chunk modified",
+			tamper: func(chunks [][]byte, signature []byte) ([][]byte, []byte) {
+				chunks[1][10] ^= 1
+				return chunks, signature
+			},
+			expectedErr: ErrUnableToDecryptPayload,
+		},
+		{
+			name: "Chunk appended",
+			tamper: func(chunks [][]byte, signature []byte) ([][]byte, []byte) {
+				return append(chunks, chunks[2]), signature
+			},
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name: "Signature modified",
+			tamper: func(chunks [][]byte, signature []byte) ([][]byte, []byte) {
+				signature[10] ^= 1
+				return chunks, signature
+			},
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name: "Data after signature",
+			tamper: func(chunks [][]byte, signature []byte) ([][]byte, []byte) {
+				return chunks, append(signature, 0)
+			},
+			expectedErr: ErrInvalidMessage,
+		},
+		{
+			name: "Signature removed",
+			tamper: func(chunks [][]byte, signature []byte) ([][]byte, []byte) {
+				return chunks, nil
+			},
+			expectedErr: ErrInvalidSignature,
+		},
+	}
+
+	for _, test := range tests {
+		tamperedChunks := make([][]byte, len(chunks))
+		for i := range chunks {
+			tamperedChunks[i] = append([]byte(nil), chunks[i]...)
+		}
+		tamperedChunks, tamperedSignature := test.tamper(tamperedChunks, append([]byte(nil), signature...))
+
+		var stream bytes.Buffer
+		stream.Write(header)
+		for _, chunk := range tamperedChunks {
+			stream.Write(chunk)
+		}
+		stream.Write(tamperedSignature)
+
+		var opened bytes.Buffer
+		err := opener.OpenStream(&opened, &stream)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr == nil {
+			assert.Equal(t, payload, opened.Bytes(), test.name)
+		}
+	}
+}
+
+func TestOpener_OpenStreamAsMessage(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+
+	// Open does not accept messages with the chunk size set.
+	message.Header.ChunkSize = streamChunkSize
+	_, err = opener.Open(message)
+	assert.Error(t, err)
+}
+
+// splitStream splits a sealed stream into the length prefixed header, the chunk records and the length prefixed
+// signature.
+func splitStream(t *testing.T, stream []byte) ([]byte, [][]byte, []byte) {
+	headerLength := 4 + int(binary.BigEndian.Uint32(stream))
+	header, rest := stream[:headerLength], stream[headerLength:]
+
+	var chunks [][]byte
+	for {
+		length := 5 + int(binary.BigEndian.Uint32(rest[1:]))
+		final := rest[0] == chunkFinal
+		chunks = append(chunks, rest[:length])
+		rest = rest[length:]
+		if final {
+			break
+		}
+	}
+
+	assert.Equal(t, 4+int(binary.BigEndian.Uint32(rest)), len(rest))
+
+	return header, chunks, rest
+}
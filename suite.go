@@ -0,0 +1,246 @@
+package arcane
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"sync"
+)
+
+// ContentAlgorithm identifies the authenticated encryption algorithm used to encrypt the payload.
+type ContentAlgorithm string
+
+const (
+	// A256GCM is AES-256 in Galois/Counter Mode. The random nonce is prepended to the ciphertext.
+	A256GCM ContentAlgorithm = "A256GCM"
+)
+
+// Names of the suites registered by default.
+const (
+	// SuiteLegacy is implied by messages sealed before the suite was recorded in the header. It allows every algorithm
+	// those messages could be sealed with.
+	SuiteLegacy = "arcane-legacy"
+	// SuiteRSA wraps the encryption key using RSA-OAEP and signs using RSA.
+	SuiteRSA = "arcane-rsa-a256gcm"
+	// SuiteEC wraps the encryption key using ECDH or X25519 and signs using ECDSA or Ed25519.
+	SuiteEC = "arcane-ec-a256gcm"
+	// SuiteMixed allows RSA and elliptic curve receivers and sealers in the same message.
+	SuiteMixed = "arcane-mixed-a256gcm"
+)
+
+// DefaultSuites are the suites accepted by Opener if Suites is not set.
+var DefaultSuites = []string{SuiteLegacy, SuiteRSA, SuiteEC, SuiteMixed}
+
+// sealerSuites are tried in order when Sealer has no suite set. The first one allowing the signature algorithm and
+// the key wrap algorithms of every receiver is used.
+var sealerSuites = []string{SuiteRSA, SuiteEC, SuiteMixed}
+
+// Suite is a named combination of algorithms. A message sealed using a suite only uses the key wrap and signature
+// algorithms listed in it.
+type Suite struct {
+	Name                string
+	KeyWrapAlgorithms   []KeyWrapAlgorithm
+	SignatureAlgorithms []SignatureAlgorithm
+	ContentAlgorithm    ContentAlgorithm
+}
+
+var (
+	suitesMu sync.RWMutex
+	suites   = map[string]Suite{
+		SuiteLegacy: {
+			Name:                SuiteLegacy,
+			KeyWrapAlgorithms:   []KeyWrapAlgorithm{RSA1_5, RSAOAEP256, ECDHESHKDF256, X25519HKDF256},
+			SignatureAlgorithms: []SignatureAlgorithm{RS256, PS256, ES256, EdDSA},
+			ContentAlgorithm:    A256GCM,
+		},
+		SuiteRSA: {
+			Name:                SuiteRSA,
+			KeyWrapAlgorithms:   []KeyWrapAlgorithm{RSAOAEP256},
+			SignatureAlgorithms: []SignatureAlgorithm{PS256, RS256},
+			ContentAlgorithm:    A256GCM,
+		},
+		SuiteEC: {
+			Name:                SuiteEC,
+			KeyWrapAlgorithms:   []KeyWrapAlgorithm{ECDHESHKDF256, X25519HKDF256},
+			SignatureAlgorithms: []SignatureAlgorithm{ES256, EdDSA},
+			ContentAlgorithm:    A256GCM,
+		},
+		SuiteMixed: {
+			Name:                SuiteMixed,
+			KeyWrapAlgorithms:   []KeyWrapAlgorithm{RSAOAEP256, ECDHESHKDF256, X25519HKDF256},
+			SignatureAlgorithms: []SignatureAlgorithm{PS256, RS256, ES256, EdDSA},
+			ContentAlgorithm:    A256GCM,
+		},
+	}
+)
+
+// RegisterSuite makes a suite available to Sealer and Opener. It can be used to define suites that only allow a subset
+// of the supported algorithms. An Opener only accepts a registered suite if it is listed in Opener.Suites.
+func RegisterSuite(suite Suite) error {
+	if suite.Name == "" {
+		return errors.New("suite name is empty")
+	}
+
+	if len(suite.KeyWrapAlgorithms) == 0 || len(suite.SignatureAlgorithms) == 0 {
+		return errors.New("suite must allow at least one key wrap and signature algorithm")
+	}
+
+	for _, alg := range suite.KeyWrapAlgorithms {
+		switch alg {
+		case RSA1_5, RSAOAEP256, ECDHESHKDF256, X25519HKDF256:
+		default:
+			return errors.New("unsupported key wrap algorithm " + string(alg))
+		}
+	}
+
+	for _, alg := range suite.SignatureAlgorithms {
+		switch alg {
+		case RS256, PS256, ES256, EdDSA:
+		default:
+			return errors.New("unsupported signature algorithm " + string(alg))
+		}
+	}
+
+	if suite.ContentAlgorithm != A256GCM {
+		return errors.New("unsupported content algorithm " + string(suite.ContentAlgorithm))
+	}
+
+	suitesMu.Lock()
+	defer suitesMu.Unlock()
+
+	if _, exists := suites[suite.Name]; exists {
+		return errors.New("suite " + suite.Name + " is already registered")
+	}
+
+	suite.KeyWrapAlgorithms = append([]KeyWrapAlgorithm(nil), suite.KeyWrapAlgorithms...)
+	suite.SignatureAlgorithms = append([]SignatureAlgorithm(nil), suite.SignatureAlgorithms...)
+	suites[suite.Name] = suite
+
+	return nil
+}
+
+// LookupSuite returns the registered suite with the given name.
+func LookupSuite(name string) (Suite, bool) {
+	suitesMu.RLock()
+	defer suitesMu.RUnlock()
+
+	suite, ok := suites[name]
+
+	return suite, ok
+}
+
+func (s *Suite) allowsKeyWrap(alg KeyWrapAlgorithm) bool {
+	if alg == "" {
+		// Messages sealed before the algorithm was recorded always wrap the key using RSA1_5.
+		alg = RSA1_5
+	}
+
+	for _, a := range s.KeyWrapAlgorithms {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Suite) allowsRecipients(recipients []Recipient) bool {
+	for _, recipient := range recipients {
+		if !s.allowsKeyWrap(recipient.Algorithm) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Suite) allowsSignature(alg SignatureAlgorithm) bool {
+	for _, a := range s.SignatureAlgorithms {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentCipher returns the AEAD used to encrypt the payload.
+func (s *Suite) contentCipher(key []byte) (cipher.AEAD, error) {
+	switch s.ContentAlgorithm {
+	case A256GCM:
+		if len(key) != 32 {
+			return nil, errors.New("invalid encryption key length")
+		}
+
+		c, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return cipher.NewGCM(c)
+	default:
+		return nil, errors.New("unsupported content algorithm " + string(s.ContentAlgorithm))
+	}
+}
+
+// suite returns the suite used to seal a message. If no suite is set on the Sealer the first of sealerSuites allowing
+// the algorithms used is picked.
+func (s *Sealer) suite(header *Header) (Suite, error) {
+	names := sealerSuites
+	if s.Suite != "" {
+		names = []string{s.Suite}
+	}
+
+	for _, name := range names {
+		suite, ok := LookupSuite(name)
+		if !ok {
+			return Suite{}, &UnsupportedSuiteError{Suite: name}
+		}
+
+		if suite.allowsSignature(header.SignatureAlgorithm) && suite.allowsRecipients(header.Recipients) {
+			return suite, nil
+		}
+	}
+
+	if s.Suite != "" {
+		return Suite{}, errors.New("suite " + s.Suite + " does not allow the algorithms required by the sealer and receiver keys")
+	}
+
+	return Suite{}, errors.New("no suite allows the algorithms required by the sealer and receiver keys")
+}
+
+// suite returns the suite a message was sealed with if it is accepted by the Opener. Messages sealed before
+// versionSuite use SuiteLegacy.
+func (o *Opener) suite(header *Header) (Suite, error) {
+	name := header.Suite
+	allowed := o.Suites
+	if allowed == nil {
+		allowed = DefaultSuites
+	}
+
+	if header.Version < versionSuite {
+		if name != "" {
+			// The suite can not be set on messages sealed before it was introduced.
+			allowed = nil
+		} else {
+			name = SuiteLegacy
+		}
+	}
+
+	for _, a := range allowed {
+		if a != name {
+			continue
+		}
+
+		suite, ok := LookupSuite(name)
+		if !ok {
+			break
+		}
+
+		return suite, nil
+	}
+
+	_, registered := LookupSuite(name)
+
+	return Suite{}, &UnsupportedSuiteError{Suite: name, Registered: registered}
+}
@@ -0,0 +1,219 @@
+package arcane
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealer_SealSuite(t *testing.T) {
+	setNow(t, sealTime)
+
+	tests := []struct {
+		name          string
+		sealerKey     crypto.Signer
+		sealerCert    *x509.Certificate
+		receiverCerts []*x509.Certificate
+		suite         string
+		expectedSuite string
+		expectErr     bool
+	}{
+		{
+			name:          "RSA",
+			sealerKey:     signedPk1,
+			sealerCert:    signedCert1,
+			receiverCerts: []*x509.Certificate{signedCert2},
+			expectedSuite: SuiteRSA,
+		},
+		{
+			name:          "EC",
+			sealerKey:     ecdsaPk1,
+			sealerCert:    ecdsaCert1,
+			receiverCerts: []*x509.Certificate{ed25519Cert},
+			expectedSuite: SuiteEC,
+		},
+		{
+			name:          "RSA sealer and EC receiver",
+			sealerKey:     signedPk1,
+			sealerCert:    signedCert1,
+			receiverCerts: []*x509.Certificate{ecdsaCert1},
+			expectedSuite: SuiteMixed,
+		},
+		{
+			name:          "RSA and EC receivers",
+			sealerKey:     ed25519Pk,
+			sealerCert:    ed25519Cert,
+			receiverCerts: []*x509.Certificate{signedCert2, ecdsaCert1},
+			expectedSuite: SuiteMixed,
+		},
+		{
+			name:          "Suite set",
+			sealerKey:     signedPk1,
+			sealerCert:    signedCert1,
+			receiverCerts: []*x509.Certificate{signedCert2},
+			suite:         SuiteMixed,
+			expectedSuite: SuiteMixed,
+		},
+		{
+			name:          "Suite not matching keys",
+			sealerKey:     signedPk1,
+			sealerCert:    signedCert1,
+			receiverCerts: []*x509.Certificate{ecdsaCert1},
+			suite:         SuiteRSA,
+			expectErr:     true,
+		},
+		{
+			name:          "Unknown suite",
+			sealerKey:     signedPk1,
+			sealerCert:    signedCert1,
+			receiverCerts: []*x509.Certificate{signedCert2},
+			suite:         "unknown",
+			expectErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		sealer := &Sealer{PrivateKey: test.sealerKey, Cert: test.sealerCert, ReceiverCerts: test.receiverCerts, Suite: test.suite}
+
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		if test.expectErr {
+			assert.Error(t, err, test.name)
+			continue
+		}
+
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, currentVersion, message.Header.Version, test.name)
+		assert.Equal(t, test.expectedSuite, message.Header.Suite, test.name)
+	}
+}
+
+func TestOpener_OpenSuite(t *testing.T) {
+	setNow(t, sealTime)
+
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}}
+
+	tests := []struct {
+		name        string
+		suites      []string
+		tamper      func(header *Header)
+		expectedErr error
+	}{
+		{
+			name:        "Default suites",
+			expectedErr: nil,
+		},
+		{
+			name:        "Suite allowed",
+			suites:      []string{SuiteRSA},
+			expectedErr: nil,
+		},
+		{
+			name:        "Suite not allowed",
+			suites:      []string{SuiteEC, SuiteMixed},
+			expectedErr: &UnsupportedSuiteError{Suite: SuiteRSA, Registered: true},
+		},
+		{
+			name:        "Unknown suite",
+			tamper:      func(header *Header) { header.Suite = "unknown" },
+			expectedErr: &UnsupportedSuiteError{Suite: "unknown"},
+		},
+		{
+			name:        "Unknown suite allowed",
+			suites:      []string{"unknown"},
+			tamper:      func(header *Header) { header.Suite = "unknown" },
+			expectedErr: &UnsupportedSuiteError{Suite: "unknown"},
+		},
+		{
+			name:        "Suite removed",
+			tamper:      func(header *Header) { header.Suite = "" },
+			expectedErr: &UnsupportedSuiteError{},
+		},
+	}
+
+	for _, test := range tests {
+		opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool, Suites: test.suites}
+
+		message, err := sealer.Seal([]byte("This is a test payload."))
+		assert.NoError(t, err)
+
+		if test.tamper != nil {
+			test.tamper(&message.Header)
+		}
+
+		payload, err := opener.Open(message)
+		assert.Equal(t, test.expectedErr, err, test.name)
+		if test.expectedErr != nil {
+			assert.True(t, errors.Is(err, ErrUnsupportedSuite), test.name)
+			assert.Nil(t, payload)
+		}
+	}
+}
+
+func TestOpener_SuiteLegacy(t *testing.T) {
+	opener := &Opener{}
+
+	suite, err := opener.suite(&Header{Version: versionCanonicalSignature})
+	assert.NoError(t, err)
+	assert.Equal(t, SuiteLegacy, suite.Name)
+
+	// Only messages recording a suite are accepted when the legacy suite is not allowed.
+	opener.Suites = []string{SuiteRSA}
+	_, err = opener.suite(&Header{Version: versionLegacy})
+	assert.Equal(t, &UnsupportedSuiteError{Suite: SuiteLegacy, Registered: true}, err)
+
+	// The suite is not set on messages from before it was introduced.
+	opener.Suites = nil
+	_, err = opener.suite(&Header{Version: versionCanonicalSignature, Suite: SuiteRSA})
+	assert.Equal(t, &UnsupportedSuiteError{Suite: SuiteRSA, Registered: true}, err)
+}
+
+func TestRegisterSuite(t *testing.T) {
+	setNow(t, sealTime)
+
+	suite := Suite{
+		Name:                "test-rsa-oaep-ps256-a256gcm",
+		KeyWrapAlgorithms:   []KeyWrapAlgorithm{RSAOAEP256},
+		SignatureAlgorithms: []SignatureAlgorithm{PS256},
+		ContentAlgorithm:    A256GCM,
+	}
+	assert.NoError(t, RegisterSuite(suite))
+	assert.Error(t, RegisterSuite(suite))
+
+	registered, ok := LookupSuite(suite.Name)
+	assert.True(t, ok)
+	assert.Equal(t, suite, registered)
+
+	invalid := []Suite{
+		{KeyWrapAlgorithms: suite.KeyWrapAlgorithms, SignatureAlgorithms: suite.SignatureAlgorithms, ContentAlgorithm: A256GCM},
+		{Name: "test-no-key-wrap", SignatureAlgorithms: suite.SignatureAlgorithms, ContentAlgorithm: A256GCM},
+		{Name: "test-unknown-key-wrap", KeyWrapAlgorithms: []KeyWrapAlgorithm{"none"}, SignatureAlgorithms: suite.SignatureAlgorithms, ContentAlgorithm: A256GCM},
+		{Name: "test-unknown-signature", KeyWrapAlgorithms: suite.KeyWrapAlgorithms, SignatureAlgorithms: []SignatureAlgorithm{"none"}, ContentAlgorithm: A256GCM},
+		{Name: "test-unknown-content", KeyWrapAlgorithms: suite.KeyWrapAlgorithms, SignatureAlgorithms: suite.SignatureAlgorithms, ContentAlgorithm: "none"},
+	}
+	for _, s := range invalid {
+		assert.Error(t, RegisterSuite(s), s.Name)
+	}
+
+	// The registered suite only allows PS256.
+	sealer := &Sealer{PrivateKey: signedPk1, Cert: signedCert1, ReceiverCerts: []*x509.Certificate{signedCert2}, Suite: suite.Name}
+	_, err := sealer.Seal([]byte("This is a test payload."))
+	assert.Error(t, err)
+
+	sealer.SignatureAlgorithm = PS256
+	message, err := sealer.Seal([]byte("This is a test payload."))
+	assert.NoError(t, err)
+	assert.Equal(t, suite.Name, message.Header.Suite)
+
+	// Registered suites are only accepted by openers listing them.
+	opener := &Opener{PrivateKey: signedPk2, Cert: signedCert2, CertPool: caCertPool}
+	_, err = opener.Open(message)
+	assert.Equal(t, &UnsupportedSuiteError{Suite: suite.Name, Registered: true}, err)
+
+	opener.Suites = []string{suite.Name}
+	payload, err := opener.Open(message)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("This is a test payload."), payload)
+}